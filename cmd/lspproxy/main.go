@@ -0,0 +1,233 @@
+// Command lspproxy runs any language server behind the go-lsp debug UI. Point
+// the editor at lspproxy instead of the server, and it relays stdio between
+// the two while capturing every message, so the traffic of servers not built
+// with go-lsp can be inspected and exported with the same tools.
+//
+//	lspproxy [-addr localhost:7100] [-allow-remote] [-trace out.json] -- gopls serve
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/owenrumney/go-lsp/internal/debugui"
+)
+
+type config struct {
+	addr        string
+	allowRemote bool
+	tracePath   string
+	redact      debugui.TraceExportOptions
+	linger      bool
+	command     []string
+}
+
+func main() {
+	cfg, err := parseFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lspproxy: %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	editor := struct {
+		io.Reader
+		io.Writer
+		io.Closer
+	}{os.Stdin, os.Stdout, io.NopCloser(nil)}
+	code, err := proxy(ctx, cfg, editor, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lspproxy: %v\n", err)
+		if code == 0 {
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+func parseFlags(args []string) (config, error) {
+	var cfg config
+	fs := flag.NewFlagSet("lspproxy", flag.ContinueOnError)
+	fs.StringVar(&cfg.addr, "addr", "localhost:7100", "address to serve the debug UI on, or unix:path for a Unix socket; empty to only capture")
+	fs.BoolVar(&cfg.allowRemote, "allow-remote", false, "allow an -addr that is not loopback")
+	fs.StringVar(&cfg.tracePath, "trace", "", "write a trace of the session to this file when the server exits")
+	fs.BoolVar(&cfg.redact.RedactDocumentText, "redact-text", false, "replace document text in the trace")
+	fs.BoolVar(&cfg.redact.RedactFilePaths, "redact-paths", false, "replace file paths and URIs in the trace")
+	fs.BoolVar(&cfg.redact.RedactLogs, "redact-logs", false, "leave logs out of the trace")
+	fs.BoolVar(&cfg.linger, "linger", false, "keep serving the debug UI after the server exits, until interrupted")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: lspproxy [flags] -- command [args...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return cfg, errors.New("no language server command given")
+	}
+	cfg.command = fs.Args()
+	cfg.redact.Pretty = true
+	return cfg, nil
+}
+
+// proxy runs the language server in cfg, relaying messages between it and
+// editor until it exits. The server's stderr is copied to stderr. It returns
+// the server's exit code.
+func proxy(ctx context.Context, cfg config, editor io.ReadWriteCloser, stderr io.Writer) (int, error) {
+	recorder := debugui.NewRecorder()
+	recordCapabilities(recorder)
+
+	var ui *debugui.DebugUI
+	uiCtx, stopUI := context.WithCancel(context.Background())
+	defer stopUI()
+	if cfg.addr != "" {
+		var opts []debugui.Option
+		if cfg.allowRemote {
+			opts = append(opts, debugui.AllowRemote())
+		}
+		ui = debugui.New(cfg.addr, recorder, opts...)
+		if err := ui.ListenAndServe(uiCtx); err != nil {
+			// The editor still needs its server, so carry on capturing.
+			fmt.Fprintf(stderr, "lspproxy: debug UI unavailable, continuing with capture only: %v\n", err)
+			ui = nil
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, cfg.command[0], cfg.command[1:]...) // #nosec G204 -- running the user's server is the point
+	cmd.WaitDelay = 5 * time.Second
+	logs := &logWriter{w: stderr, store: recorder.LogStore()}
+	cmd.Stderr = logs
+	serverIn, err := cmd.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+	serverOut, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	// Reads from the tap are the editor's messages and writes to it are the
+	// server's, as when a go-lsp server runs with the debug UI.
+	tap := recorder.Tap(editor)
+	go func() {
+		_, _ = io.Copy(serverIn, tap)
+		_ = serverIn.Close()
+	}()
+	_, copyErr := io.Copy(tap, serverOut)
+	waitErr := cmd.Wait()
+	logs.flush()
+
+	code := cmd.ProcessState.ExitCode()
+	var exitErr *exec.ExitError
+	if waitErr != nil && !errors.As(waitErr, &exitErr) {
+		err = waitErr
+	} else if copyErr != nil {
+		err = fmt.Errorf("relay server output: %w", copyErr)
+	}
+	if code < 0 {
+		code = 1
+	}
+
+	if cfg.tracePath != "" {
+		if traceErr := saveTrace(recorder, cfg.tracePath, cfg.redact); traceErr != nil && err == nil {
+			err = traceErr
+		}
+	}
+
+	if cfg.linger && ui != nil && ctx.Err() == nil {
+		fmt.Fprintf(stderr, "lspproxy: %s exited; debug UI still serving on %s, press Ctrl+C to stop\n", cfg.command[0], ui.URL())
+		<-ctx.Done()
+	}
+	return code, err
+}
+
+// recordCapabilities stores the capabilities from the server's initialize
+// result in recorder, so they are shown and exported as for a go-lsp server.
+func recordCapabilities(recorder *debugui.Recorder) {
+	var mu sync.Mutex
+	var initializeID string
+	recorder.Store().Subscribe(func(e debugui.Entry) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case e.MsgType == "request" && e.Method == "initialize":
+			initializeID = e.RPCID
+		case e.MsgType == "response" && e.Direction == debugui.DirectionServerToClient && e.RPCID == initializeID && initializeID != "":
+			var body struct {
+				Result struct {
+					Capabilities json.RawMessage `json:"capabilities"`
+				} `json:"result"`
+			}
+			if json.Unmarshal(e.Body, &body) == nil && body.Result.Capabilities != nil {
+				recorder.SetCapabilities(body.Result.Capabilities)
+			}
+			initializeID = ""
+		}
+	})
+}
+
+func saveTrace(recorder *debugui.Recorder, path string, opts debugui.TraceExportOptions) error {
+	data, err := recorder.ExportTrace(opts)
+	if err != nil {
+		return fmt.Errorf("export trace: %w", err)
+	}
+	if err := debugui.SaveTrace(path, data); err != nil {
+		return fmt.Errorf("save trace: %w", err)
+	}
+	return nil
+}
+
+// logWriter copies the server's stderr to w and adds each line to store, so
+// it shows in the debug UI's log view.
+type logWriter struct {
+	w     io.Writer
+	store *debugui.LogStore
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.store.Add("info", string(bytes.TrimSuffix(l.buf[:i], []byte("\r"))))
+		l.buf = l.buf[i+1:]
+	}
+	return l.w.Write(p)
+}
+
+// flush adds a final line that has no newline.
+func (l *logWriter) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buf) > 0 {
+		l.store.Add("info", string(l.buf))
+		l.buf = nil
+	}
+}
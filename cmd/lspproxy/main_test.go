@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/owenrumney/go-lsp/internal/debugui"
+	"github.com/owenrumney/go-lsp/lsp"
+	"github.com/owenrumney/go-lsp/server"
+	"github.com/owenrumney/go-lsp/servertest"
+)
+
+// helperEnv makes the test binary run as lspproxy, or as the language server
+// behind it, instead of running tests.
+const helperEnv = "LSPPROXY_HELPER"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(helperEnv) {
+	case "proxy":
+		// The server started by the proxy inherits this.
+		_ = os.Setenv(helperEnv, "server")
+		main()
+	case "server":
+		fmt.Fprintln(os.Stderr, "hover server ready")
+		srv := server.NewServer(&hoverHandler{})
+		if err := srv.Run(context.Background(), server.RunStdio()); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type hoverHandler struct{}
+
+func (h *hoverHandler) Initialize(context.Context, *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	return &lsp.InitializeResult{}, nil
+}
+
+func (h *hoverHandler) Shutdown(context.Context) error { return nil }
+
+func (h *hoverHandler) Hover(_ context.Context, params *lsp.HoverParams) (*lsp.Hover, error) {
+	return &lsp.Hover{Contents: lsp.MarkupContent{Kind: lsp.PlainText, Value: string(params.TextDocument.URI)}}, nil
+}
+
+func TestProxy(t *testing.T) {
+	tracePath := filepath.Join(t.TempDir(), "trace.json")
+
+	t.Run("session", func(t *testing.T) {
+		cmd := exec.Command(os.Args[0], "-addr=", "-trace", tracePath, "--", os.Args[0]) // #nosec G204 -- the test binary
+		cmd.Env = append(os.Environ(), helperEnv+"=proxy")
+		h := servertest.NewProcess(t, cmd)
+
+		hover, err := h.Hover("file:///a.txt", 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hover.Contents.Value != "file:///a.txt" {
+			t.Fatalf("hover = %q", hover.Contents.Value)
+		}
+	})
+
+	data, err := os.ReadFile(tracePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace, err := debugui.ParseTrace(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var methods []string
+	for _, e := range trace.Messages {
+		if e.Method != "" {
+			methods = append(methods, e.Direction+" "+e.Method)
+		}
+	}
+	want := []string{
+		"client→server initialize",
+		"client→server initialized",
+		"client→server textDocument/hover",
+		"client→server shutdown",
+		"client→server exit",
+	}
+	if strings.Join(methods, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("messages = %q, want %q", methods, want)
+	}
+	var caps lsp.ServerCapabilities
+	if err := json.Unmarshal(trace.Capabilities, &caps); err != nil || caps.HoverProvider == nil {
+		t.Fatalf("capabilities = %s, want the server's initialize result", trace.Capabilities)
+	}
+	if len(trace.Logs) != 1 || trace.Logs[0].Message != "hover server ready" {
+		t.Fatalf("logs = %+v, want the server's stderr", trace.Logs)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	cfg, err := parseFlags([]string{"-addr", ":0", "-redact-text", "-allow-remote", "--", "gopls", "serve", "-rpc.trace"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.addr != ":0" || !cfg.redact.RedactDocumentText || !cfg.allowRemote || strings.Join(cfg.command, " ") != "gopls serve -rpc.trace" {
+		t.Fatalf("config = %+v", cfg)
+	}
+
+	if _, err := parseFlags([]string{"-addr", ":0"}); err == nil {
+		t.Fatal("expected an error without a command")
+	}
+}
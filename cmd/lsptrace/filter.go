@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/owenrumney/go-lsp/internal/debugui"
+)
+
+// messageFilter selects messages from a trace. Zero fields match everything.
+type messageFilter struct {
+	method    string
+	direction string
+	msgType   string
+	errors    bool
+	grep      string
+}
+
+func filter(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("filter", flag.ContinueOnError)
+	var f messageFilter
+	fs.StringVar(&f.method, "method", "", "only messages for this method, or methods matching this glob, e.g. 'textDocument/*'")
+	dir := fs.String("dir", "", "only messages sent by the client or the server")
+	fs.StringVar(&f.msgType, "type", "", "only requests, responses, or notifications (request, response, notification)")
+	fs.BoolVar(&f.errors, "errors", false, "only error responses and the requests they answer")
+	fs.StringVar(&f.grep, "grep", "", "only messages whose method or body contains this text, ignoring case")
+	body := fs.Bool("body", false, "print each message body")
+	asJSON := fs.Bool("json", false, "write the matching messages as a trace, for sharing or serving")
+	file, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	switch *dir {
+	case "":
+	case "client":
+		f.direction = debugui.DirectionClientToServer
+	case "server":
+		f.direction = debugui.DirectionServerToClient
+	default:
+		return fmt.Errorf("filter: -dir must be client or server, not %q", *dir)
+	}
+	switch f.msgType {
+	case "", "request", "response", "notification":
+	default:
+		return fmt.Errorf("filter: -type must be request, response, or notification, not %q", f.msgType)
+	}
+	if _, err := path.Match(f.method, ""); err != nil {
+		return fmt.Errorf("filter: -method: %w", err)
+	}
+
+	trace, err := loadTrace(file)
+	if err != nil {
+		return err
+	}
+	index := indexMessages(trace.Messages)
+	trace.Messages = f.apply(index, trace.Messages)
+
+	if *asJSON {
+		data, err := json.MarshalIndent(trace, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+	writeMessages(w, index, trace.Messages, *body)
+	return nil
+}
+
+// apply returns the entries that match f, in order. Responses are matched by
+// the method of the request they answer.
+func (f messageFilter) apply(index messages, entries []debugui.Entry) []debugui.Entry {
+	failed := make(map[int]bool)
+	for _, e := range entries {
+		if _, _, ok := responseError(e); ok {
+			failed[e.ID] = true
+			failed[e.PairedWith] = true
+		}
+	}
+
+	var matched []debugui.Entry
+	for _, e := range entries {
+		method := index.method(e)
+		if f.method != "" {
+			if ok, _ := path.Match(f.method, method); !ok {
+				continue
+			}
+		}
+		if f.direction != "" && e.Direction != f.direction {
+			continue
+		}
+		if f.msgType != "" && e.MsgType != f.msgType {
+			continue
+		}
+		if f.errors && !failed[e.ID] {
+			continue
+		}
+		if f.grep != "" {
+			q := strings.ToLower(f.grep)
+			if !strings.Contains(strings.ToLower(method), q) && !strings.Contains(strings.ToLower(string(e.Body)), q) {
+				continue
+			}
+		}
+		matched = append(matched, e)
+	}
+	return matched
+}
+
+// writeMessages prints one line per entry, and its body if withBody is set.
+// index holds the whole trace, so responses show the method of their request
+// even when it was filtered out.
+func writeMessages(w io.Writer, index messages, entries []debugui.Entry, withBody bool) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, e := range entries {
+		fmt.Fprintf(tw, "#%d\t%s\t%s\t%s\t%s", e.ID, e.Timestamp.Format("15:04:05.000"), e.Direction, e.MsgType, index.method(e))
+		if e.RPCID != "" {
+			fmt.Fprintf(tw, "\tid=%s", e.RPCID)
+		}
+		if req, ok := index.request(e); ok {
+			fmt.Fprintf(tw, "\t%s", formatDuration(e.Timestamp.Sub(req.Timestamp)))
+		}
+		if code, msg, ok := responseError(e); ok {
+			fmt.Fprintf(tw, "\terror %d: %s", code, msg)
+		}
+		fmt.Fprintln(tw)
+		if withBody {
+			_ = tw.Flush()
+			var pretty bytes.Buffer
+			if json.Indent(&pretty, e.Body, "    ", "  ") != nil {
+				pretty.Reset()
+				pretty.Write(e.Body)
+			}
+			fmt.Fprintf(w, "    %s\n\n", pretty.Bytes())
+		}
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,172 @@
+// Command lsptrace inspects debug traces saved with Server.SaveDebugTrace,
+// exported from the debug UI, or streamed by WithDebugTraceFile. A streamed
+// trace is read together with the files rotated from it.
+//
+//	lsptrace serve [-addr localhost:7100] [-allow-remote] trace.json
+//	lsptrace summary trace.json
+//	lsptrace filter [-method m] [-dir client|server] [-type t] [-errors] [-grep s] [-body] [-json] trace.json
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/owenrumney/go-lsp/internal/debugui"
+)
+
+const usage = `usage: lsptrace <command> [flags] trace.json
+
+commands:
+  serve    open the trace in the debug UI, read-only
+  summary  print message counts, latencies, and errors per method
+  filter   print or export the messages that match the given flags
+
+Run "lsptrace <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "serve":
+		err = serve(args)
+	case "summary":
+		err = summary(os.Stdout, args)
+	case "filter":
+		err = filter(os.Stdout, args)
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "lsptrace: unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("lsptrace: %v", err)
+	}
+}
+
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:7100", "address to serve the debug UI on, or unix:path for a Unix socket")
+	allowRemote := fs.Bool("allow-remote", false, "allow an -addr that is not loopback")
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	trace, err := loadTrace(path)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := []debugui.Option{debugui.ReadOnly()}
+	if *allowRemote {
+		opts = append(opts, debugui.AllowRemote())
+	}
+	ui := debugui.New(*addr, debugui.NewRecorderFromTrace(trace), opts...)
+	if err := ui.ListenAndServe(ctx); err != nil {
+		return err
+	}
+	fmt.Printf("serving %s (%d messages) on %s, press Ctrl+C to stop\n", path, len(trace.Messages), ui.URL())
+	<-ctx.Done()
+	return nil
+}
+
+// parseArgs parses flags followed by exactly one trace path.
+func parseArgs(fs *flag.FlagSet, args []string) (string, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: lsptrace %s [flags] trace.json\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", fmt.Errorf("%s: expected one trace file", fs.Name())
+	}
+	return fs.Arg(0), nil
+}
+
+func loadTrace(path string) (*debugui.Trace, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is the trace the user asked to open
+	if err != nil {
+		return nil, err
+	}
+	var trace *debugui.Trace
+	if debugui.IsTraceFile(data) {
+		trace, err = debugui.LoadTraceFiles(path)
+	} else {
+		trace, err = debugui.ParseTrace(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return trace, nil
+}
+
+// messages indexes a trace's messages by entry ID, so responses can be
+// matched with the requests they answer.
+type messages map[int]debugui.Entry
+
+func indexMessages(entries []debugui.Entry) messages {
+	m := make(messages, len(entries))
+	for _, e := range entries {
+		m[e.ID] = e
+	}
+	return m
+}
+
+// method returns the method of e, or of the request e answers.
+func (m messages) method(e debugui.Entry) string {
+	if req, ok := m.request(e); ok {
+		return req.Method
+	}
+	return e.Method
+}
+
+// request returns the request e answers.
+func (m messages) request(e debugui.Entry) (debugui.Entry, bool) {
+	if e.MsgType != "response" || e.PairedWith < 0 {
+		return debugui.Entry{}, false
+	}
+	req, ok := m[e.PairedWith]
+	return req, ok
+}
+
+// responseError returns the error in a response body, if any.
+func responseError(e debugui.Entry) (code int, message string, ok bool) {
+	if e.MsgType != "response" {
+		return 0, "", false
+	}
+	var body struct {
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(e.Body, &body); err != nil || body.Error == nil {
+		return 0, "", false
+	}
+	return body.Error.Code, body.Error.Message, true
+}
+
+func fatal(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/owenrumney/go-lsp/internal/debugui"
+)
+
+const testTrace = "testdata/trace.json"
+
+func TestSummary(t *testing.T) {
+	var out bytes.Buffer
+	if err := summary(&out, []string{testTrace}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		"testdata/trace.json: 10 messages, 1 log, recorded 2026-03-02 10:00:05 UTC, spanning 5s",
+		"textDocument/hover               client→server  2      1       0           5ms   150ms  150ms",
+		"textDocument/completion          client→server  1      0       1           -     -      -",
+		"textDocument/publishDiagnostics  server→client  1      -       -           -     -      -",
+		"#7 textDocument/hover (id 3): -32603 document not found: file:///b.go",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("summary is missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string // IDs of the matching messages
+	}{
+		{name: "all", args: nil, want: []string{"#0", "#1", "#2", "#3", "#4", "#5", "#6", "#7", "#8", "#9"}},
+		{name: "method matches responses", args: []string{"-method", "initialize"}, want: []string{"#0", "#1"}},
+		{name: "method glob", args: []string{"-method", "textDocument/*", "-type", "notification"}, want: []string{"#3", "#8"}},
+		{name: "direction", args: []string{"-dir", "server"}, want: []string{"#1", "#5", "#7", "#8"}},
+		{name: "errors", args: []string{"-errors"}, want: []string{"#6", "#7"}},
+		{name: "grep", args: []string{"-grep", "B.GO"}, want: []string{"#6", "#7"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := filter(&out, append(tt.args, testTrace)); err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				ids = append(ids, strings.Fields(line)[0])
+			}
+			if strings.Join(ids, " ") != strings.Join(tt.want, " ") {
+				t.Fatalf("matched %v, want %v:\n%s", ids, tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestFilterJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := filter(&out, []string{"-errors", "-json", testTrace}); err != nil {
+		t.Fatal(err)
+	}
+
+	trace, err := debugui.ParseTrace(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace.Messages) != 2 || trace.Messages[0].ID != 6 || trace.Messages[1].ID != 7 {
+		t.Fatalf("messages = %+v, want entries 6 and 7", trace.Messages)
+	}
+	if len(trace.Logs) != 1 || string(trace.Capabilities) == "" {
+		t.Fatalf("logs = %+v, capabilities = %s, want them kept", trace.Logs, trace.Capabilities)
+	}
+}
+
+func TestFilterRejectsBadFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"-dir", "both", testTrace},
+		{"-type", "event", testTrace},
+		{"-method", "[", testTrace},
+		{},
+	} {
+		if err := filter(&bytes.Buffer{}, args); err == nil {
+			t.Errorf("filter(%q) succeeded, want an error", args)
+		}
+	}
+}
+
+func TestSummaryOfTraceFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	tf, err := debugui.CreateTraceFile(path, debugui.TraceFileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := debugui.NewRecorder()
+	rec.StreamTo(tf)
+	rec.Store().Add(debugui.DirectionClientToServer, []byte(`{"jsonrpc":"2.0","id":1,"method":"textDocument/hover","params":{}}`))
+	rec.Store().Add(debugui.DirectionServerToClient, []byte(`{"jsonrpc":"2.0","id":1,"result":null}`))
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := summary(&out, []string{path}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "2 messages") {
+		t.Errorf("summary = %s, want the streamed messages", out.String())
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/owenrumney/go-lsp/internal/debugui"
+)
+
+// methodSummary aggregates the messages for one method in one direction.
+type methodSummary struct {
+	method        string
+	direction     string
+	count         int
+	notifications bool
+	errors        int
+	unanswered    int
+	latencies     []time.Duration
+}
+
+// failure is a response that carried an error.
+type failure struct {
+	response debugui.Entry
+	method   string
+	code     int
+	message  string
+}
+
+func summary(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("summary", flag.ContinueOnError)
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	trace, err := loadTrace(path)
+	if err != nil {
+		return err
+	}
+	writeSummary(w, path, trace)
+	return nil
+}
+
+func writeSummary(w io.Writer, name string, trace *debugui.Trace) {
+	methods, failures := summarize(trace.Messages)
+
+	fmt.Fprintf(w, "%s: %s, %s, recorded %s", name,
+		plural(len(trace.Messages), "message"), plural(len(trace.Logs), "log"),
+		trace.CreatedAt.UTC().Format("2006-01-02 15:04:05 MST"))
+	if n := len(trace.Messages); n > 1 {
+		fmt.Fprintf(w, ", spanning %s", formatDuration(trace.Messages[n-1].Timestamp.Sub(trace.Messages[0].Timestamp)))
+	}
+	fmt.Fprintln(w)
+	if len(methods) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tDIRECTION\tCOUNT\tERRORS\tUNANSWERED\tP50\tP95\tMAX")
+	for _, m := range methods {
+		if m.notifications {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t-\t-\t-\t-\t-\n", m.method, m.direction, m.count)
+			continue
+		}
+		p50, p95, maxLatency := "-", "-", "-"
+		if len(m.latencies) > 0 {
+			slices.Sort(m.latencies)
+			p50 = formatDuration(percentile(m.latencies, 0.50))
+			p95 = formatDuration(percentile(m.latencies, 0.95))
+			maxLatency = formatDuration(m.latencies[len(m.latencies)-1])
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\t%s\t%s\n", m.method, m.direction, m.count, m.errors, m.unanswered, p50, p95, maxLatency)
+	}
+	_ = tw.Flush()
+
+	if len(failures) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nERRORS")
+	for _, f := range failures {
+		fmt.Fprintf(w, "#%d %s (id %s): %d %s\n", f.response.ID, f.method, f.response.RPCID, f.code, f.message)
+	}
+}
+
+// summarize groups messages by method and direction, most frequent first,
+// and collects error responses in trace order.
+func summarize(entries []debugui.Entry) ([]*methodSummary, []failure) {
+	index := indexMessages(entries)
+	byKey := make(map[[2]string]*methodSummary)
+	get := func(method, direction string) *methodSummary {
+		key := [2]string{method, direction}
+		m := byKey[key]
+		if m == nil {
+			m = &methodSummary{method: method, direction: direction}
+			byKey[key] = m
+		}
+		return m
+	}
+
+	var failures []failure
+	for _, e := range entries {
+		switch e.MsgType {
+		case "request":
+			m := get(e.Method, e.Direction)
+			m.count++
+			if e.PairedWith < 0 {
+				m.unanswered++
+			}
+		case "notification":
+			m := get(e.Method, e.Direction)
+			m.count++
+			m.notifications = true
+		case "response":
+			req, ok := index.request(e)
+			if !ok {
+				continue
+			}
+			m := get(req.Method, req.Direction)
+			m.latencies = append(m.latencies, e.Timestamp.Sub(req.Timestamp))
+			if code, msg, ok := responseError(e); ok {
+				m.errors++
+				failures = append(failures, failure{response: e, method: req.Method, code: code, message: msg})
+			}
+		}
+	}
+
+	methods := make([]*methodSummary, 0, len(byKey))
+	for _, m := range byKey {
+		methods = append(methods, m)
+	}
+	slices.SortFunc(methods, func(a, b *methodSummary) int {
+		return cmp.Or(
+			cmp.Compare(b.count, a.count),
+			cmp.Compare(a.method, b.method),
+			cmp.Compare(a.direction, b.direction),
+		)
+	})
+	return methods, failures
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+func formatDuration(d time.Duration) string {
+	if d >= time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Microsecond).String()
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
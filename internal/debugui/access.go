@@ -0,0 +1,217 @@
+package debugui
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrRemoteAddr is returned by ListenAndServe when the address is not a
+// loopback address and AllowRemote was not set.
+var ErrRemoteAddr = errors.New("debug UI address is not loopback")
+
+// unixPrefix marks an address as the path of a Unix socket.
+const unixPrefix = "unix:"
+
+// AllowRemote lets the UI listen on addresses other than loopback, such as
+// ":7100" on every interface. The token is still required, but it is sent in
+// the clear over HTTP, so only use this on a network you trust.
+func AllowRemote() Option {
+	return func(d *DebugUI) {
+		d.allowRemote = true
+	}
+}
+
+// newToken returns a random token for a debug UI session.
+func newToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Token returns the secret that the API and websocket require.
+func (d *DebugUI) Token() string { return d.token }
+
+// URL returns the address to open the UI at, including the token, or "" before
+// ListenAndServe has bound it. For a Unix socket the host is localhost, as
+// the client chooses the socket.
+func (d *DebugUI) URL() string {
+	addr := d.Addr()
+	if addr == nil {
+		return ""
+	}
+	host := addr.String()
+	if addr.Network() == "unix" {
+		host = "localhost"
+	}
+	return "http://" + host + "/?token=" + d.token
+}
+
+// listen binds addr. An address without a host listens on loopback unless
+// AllowRemote is set, and one with the unix: prefix listens on a Unix socket
+// that only the current user can connect to.
+func (d *DebugUI) listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		return listenUnix(path)
+	}
+
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" && !d.allowRemote {
+		addr = net.JoinHostPort("127.0.0.1", port)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tcp, ok := ln.Addr().(*net.TCPAddr); ok && !tcp.IP.IsLoopback() && !d.allowRemote {
+		_ = ln.Close()
+		return nil, fmt.Errorf("%w: %s", ErrRemoteAddr, addr)
+	}
+	return ln, nil
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode().Type() == fs.ModeSocket {
+		// A socket that still answers belongs to a running server. One that
+		// does not was left behind by a server that crashed, and would fail
+		// the bind.
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("debug UI socket %s is in use by another process", path)
+		}
+		_ = os.Remove(path)
+	}
+
+	// Bind inside a directory that only the current user can enter, so the
+	// socket cannot be opened by anyone else before its mode is set, and
+	// then link it into place. Unlike a rename, the link fails rather than
+	// replace a file that is already at path.
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".debugui-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	tmp := filepath.Join(dir, "sock")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	ln.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0o600); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	if err := os.Link(tmp, path); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return &unixListener{UnixListener: ln, path: path}, nil
+}
+
+// unixListener removes its socket when it is closed, as it was bound under
+// another name.
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	_ = os.Remove(l.path)
+	return err
+}
+
+// protect wraps the UI's handlers with its access checks. Requests from
+// other origins are refused outright. The API and websocket also need the
+// token, sent as a bearer token, a token query parameter, or the cookie set
+// when the page is opened at URL. The page itself and /metrics are served
+// without it, as they hold no captured data.
+func (d *DebugUI) protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !sameOrigin(r) {
+			http.Error(w, "cross-origin request refused", http.StatusForbidden)
+			return
+		}
+
+		if r.URL.Path == "/" && r.URL.Query().Has("token") {
+			// Swap the token in the URL for a cookie, so it does not stay in
+			// the address bar or the browser history.
+			if !d.validToken(r.URL.Query().Get("token")) {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     d.cookieName(),
+				Value:    d.token,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			})
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		if needsToken(r.URL.Path) && !d.authorized(r) {
+			http.Error(w, "missing or invalid debug UI token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func needsToken(path string) bool {
+	return path == "/ws" || strings.HasPrefix(path, "/api/")
+}
+
+func (d *DebugUI) authorized(r *http.Request) bool {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && d.validToken(token) {
+		return true
+	}
+	if token := r.URL.Query().Get("token"); token != "" && d.validToken(token) {
+		return true
+	}
+	c, err := r.Cookie(d.cookieName())
+	return err == nil && d.validToken(c.Value)
+}
+
+func (d *DebugUI) validToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(d.token)) == 1
+}
+
+// cookieName includes the port, as cookies are shared by every port on a
+// host and each UI has its own token.
+func (d *DebugUI) cookieName() string {
+	if tcp, ok := d.Addr().(*net.TCPAddr); ok {
+		return fmt.Sprintf("debugui_%d", tcp.Port)
+	}
+	return "debugui"
+}
+
+// sameOrigin reports whether r comes from the UI's own page, or from a tool
+// such as curl that sends no origin.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
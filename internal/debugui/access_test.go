@@ -0,0 +1,214 @@
+package debugui
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apiRequest is httptest.NewRequest with d's token.
+func apiRequest(d *DebugUI, method, target string, body io.Reader) *http.Request {
+	r := httptest.NewRequest(method, target, body)
+	r.Header.Set("Authorization", "Bearer "+d.Token())
+	return r
+}
+
+func TestAPIRequiresToken(t *testing.T) {
+	d := New("127.0.0.1:0", NewRecorder())
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		d.srv.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, target := range []string{"/api/messages", "/api/documents", "/ws", "/api/messages?token=wrong"} {
+		if w := serve(httptest.NewRequest(http.MethodGet, target, nil)); w.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s without the token: status = %d, want 401", target, w.Code)
+		}
+	}
+	if w := serve(httptest.NewRequest(http.MethodGet, "/", nil)); w.Code != http.StatusOK {
+		t.Errorf("GET / status = %d, want the page without a token", w.Code)
+	}
+	if w := serve(apiRequest(d, http.MethodGet, "/api/messages", nil)); w.Code != http.StatusOK {
+		t.Errorf("bearer token: status = %d", w.Code)
+	}
+	if w := serve(httptest.NewRequest(http.MethodGet, "/api/messages?token="+d.Token(), nil)); w.Code != http.StatusOK {
+		t.Errorf("query token: status = %d", w.Code)
+	}
+
+	// Opening the URL swaps the token for a cookie.
+	w := serve(httptest.NewRequest(http.MethodGet, "/?token="+d.Token(), nil))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/" {
+		t.Fatalf("GET /?token= status = %d, location = %q", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("cookies = %+v, want one strict HttpOnly cookie", cookies)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/messages", nil)
+	r.AddCookie(cookies[0])
+	if w := serve(r); w.Code != http.StatusOK {
+		t.Errorf("cookie: status = %d", w.Code)
+	}
+	if w := serve(httptest.NewRequest(http.MethodGet, "/?token=wrong", nil)); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET /?token=wrong status = %d, want 401", w.Code)
+	}
+}
+
+func TestCrossOriginRequestsRefused(t *testing.T) {
+	d := New("127.0.0.1:0", NewRecorder())
+	for _, tt := range []struct {
+		header, value string
+		refused       bool
+	}{
+		{"Origin", "http://example.com", true},
+		{"Origin", "null", true},
+		{"Sec-Fetch-Site", "cross-site", true},
+		{"Sec-Fetch-Site", "same-site", true},
+		{"Origin", "http://example.com:7100", false},
+		{"Sec-Fetch-Site", "same-origin", false},
+	} {
+		r := apiRequest(d, http.MethodDelete, "http://example.com:7100/api/messages", nil)
+		r.Header.Set(tt.header, tt.value)
+		w := httptest.NewRecorder()
+		d.srv.Handler.ServeHTTP(w, r)
+		if refused := w.Code == http.StatusForbidden; refused != tt.refused {
+			t.Errorf("%s: %s: status = %d, want refused %v", tt.header, tt.value, w.Code, tt.refused)
+		}
+	}
+}
+
+func TestListenRefusesRemoteAddr(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := New(":0", NewRecorder())
+	if err := d.ListenAndServe(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ip := d.Addr().(*net.TCPAddr).IP; !ip.IsLoopback() {
+		t.Errorf("an address without a host listened on %v, want loopback", ip)
+	}
+	if !strings.Contains(d.URL(), "/?token="+d.Token()) {
+		t.Errorf("URL = %q, want the token", d.URL())
+	}
+
+	err := New("0.0.0.0:0", NewRecorder()).ListenAndServe(ctx)
+	if !errors.Is(err, ErrRemoteAddr) {
+		t.Errorf("err = %v, want ErrRemoteAddr", err)
+	}
+	if err := New("0.0.0.0:0", NewRecorder(), AllowRemote()).ListenAndServe(ctx); err != nil {
+		t.Errorf("AllowRemote: %v", err)
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	// Unix socket paths are limited to about 100 bytes, which t.TempDir can
+	// exceed.
+	dir, err := os.MkdirTemp("", "debugui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "ui.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := New("unix:"+path, NewRecorder())
+	if err := d.ListenAndServe(ctx); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("socket mode = %v, want 0600", perm)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get(strings.Replace(d.URL(), "/?", "/api/messages?", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d", resp.StatusCode)
+	}
+}
+
+func TestListenUnixSocketInUse(t *testing.T) {
+	dir, err := os.MkdirTemp("", "debugui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "ui.sock")
+
+	// A socket left behind by a server that crashed is replaced.
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := New("unix:"+path, NewRecorder())
+	if err := d.ListenAndServe(ctx); err != nil {
+		t.Fatalf("replacing a stale socket: %v", err)
+	}
+	if d.Addr().String() != path {
+		t.Errorf("Addr() = %s, want %s", d.Addr(), path)
+	}
+
+	// One that a running server answers on is left alone.
+	other := New("unix:"+path, NewRecorder())
+	if err := other.ListenAndServe(context.Background()); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("second UI on a live socket: err = %v", err)
+	}
+	if conn, err := net.Dial("unix", path); err != nil {
+		t.Fatalf("live socket was removed: %v", err)
+	} else {
+		_ = conn.Close()
+	}
+
+	// The socket is removed when the UI stops.
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("socket not removed after the UI stopped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A file that is not a socket is never replaced.
+	if err := os.WriteFile(path, []byte("keep"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := New("unix:"+path, NewRecorder()).ListenAndServe(context.Background()); err == nil {
+		t.Fatal("listening over a regular file succeeded")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "keep" {
+		t.Errorf("file = %q, want it untouched", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary directories left behind: %v", entries)
+	}
+}
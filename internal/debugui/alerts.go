@@ -0,0 +1,98 @@
+package debugui
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const maxAlerts = 500
+
+// Alert is a problem the server noticed in its own handling, such as a
+// request that has run for too long.
+type Alert struct {
+	ID        int       `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Kind      string    `json:"kind"` // "slow" or "stuck"
+	Method    string    `json:"method"`
+	// RPCID is the ID of the request, or empty for a notification.
+	RPCID     string  `json:"rpcId,omitempty"`
+	ElapsedMs float64 `json:"elapsedMs"`
+	// Params is a summary of the message's params.
+	Params string `json:"params,omitempty"`
+	// Stack is the stack of the goroutine running the handler when the alert
+	// was raised.
+	Stack string `json:"stack,omitempty"`
+}
+
+// AlertSubscriber receives new alerts.
+type AlertSubscriber func(Alert)
+
+// AlertStore is a thread-safe list of the most recent alerts.
+type AlertStore struct {
+	mu          sync.RWMutex
+	alerts      []Alert
+	nextID      int
+	subscribers []AlertSubscriber
+}
+
+// NewAlertStore creates an empty AlertStore.
+func NewAlertStore() *AlertStore {
+	return &AlertStore{}
+}
+
+// Subscribe registers a callback for new alerts.
+func (s *AlertStore) Subscribe(fn AlertSubscriber) {
+	s.mu.Lock()
+	s.subscribers = append(s.subscribers, fn)
+	s.mu.Unlock()
+}
+
+// Add stores a with the next ID, and the current time if it has none, and
+// notifies subscribers.
+func (s *AlertStore) Add(a Alert) {
+	if a.Timestamp.IsZero() {
+		a.Timestamp = time.Now()
+	}
+
+	s.mu.Lock()
+	a.ID = s.nextID
+	s.nextID++
+	s.alerts = append(s.alerts, a)
+	if len(s.alerts) > maxAlerts {
+		s.alerts = append(s.alerts[:0], s.alerts[len(s.alerts)-maxAlerts:]...)
+	}
+	subs := make([]AlertSubscriber, len(s.subscribers))
+	copy(subs, s.subscribers)
+	s.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(a)
+	}
+}
+
+// All returns the stored alerts, oldest first.
+func (s *AlertStore) All() []Alert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Alert{}, s.alerts...)
+}
+
+// Clear removes all alerts.
+func (s *AlertStore) Clear() {
+	s.mu.Lock()
+	s.alerts = nil
+	s.mu.Unlock()
+}
+
+func (d *DebugUI) handleAlerts(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(d.recorder.alertStore.All())
+}
+
+func (d *DebugUI) handleAlertsClear(w http.ResponseWriter, _ *http.Request) {
+	d.recorder.alertStore.Clear()
+	d.hub.Broadcast(wsMessage{Kind: "clear-alerts"})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,32 @@
+package debugui
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAlertsEndpoint(t *testing.T) {
+	rec := NewRecorder()
+	d := New("127.0.0.1:0", rec)
+	for range maxAlerts + 1 {
+		rec.AlertStore().Add(Alert{Kind: "slow", Method: "textDocument/hover", RPCID: "2", Stack: "goroutine 7 [sync.Mutex.Lock]:"})
+	}
+
+	w := httptest.NewRecorder()
+	d.srv.Handler.ServeHTTP(w, apiRequest(d, http.MethodGet, "/api/alerts", nil))
+	var alerts []Alert
+	if err := json.Unmarshal(w.Body.Bytes(), &alerts); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != maxAlerts || alerts[0].ID != 1 || alerts[0].Timestamp.IsZero() {
+		t.Fatalf("got %d alerts from ID %d, want the latest %d", len(alerts), alerts[0].ID, maxAlerts)
+	}
+
+	w = httptest.NewRecorder()
+	d.srv.Handler.ServeHTTP(w, apiRequest(d, http.MethodDelete, "/api/alerts", nil))
+	if w.Code != http.StatusNoContent || len(rec.AlertStore().All()) != 0 {
+		t.Fatalf("DELETE status = %d, %d alerts left", w.Code, len(rec.AlertStore().All()))
+	}
+}
@@ -0,0 +1,231 @@
+package debugui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// Injector handles msg, a JSON-RPC request or notification body composed in
+// the debug UI, as if the editor had sent it. It returns the body of the
+// response to a request, or nil and the handler's error for a notification.
+// The response is not sent to the editor.
+type Injector func(ctx context.Context, msg []byte) ([]byte, error)
+
+// WithInjector enables the request composer, which sends messages to the
+// server through inject. It has no effect on a ReadOnly UI.
+func WithInjector(inject Injector) Option {
+	return func(d *DebugUI) {
+		d.inject = inject
+	}
+}
+
+// ComposeMethod is a method offered by the request composer.
+type ComposeMethod struct {
+	Method       string `json:"method"`
+	Notification bool   `json:"notification,omitempty"`
+	// Advertised reports whether the server's capabilities include the
+	// method. Methods the client drives, such as didOpen, are always
+	// advertised.
+	Advertised bool `json:"advertised"`
+	// Template is example params built from the method's lsp type.
+	Template json.RawMessage `json:"template"`
+}
+
+// ComposeRequest is the body of POST /api/compose.
+type ComposeRequest struct {
+	Method       string          `json:"method"`
+	Params       json.RawMessage `json:"params,omitempty"`
+	Notification bool            `json:"notification,omitempty"`
+}
+
+// ComposeResult is the outcome of a composed message.
+type ComposeResult struct {
+	// EntryID is the ID of the message in the Store.
+	EntryID int `json:"entryId"`
+	// Response is the server's response to a request.
+	Response json.RawMessage `json:"response,omitempty"`
+	// Error is the error returned by a notification's handler.
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+// composeMethod describes a method the composer offers. capability is the
+// ServerCapabilities field that advertises it, or empty for methods the
+// client drives.
+type composeMethod struct {
+	method       string
+	capability   string
+	notification bool
+	params       any
+}
+
+var composeMethods = []composeMethod{
+	{"textDocument/didOpen", "", true, lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{Version: 1}}},
+	{"textDocument/didChange", "", true, lsp.DidChangeTextDocumentParams{ContentChanges: []lsp.TextDocumentContentChangeEvent{{}}}},
+	{"textDocument/didSave", "", true, lsp.DidSaveTextDocumentParams{}},
+	{"textDocument/didClose", "", true, lsp.DidCloseTextDocumentParams{}},
+	{"workspace/didChangeConfiguration", "", true, lsp.DidChangeConfigurationParams{}},
+	{"workspace/didChangeWatchedFiles", "", true, lsp.DidChangeWatchedFilesParams{}},
+	{"textDocument/completion", "completionProvider", false, lsp.CompletionParams{}},
+	{"textDocument/hover", "hoverProvider", false, lsp.HoverParams{}},
+	{"textDocument/signatureHelp", "signatureHelpProvider", false, lsp.SignatureHelpParams{}},
+	{"textDocument/declaration", "declarationProvider", false, lsp.DeclarationParams{}},
+	{"textDocument/definition", "definitionProvider", false, lsp.DefinitionParams{}},
+	{"textDocument/typeDefinition", "typeDefinitionProvider", false, lsp.TypeDefinitionParams{}},
+	{"textDocument/implementation", "implementationProvider", false, lsp.ImplementationParams{}},
+	{"textDocument/references", "referencesProvider", false, lsp.ReferenceParams{}},
+	{"textDocument/documentHighlight", "documentHighlightProvider", false, lsp.DocumentHighlightParams{}},
+	{"textDocument/documentSymbol", "documentSymbolProvider", false, lsp.DocumentSymbolParams{}},
+	{"textDocument/codeAction", "codeActionProvider", false, lsp.CodeActionParams{}},
+	{"textDocument/codeLens", "codeLensProvider", false, lsp.CodeLensParams{}},
+	{"textDocument/documentLink", "documentLinkProvider", false, lsp.DocumentLinkParams{}},
+	{"textDocument/documentColor", "colorProvider", false, lsp.DocumentColorParams{}},
+	{"textDocument/formatting", "documentFormattingProvider", false, lsp.DocumentFormattingParams{}},
+	{"textDocument/rangeFormatting", "documentRangeFormattingProvider", false, lsp.DocumentRangeFormattingParams{}},
+	{"textDocument/onTypeFormatting", "documentOnTypeFormattingProvider", false, lsp.DocumentOnTypeFormattingParams{}},
+	{"textDocument/rename", "renameProvider", false, lsp.RenameParams{}},
+	{"textDocument/prepareRename", "renameProvider", false, lsp.PrepareRenameParams{}},
+	{"textDocument/foldingRange", "foldingRangeProvider", false, lsp.FoldingRangeParams{}},
+	{"textDocument/selectionRange", "selectionRangeProvider", false, lsp.SelectionRangeParams{}},
+	{"textDocument/linkedEditingRange", "linkedEditingRangeProvider", false, lsp.LinkedEditingRangeParams{}},
+	{"textDocument/moniker", "monikerProvider", false, lsp.MonikerParams{}},
+	{"textDocument/prepareCallHierarchy", "callHierarchyProvider", false, lsp.CallHierarchyPrepareParams{}},
+	{"textDocument/prepareTypeHierarchy", "typeHierarchyProvider", false, lsp.TypeHierarchyPrepareParams{}},
+	{"textDocument/inlayHint", "inlayHintProvider", false, lsp.InlayHintParams{}},
+	{"textDocument/inlineValue", "inlineValueProvider", false, lsp.InlineValueParams{}},
+	{"textDocument/diagnostic", "diagnosticProvider", false, lsp.DocumentDiagnosticParams{}},
+	{"textDocument/semanticTokens/full", "semanticTokensProvider", false, lsp.SemanticTokensParams{}},
+	{"textDocument/semanticTokens/full/delta", "semanticTokensProvider", false, lsp.SemanticTokensDeltaParams{}},
+	{"textDocument/semanticTokens/range", "semanticTokensProvider", false, lsp.SemanticTokensRangeParams{}},
+	{"workspace/symbol", "workspaceSymbolProvider", false, lsp.WorkspaceSymbolParams{}},
+	{"workspace/executeCommand", "executeCommandProvider", false, lsp.ExecuteCommandParams{}},
+	{"workspace/diagnostic", "diagnosticProvider", false, lsp.WorkspaceDiagnosticParams{}},
+}
+
+// ComposeMethods returns the methods the request composer offers, with
+// templates that refer to uri.
+func (r *Recorder) ComposeMethods(uri string) []ComposeMethod {
+	var caps map[string]json.RawMessage
+	_ = json.Unmarshal(r.capabilitiesSnapshot(), &caps)
+
+	methods := make([]ComposeMethod, 0, len(composeMethods))
+	for _, m := range composeMethods {
+		advertised := m.capability == ""
+		if v, ok := caps[m.capability]; ok && string(v) != "null" && string(v) != "false" {
+			advertised = true
+		}
+		methods = append(methods, ComposeMethod{
+			Method:       m.method,
+			Notification: m.notification,
+			Advertised:   advertised,
+			Template:     paramsTemplate(m.params, uri),
+		})
+	}
+	return methods
+}
+
+// paramsTemplate marshals params with every URI set to uri and every nil
+// slice made empty, so the template shows where values go.
+func paramsTemplate(params any, uri string) json.RawMessage {
+	v := reflect.New(reflect.TypeOf(params)).Elem()
+	v.Set(reflect.ValueOf(params))
+	fillTemplate(v, uri)
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return json.RawMessage("{}")
+	}
+	return data
+}
+
+func fillTemplate(v reflect.Value, uri string) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := range v.NumField() {
+			f := v.Field(i)
+			if !f.CanSet() {
+				continue
+			}
+			if v.Type().Field(i).Name == "URI" && f.Kind() == reflect.String {
+				f.SetString(uri)
+				continue
+			}
+			fillTemplate(f, uri)
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		}
+	}
+}
+
+// composeMessage is a JSON-RPC message built by the composer.
+type composeMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      string          `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// composeIDs numbers composed requests. Their IDs are strings so they cannot
+// be confused with the editor's.
+var composeIDs atomic.Int64
+
+func (d *DebugUI) handleComposeMethods(w http.ResponseWriter, _ *http.Request) {
+	uri := "file:///path/to/file"
+	for _, doc := range d.recorder.Documents() {
+		if doc.Open {
+			uri = doc.URI
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(d.recorder.ComposeMethods(uri))
+}
+
+func (d *DebugUI) handleCompose(w http.ResponseWriter, r *http.Request) {
+	var req ComposeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Method == "" {
+		http.Error(w, "method is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Params) > 0 && req.Params[0] != '{' && req.Params[0] != '[' {
+		http.Error(w, "params must be an object or an array", http.StatusBadRequest)
+		return
+	}
+
+	msg := composeMessage{JSONRPC: "2.0", Method: req.Method, Params: req.Params}
+	if !req.Notification {
+		msg.ID = fmt.Sprintf("debugui-%d", composeIDs.Add(1))
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entry := d.recorder.store.AddInjected(DirectionClientToServer, body)
+	result := ComposeResult{EntryID: entry.ID}
+	start := time.Now()
+	resp, err := d.inject(r.Context(), body)
+	result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if resp != nil {
+		d.recorder.store.AddInjected(DirectionServerToClient, resp)
+		result.Response = resp
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
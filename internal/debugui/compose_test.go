@@ -0,0 +1,118 @@
+package debugui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestComposeMethods(t *testing.T) {
+	rec := NewRecorder()
+	rec.SetCapabilities(map[string]any{"hoverProvider": true, "definitionProvider": false})
+	rec.Store().Add(DirectionClientToServer, []byte(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.txt","languageId":"plaintext","version":1,"text":""}}}`))
+	d := New("127.0.0.1:0", rec, WithInjector(func(context.Context, []byte) ([]byte, error) { return nil, nil }))
+
+	w := httptest.NewRecorder()
+	d.srv.Handler.ServeHTTP(w, apiRequest(d, http.MethodGet, "/api/compose/methods", nil))
+	var methods []ComposeMethod
+	if err := json.Unmarshal(w.Body.Bytes(), &methods); err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]ComposeMethod)
+	for _, m := range methods {
+		byName[m.Method] = m
+	}
+
+	if m := byName["textDocument/hover"]; !m.Advertised || m.Notification {
+		t.Errorf("hover = %+v, want an advertised request", m)
+	}
+	if byName["textDocument/definition"].Advertised {
+		t.Error("definition should not be advertised")
+	}
+	if m := byName["textDocument/didChange"]; !m.Advertised || !m.Notification {
+		t.Errorf("didChange = %+v, want an advertised notification", m)
+	}
+	var hover struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+		Position *struct{} `json:"position"`
+	}
+	if err := json.Unmarshal(byName["textDocument/hover"].Template, &hover); err != nil || hover.TextDocument.URI != "file:///a.txt" || hover.Position == nil {
+		t.Errorf("hover template = %s, want the open document", byName["textDocument/hover"].Template)
+	}
+	if !strings.Contains(string(byName["workspace/didChangeWatchedFiles"].Template), `"changes":[]`) {
+		t.Errorf("didChangeWatchedFiles template = %s, want an empty changes list", byName["workspace/didChangeWatchedFiles"].Template)
+	}
+}
+
+func TestCompose(t *testing.T) {
+	rec := NewRecorder()
+	var sent []string
+	d := New("127.0.0.1:0", rec, WithInjector(func(_ context.Context, msg []byte) ([]byte, error) {
+		sent = append(sent, string(msg))
+		var m struct {
+			ID     string `json:"id"`
+			Method string `json:"method"`
+		}
+		_ = json.Unmarshal(msg, &m)
+		if m.ID == "" {
+			return nil, errors.New("cannot parse")
+		}
+		return []byte(`{"jsonrpc":"2.0","id":"` + m.ID + `","result":{"contents":"x"}}`), nil
+	}))
+	rec.Store().Add(DirectionClientToServer, []byte(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`))
+
+	post := func(body string) (*httptest.ResponseRecorder, ComposeResult) {
+		w := httptest.NewRecorder()
+		d.srv.Handler.ServeHTTP(w, apiRequest(d, http.MethodPost, "/api/compose", strings.NewReader(body)))
+		var res ComposeResult
+		_ = json.Unmarshal(w.Body.Bytes(), &res)
+		return w, res
+	}
+
+	w, res := post(`{"method":"textDocument/hover","params":{"position":{"line":0,"character":0}}}`)
+	if w.Code != http.StatusOK || res.Error != "" || !strings.Contains(string(res.Response), `"contents":"x"`) {
+		t.Fatalf("hover: %d %+v", w.Code, res)
+	}
+	if !strings.HasPrefix(sent[0], `{"jsonrpc":"2.0","id":"debugui-`) {
+		t.Errorf("sent %s, want a debugui request ID", sent[0])
+	}
+	req := rec.Store().Entry(res.EntryID)
+	if req == nil || !req.Injected || req.MsgType != "request" || req.PairedWith < 0 {
+		t.Fatalf("request entry = %+v, want an injected request with a response", req)
+	}
+	if resp := rec.Store().Entry(req.PairedWith); resp == nil || !resp.Injected || resp.Direction != DirectionServerToClient {
+		t.Errorf("response entry = %+v", resp)
+	}
+	if rec.Store().Entry(0).Injected {
+		t.Error("editor traffic should not be tagged as injected")
+	}
+
+	_, res = post(`{"method":"textDocument/didOpen","params":{},"notification":true}`)
+	if res.Error != "cannot parse" || res.Response != nil {
+		t.Errorf("notification result = %+v", res)
+	}
+	if e := rec.Store().Entry(res.EntryID); e == nil || e.MsgType != "notification" || !e.Injected {
+		t.Errorf("notification entry = %+v", e)
+	}
+
+	for _, body := range []string{`{"params":{}}`, `{"method":"x","params":1}`, `not json`} {
+		if w, _ := post(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestComposeUnavailableWhenReadOnly(t *testing.T) {
+	d := New("127.0.0.1:0", NewRecorder(), ReadOnly(), WithInjector(func(context.Context, []byte) ([]byte, error) { return nil, nil }))
+	w := httptest.NewRecorder()
+	d.srv.Handler.ServeHTTP(w, apiRequest(d, http.MethodPost, "/api/compose", strings.NewReader(`{"method":"x"}`)))
+	if w.Code == http.StatusOK {
+		t.Fatal("read-only UI accepted a composed message")
+	}
+}
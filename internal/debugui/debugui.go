@@ -14,9 +14,8 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(_ *http.Request) bool { return true },
-}
+// upgrader refuses websockets opened from other origins, as does protect.
+var upgrader = websocket.Upgrader{}
 
 // Hub manages websocket clients and broadcasts entries to them.
 type Hub struct {
@@ -74,14 +73,48 @@ type DebugUI struct {
 	hub      *Hub
 	stats    *Stats
 	srv      *http.Server
+	readOnly bool
+	metrics  http.Handler
+	inject   Injector
+
+	token       string
+	allowRemote bool
+
+	addrMu sync.Mutex
+	addr   net.Addr
+}
+
+// Option configures a DebugUI.
+type Option func(*DebugUI)
+
+// ReadOnly serves the captured data without the endpoints that clear it, and
+// without sampling runtime stats. It is used to view saved traces, where the
+// runtime is not that of the traced server.
+func ReadOnly() Option {
+	return func(d *DebugUI) {
+		d.readOnly = true
+	}
+}
+
+// WithMetrics serves h, an OpenMetrics handler, at /metrics.
+func WithMetrics(h http.Handler) Option {
+	return func(d *DebugUI) {
+		d.metrics = h
+	}
 }
 
 // New creates a DebugUI bound to addr that exposes recorder's captured data.
-func New(addr string, recorder *Recorder) *DebugUI {
+// addr is a loopback host and port, such as "localhost:7100", or a Unix socket
+// path with the unix: prefix. Each DebugUI has its own token, see URL.
+func New(addr string, recorder *Recorder, opts ...Option) *DebugUI {
 	d := &DebugUI{
 		recorder: recorder,
 		hub:      newHub(),
 		stats:    NewStats(recorder.Store()),
+		token:    newToken(),
+	}
+	for _, opt := range opts {
+		opt(d)
 	}
 
 	recorder.Store().Subscribe(func(e Entry) {
@@ -90,22 +123,39 @@ func New(addr string, recorder *Recorder) *DebugUI {
 	recorder.LogStore().Subscribe(func(e LogEntry) {
 		d.hub.Broadcast(wsMessage{Kind: "log", Data: e})
 	})
+	recorder.AlertStore().Subscribe(func(a Alert) {
+		d.hub.Broadcast(wsMessage{Kind: "alert", Data: a})
+	})
 
 	mux := http.NewServeMux()
 	mux.Handle("GET /", http.FileServerFS(staticFiles()))
 	mux.HandleFunc("GET /ws", d.handleWS)
 	mux.HandleFunc("GET /api/messages", d.handleMessages)
-	mux.HandleFunc("DELETE /api/messages", d.handleMessagesClear)
 	mux.HandleFunc("GET /api/messages/search", d.handleSearch)
 	mux.HandleFunc("GET /api/logs", d.handleLogs)
-	mux.HandleFunc("DELETE /api/logs", d.handleLogsClear)
 	mux.HandleFunc("GET /api/logs/search", d.handleLogSearch)
+	mux.HandleFunc("GET /api/alerts", d.handleAlerts)
+	if !d.readOnly {
+		mux.HandleFunc("DELETE /api/messages", d.handleMessagesClear)
+		mux.HandleFunc("DELETE /api/logs", d.handleLogsClear)
+		mux.HandleFunc("DELETE /api/alerts", d.handleAlertsClear)
+	}
 	mux.HandleFunc("GET /api/stats", d.handleStats)
 	mux.HandleFunc("GET /api/capabilities", d.handleCapabilities)
+	mux.HandleFunc("GET /api/documents", d.handleDocuments)
+	mux.HandleFunc("GET /api/documents/timeline", d.handleDocumentTimeline)
+	mux.HandleFunc("GET /api/documents/text", d.handleDocumentText)
+	if d.inject != nil && !d.readOnly {
+		mux.HandleFunc("GET /api/compose/methods", d.handleComposeMethods)
+		mux.HandleFunc("POST /api/compose", d.handleCompose)
+	}
+	if d.metrics != nil {
+		mux.Handle("GET /metrics", d.metrics)
+	}
 
 	d.srv = &http.Server{
 		Addr:              addr,
-		Handler:           mux,
+		Handler:           d.protect(mux),
 		ReadHeaderTimeout: 10 * time.Second,
 	}
 
@@ -113,15 +163,22 @@ func New(addr string, recorder *Recorder) *DebugUI {
 }
 
 // ListenAndServe binds the port synchronously, then serves in the background.
-// Returns an error if the port cannot be bound. The server shuts down when ctx is cancelled.
+// Returns an error if the port cannot be bound, or ErrRemoteAddr if it is not
+// loopback. The server shuts down when ctx is cancelled.
 func (d *DebugUI) ListenAndServe(ctx context.Context) error {
-	ln, err := net.Listen("tcp", d.srv.Addr)
+	ln, err := d.listen(d.srv.Addr)
 	if err != nil {
 		return err
 	}
 
+	d.addrMu.Lock()
+	d.addr = ln.Addr()
+	d.addrMu.Unlock()
+
 	stop := make(chan struct{})
-	d.stats.StartPolling(stop)
+	if !d.readOnly {
+		d.stats.StartPolling(stop)
+	}
 
 	go func() {
 		<-ctx.Done()
@@ -131,7 +188,11 @@ func (d *DebugUI) ListenAndServe(ctx context.Context) error {
 		_ = d.srv.Shutdown(shutCtx)
 	}()
 
-	log.Printf("debugui: listening on http://%s", ln.Addr())
+	if ln.Addr().Network() == "unix" {
+		log.Printf("debugui: listening on unix socket %s, open %s", ln.Addr(), d.URL())
+	} else {
+		log.Printf("debugui: listening on %s", d.URL())
+	}
 
 	go func() {
 		if err := d.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
@@ -142,6 +203,14 @@ func (d *DebugUI) ListenAndServe(ctx context.Context) error {
 	return nil
 }
 
+// Addr returns the address the UI is listening on, or nil before
+// ListenAndServe has bound it.
+func (d *DebugUI) Addr() net.Addr {
+	d.addrMu.Lock()
+	defer d.addrMu.Unlock()
+	return d.addr
+}
+
 func (d *DebugUI) handleWS(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -270,6 +339,36 @@ func (d *DebugUI) handleCapabilities(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write(data)
 }
 
+func (d *DebugUI) handleDocuments(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(d.recorder.Documents())
+}
+
+func (d *DebugUI) handleDocumentTimeline(w http.ResponseWriter, r *http.Request) {
+	tl, ok := d.recorder.DocumentTimeline(r.URL.Query().Get("uri"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tl)
+}
+
+func (d *DebugUI) handleDocumentText(w http.ResponseWriter, r *http.Request) {
+	entry, err := strconv.Atoi(r.URL.Query().Get("entry"))
+	if err != nil {
+		http.Error(w, "entry must be a message ID", http.StatusBadRequest)
+		return
+	}
+	text, ok := d.recorder.DocumentText(r.URL.Query().Get("uri"), entry)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(text))
+}
+
 // staticFiles returns the filesystem for the embedded static files.
 func staticFiles() fs.FS {
 	sub, err := fs.Sub(staticFS, "static")
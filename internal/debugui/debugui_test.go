@@ -0,0 +1,55 @@
+package debugui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadOnlyServesWithoutClearing(t *testing.T) {
+	rec := NewRecorder()
+	rec.Store().Add(DirectionClientToServer, []byte(`{"jsonrpc":"2.0","method":"initialized"}`))
+
+	for _, tt := range []struct {
+		opts       []Option
+		wantDelete int
+	}{
+		{opts: nil, wantDelete: http.StatusNoContent},
+		{opts: []Option{ReadOnly()}, wantDelete: http.StatusMethodNotAllowed},
+	} {
+		d := New("127.0.0.1:0", rec, tt.opts...)
+
+		w := httptest.NewRecorder()
+		d.srv.Handler.ServeHTTP(w, apiRequest(d, http.MethodGet, "/api/logs", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET status = %d", w.Code)
+		}
+
+		w = httptest.NewRecorder()
+		d.srv.Handler.ServeHTTP(w, apiRequest(d, http.MethodDelete, "/api/logs", nil))
+		if w.Code != tt.wantDelete {
+			t.Fatalf("read-only %v: DELETE status = %d, want %d", tt.opts != nil, w.Code, tt.wantDelete)
+		}
+	}
+}
+
+func TestWithMetricsServesMetrics(t *testing.T) {
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("# EOF\n"))
+	})
+
+	for _, tt := range []struct {
+		opts []Option
+		want int
+	}{
+		{opts: nil, want: http.StatusNotFound},
+		{opts: []Option{WithMetrics(metrics)}, want: http.StatusOK},
+	} {
+		d := New("127.0.0.1:0", NewRecorder(), tt.opts...)
+		w := httptest.NewRecorder()
+		d.srv.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if w.Code != tt.want {
+			t.Fatalf("metrics %v: GET /metrics status = %d, want %d", tt.opts != nil, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,537 @@
+package debugui
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/owenrumney/go-lsp/document"
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// DocumentSummary describes a document that appears in the captured traffic.
+type DocumentSummary struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Versions   int    `json:"versions"`
+	Open       bool   `json:"open"`
+}
+
+// DocumentTimeline is the history of one document, reconstructed from the
+// didOpen, didChange, and didClose notifications the client sent.
+type DocumentTimeline struct {
+	URI      string            `json:"uri"`
+	Versions []DocumentVersion `json:"versions"`
+}
+
+// DocumentVersion is one step in a document's timeline, with what the server
+// returned for the document while it was at that step.
+type DocumentVersion struct {
+	EntryID   int       `json:"entryId"`
+	Timestamp time.Time `json:"timestamp"`
+	// Event is "open", "change", or "close".
+	Event   string `json:"event"`
+	Version int    `json:"version"`
+	// Diff is the change from the previous version, for change events.
+	Diff []DiffLine `json:"diff,omitempty"`
+	// Error is set when the change could not be applied, such as when it
+	// refers to a range outside the document. The text is left unchanged.
+	Error string `json:"error,omitempty"`
+
+	Diagnostics    *TimelineDiagnostics `json:"diagnostics,omitempty"`
+	Hovers         []TimelineHover      `json:"hovers,omitempty"`
+	SemanticTokens *TimelineTokens      `json:"semanticTokens,omitempty"`
+}
+
+// DiffLine is a line of a diff. Op is " " for an unchanged line, "-" for a
+// removed one, and "+" for an added one. Old and New are the zero-based line
+// numbers in the previous and new text, or -1 when the line is not in it.
+type DiffLine struct {
+	Op   string `json:"op"`
+	Old  int    `json:"old"`
+	New  int    `json:"new"`
+	Text string `json:"text"`
+}
+
+// TimelineDiagnostics are the latest diagnostics published or pulled for a
+// version.
+type TimelineDiagnostics struct {
+	EntryID     int              `json:"entryId"`
+	Diagnostics []lsp.Diagnostic `json:"diagnostics"`
+}
+
+// TimelineHover is a hover the server returned for a version.
+type TimelineHover struct {
+	EntryID  int          `json:"entryId"`
+	Position lsp.Position `json:"position"`
+	Range    *lsp.Range   `json:"range,omitempty"`
+	Contents string       `json:"contents"`
+}
+
+// TimelineTokens are the latest semantic tokens returned for a version,
+// decoded with the legend the server advertised.
+type TimelineTokens struct {
+	EntryID int             `json:"entryId"`
+	Tokens  []SemanticToken `json:"tokens"`
+}
+
+// SemanticToken is a decoded semantic token. Type is "#n" when the legend
+// does not name token type n.
+type SemanticToken struct {
+	Line      int      `json:"line"`
+	Character int      `json:"character"`
+	Length    int      `json:"length"`
+	Type      string   `json:"type"`
+	Modifiers []string `json:"modifiers,omitempty"`
+}
+
+// diffContext is the number of unchanged lines kept around each change in a
+// DocumentVersion's diff.
+const diffContext = 3
+
+// docReplay replays captured messages through a document.Store to rebuild
+// each document's timeline.
+type docReplay struct {
+	legend    lsp.SemanticTokensLegend
+	docs      *document.Store
+	timelines map[string]*DocumentTimeline
+	order     []string
+	languages map[string]string
+	// requests maps the entry ID of a request about a document to the
+	// document and the index of its version when the request was sent.
+	requests map[int]versionRef
+	methods  map[int]string
+	// hovers is the position of each hover request, by entry ID.
+	hovers map[int]lsp.Position
+	// tokens is the last semantic tokens data per document, for applying
+	// delta results.
+	tokens map[string][]int
+
+	// want names a version whose text to keep in text.
+	want versionRef
+	text *string
+}
+
+type versionRef struct {
+	uri   string
+	index int
+	entry int
+}
+
+// replayDocuments rebuilds document timelines from entries. If wantURI is
+// not empty, the text of that document at the version created by entry
+// wantEntry is kept.
+func replayDocuments(entries []Entry, capabilities json.RawMessage, wantURI string, wantEntry int) *docReplay {
+	r := &docReplay{
+		docs:      document.NewStore(),
+		timelines: make(map[string]*DocumentTimeline),
+		languages: make(map[string]string),
+		requests:  make(map[int]versionRef),
+		methods:   make(map[int]string),
+		hovers:    make(map[int]lsp.Position),
+		tokens:    make(map[string][]int),
+		want:      versionRef{uri: wantURI, entry: wantEntry},
+	}
+	var caps struct {
+		SemanticTokensProvider *struct {
+			Legend lsp.SemanticTokensLegend `json:"legend"`
+		} `json:"semanticTokensProvider"`
+	}
+	if json.Unmarshal(capabilities, &caps) == nil && caps.SemanticTokensProvider != nil {
+		r.legend = caps.SemanticTokensProvider.Legend
+	}
+
+	for _, e := range entries {
+		r.add(e)
+	}
+	return r
+}
+
+func (r *docReplay) add(e Entry) {
+	var msg struct {
+		Params json.RawMessage `json:"params"`
+		Result json.RawMessage `json:"result"`
+	}
+	if json.Unmarshal(e.Body, &msg) != nil {
+		return
+	}
+
+	switch {
+	case e.Direction == DirectionClientToServer && e.MsgType == "notification":
+		switch e.Method {
+		case "textDocument/didOpen":
+			var p lsp.DidOpenTextDocumentParams
+			if json.Unmarshal(msg.Params, &p) == nil {
+				r.open(e, &p)
+			}
+		case "textDocument/didChange":
+			var p lsp.DidChangeTextDocumentParams
+			if json.Unmarshal(msg.Params, &p) == nil {
+				r.change(e, &p)
+			}
+		case "textDocument/didClose":
+			var p lsp.DidCloseTextDocumentParams
+			if json.Unmarshal(msg.Params, &p) == nil {
+				r.close(e, &p)
+			}
+		}
+
+	case e.Direction == DirectionClientToServer && e.MsgType == "request":
+		var p struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if json.Unmarshal(msg.Params, &p) != nil {
+			return
+		}
+		if ref, ok := r.current(p.TextDocument.URI); ok {
+			ref.entry = e.ID
+			r.requests[e.ID] = ref
+			r.methods[e.ID] = e.Method
+			var hover lsp.HoverParams
+			if e.Method == "textDocument/hover" && json.Unmarshal(msg.Params, &hover) == nil {
+				r.hovers[e.ID] = hover.Position
+			}
+		}
+
+	case e.Direction == DirectionServerToClient && e.MsgType == "notification" && e.Method == "textDocument/publishDiagnostics":
+		var p lsp.PublishDiagnosticsParams
+		if json.Unmarshal(msg.Params, &p) != nil {
+			return
+		}
+		ref, ok := r.current(string(p.URI))
+		if p.Version != nil {
+			ref, ok = r.version(string(p.URI), *p.Version)
+		}
+		if ok {
+			r.at(ref).Diagnostics = &TimelineDiagnostics{EntryID: e.ID, Diagnostics: p.Diagnostics}
+		}
+
+	case e.Direction == DirectionServerToClient && e.MsgType == "response":
+		ref, ok := r.requests[e.PairedWith]
+		if !ok || len(msg.Result) == 0 || string(msg.Result) == "null" {
+			return
+		}
+		r.response(e, ref, r.methods[e.PairedWith], msg.Result)
+	}
+}
+
+func (r *docReplay) open(e Entry, p *lsp.DidOpenTextDocumentParams) {
+	uri := string(p.TextDocument.URI)
+	doc, _ := r.docs.Open(p)
+	r.languages[uri] = p.TextDocument.LanguageID
+	delete(r.tokens, uri)
+	r.addVersion(uri, DocumentVersion{EntryID: e.ID, Timestamp: e.Timestamp, Event: "open", Version: p.TextDocument.Version}, doc.Text())
+}
+
+func (r *docReplay) change(e Entry, p *lsp.DidChangeTextDocumentParams) {
+	uri := string(p.TextDocument.URI)
+	before, ok := r.docs.Text(p.TextDocument.URI)
+	if !ok {
+		return
+	}
+	v := DocumentVersion{EntryID: e.ID, Timestamp: e.Timestamp, Event: "change", Version: p.TextDocument.Version}
+	after := before
+	if doc, err := r.docs.Change(p); err != nil {
+		v.Error = err.Error()
+		// A failed change may have applied some of its edits; keep the
+		// timeline on the last good text.
+		r.docs.Close(&lsp.DidCloseTextDocumentParams{TextDocument: lsp.TextDocumentIdentifier{URI: p.TextDocument.URI}})
+		_, _ = r.docs.Open(&lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{
+			URI: p.TextDocument.URI, LanguageID: r.languages[uri], Version: p.TextDocument.Version, Text: before,
+		}})
+	} else {
+		after = doc.Text()
+		v.Diff = lineDiff(before, after, diffContext)
+	}
+	r.addVersion(uri, v, after)
+}
+
+func (r *docReplay) close(e Entry, p *lsp.DidCloseTextDocumentParams) {
+	uri := string(p.TextDocument.URI)
+	text, ok := r.docs.Text(p.TextDocument.URI)
+	if !ok {
+		return
+	}
+	version, _ := r.docs.Version(p.TextDocument.URI)
+	r.docs.Close(p)
+	delete(r.tokens, uri)
+	r.addVersion(uri, DocumentVersion{EntryID: e.ID, Timestamp: e.Timestamp, Event: "close", Version: version}, text)
+}
+
+func (r *docReplay) addVersion(uri string, v DocumentVersion, text string) {
+	tl, ok := r.timelines[uri]
+	if !ok {
+		tl = &DocumentTimeline{URI: uri}
+		r.timelines[uri] = tl
+		r.order = append(r.order, uri)
+	}
+	tl.Versions = append(tl.Versions, v)
+	if uri == r.want.uri && v.EntryID == r.want.entry {
+		r.text = &text
+	}
+}
+
+// current returns the latest version of uri.
+func (r *docReplay) current(uri string) (versionRef, bool) {
+	tl, ok := r.timelines[uri]
+	if !ok {
+		return versionRef{}, false
+	}
+	return versionRef{uri: uri, index: len(tl.Versions) - 1}, true
+}
+
+// version returns the latest open or change step of uri with the given
+// version number.
+func (r *docReplay) version(uri string, version int) (versionRef, bool) {
+	tl, ok := r.timelines[uri]
+	if !ok {
+		return versionRef{}, false
+	}
+	for i := len(tl.Versions) - 1; i >= 0; i-- {
+		if v := tl.Versions[i]; v.Version == version && v.Event != "close" {
+			return versionRef{uri: uri, index: i}, true
+		}
+	}
+	return versionRef{}, false
+}
+
+func (r *docReplay) at(ref versionRef) *DocumentVersion {
+	return &r.timelines[ref.uri].Versions[ref.index]
+}
+
+func (r *docReplay) response(e Entry, ref versionRef, method string, result json.RawMessage) {
+	v := r.at(ref)
+	switch method {
+	case "textDocument/hover":
+		var h struct {
+			Contents json.RawMessage `json:"contents"`
+			Range    *lsp.Range      `json:"range"`
+		}
+		if json.Unmarshal(result, &h) == nil {
+			v.Hovers = append(v.Hovers, TimelineHover{EntryID: ref.entry, Position: r.hovers[ref.entry], Range: h.Range, Contents: hoverText(h.Contents)})
+		}
+
+	case "textDocument/diagnostic":
+		var report struct {
+			Kind  string           `json:"kind"`
+			Items []lsp.Diagnostic `json:"items"`
+		}
+		if json.Unmarshal(result, &report) == nil && report.Kind == "full" {
+			v.Diagnostics = &TimelineDiagnostics{EntryID: e.ID, Diagnostics: report.Items}
+		}
+
+	case "textDocument/semanticTokens/full", "textDocument/semanticTokens/range", "textDocument/semanticTokens/full/delta":
+		var tokens struct {
+			Data  []int                    `json:"data"`
+			Edits []lsp.SemanticTokensEdit `json:"edits"`
+		}
+		if json.Unmarshal(result, &tokens) != nil {
+			return
+		}
+		data := tokens.Data
+		if tokens.Data == nil && tokens.Edits != nil {
+			data = applyTokenEdits(r.tokens[ref.uri], tokens.Edits)
+		}
+		if method != "textDocument/semanticTokens/range" {
+			r.tokens[ref.uri] = data
+		}
+		v.SemanticTokens = &TimelineTokens{EntryID: e.ID, Tokens: decodeTokens(data, r.legend)}
+	}
+}
+
+// Documents lists the documents in the captured traffic, in the order they
+// were first opened.
+func (r *Recorder) Documents() []DocumentSummary {
+	replay := replayDocuments(r.store.All(), r.capabilitiesSnapshot(), "", 0)
+	summaries := make([]DocumentSummary, 0, len(replay.order))
+	for _, uri := range replay.order {
+		_, open := replay.docs.Get(lsp.DocumentURI(uri))
+		summaries = append(summaries, DocumentSummary{
+			URI:        uri,
+			LanguageID: replay.languages[uri],
+			Versions:   len(replay.timelines[uri].Versions),
+			Open:       open,
+		})
+	}
+	return summaries
+}
+
+// DocumentTimeline returns the timeline of the document uri.
+func (r *Recorder) DocumentTimeline(uri string) (*DocumentTimeline, bool) {
+	tl, ok := replayDocuments(r.store.All(), r.capabilitiesSnapshot(), "", 0).timelines[uri]
+	return tl, ok
+}
+
+// DocumentText returns the text of the document uri at the version created
+// by the message with the given entry ID.
+func (r *Recorder) DocumentText(uri string, entryID int) (string, bool) {
+	replay := replayDocuments(r.store.All(), r.capabilitiesSnapshot(), uri, entryID)
+	if replay.text == nil {
+		return "", false
+	}
+	return *replay.text, true
+}
+
+// hoverText returns the text of hover contents in any of the forms the
+// protocol allows: MarkupContent, a MarkedString, or an array of them.
+func hoverText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var marked struct {
+		Value string `json:"value"`
+	}
+	if json.Unmarshal(raw, &marked) == nil && marked.Value != "" {
+		return marked.Value
+	}
+	var parts []json.RawMessage
+	if json.Unmarshal(raw, &parts) == nil {
+		texts := make([]string, 0, len(parts))
+		for _, part := range parts {
+			texts = append(texts, hoverText(part))
+		}
+		return strings.Join(texts, "\n\n")
+	}
+	return ""
+}
+
+// applyTokenEdits applies semantic token delta edits to data, in reverse
+// order so earlier offsets stay valid. Edits out of range are dropped.
+func applyTokenEdits(data []int, edits []lsp.SemanticTokensEdit) []int {
+	out := append([]int(nil), data...)
+	for i := len(edits) - 1; i >= 0; i-- {
+		edit := edits[i]
+		if edit.Start < 0 || edit.DeleteCount < 0 || edit.Start+edit.DeleteCount > len(out) {
+			continue
+		}
+		out = append(out[:edit.Start], append(append([]int(nil), edit.Data...), out[edit.Start+edit.DeleteCount:]...)...)
+	}
+	return out
+}
+
+// decodeTokens decodes the relative encoding of semantic tokens data.
+func decodeTokens(data []int, legend lsp.SemanticTokensLegend) []SemanticToken {
+	tokens := make([]SemanticToken, 0, len(data)/5)
+	line, char := 0, 0
+	for i := 0; i+5 <= len(data); i += 5 {
+		if data[i] > 0 {
+			line += data[i]
+			char = data[i+1]
+		} else {
+			char += data[i+1]
+		}
+		t := SemanticToken{Line: line, Character: char, Length: data[i+2], Type: "#" + strconv.Itoa(data[i+3])}
+		if n := data[i+3]; n >= 0 && n < len(legend.TokenTypes) {
+			t.Type = legend.TokenTypes[n]
+		}
+		for bit := 0; bit < len(legend.TokenModifiers) && bit < 31; bit++ {
+			if data[i+4]&(1<<bit) != 0 {
+				t.Modifiers = append(t.Modifiers, legend.TokenModifiers[bit])
+			}
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// maxDiffCells bounds the size of the table used to diff the changed region
+// of a document. Larger changes are shown as the old lines replaced by the
+// new ones.
+const maxDiffCells = 1 << 20
+
+// lineDiff returns the lines of a line diff from a to b, keeping up to
+// context unchanged lines around each change.
+func lineDiff(a, b string, context int) []DiffLine {
+	al, bl := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	prefix := 0
+	for prefix < len(al) && prefix < len(bl) && al[prefix] == bl[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(al)-prefix && suffix < len(bl)-prefix && al[len(al)-1-suffix] == bl[len(bl)-1-suffix] {
+		suffix++
+	}
+	if prefix == len(al) && prefix == len(bl) {
+		return nil
+	}
+
+	var lines []DiffLine
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, DiffLine{Op: " ", Old: i, New: i, Text: al[i]})
+	}
+	lines = append(lines, diffMiddle(al[prefix:len(al)-suffix], bl[prefix:len(bl)-suffix], prefix)...)
+	for i := suffix; i > 0; i-- {
+		lines = append(lines, DiffLine{Op: " ", Old: len(al) - i, New: len(bl) - i, Text: al[len(al)-i]})
+	}
+
+	// Keep changes and the unchanged lines near them.
+	keep := make([]bool, len(lines))
+	for i, l := range lines {
+		if l.Op == " " {
+			continue
+		}
+		for j := max(0, i-context); j <= min(len(lines)-1, i+context); j++ {
+			keep[j] = true
+		}
+	}
+	kept := lines[:0]
+	for i, l := range lines {
+		if keep[i] {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+// diffMiddle diffs the lines between a common prefix of length offset and a
+// common suffix, using a longest common subsequence table.
+func diffMiddle(a, b []string, offset int) []DiffLine {
+	var lines []DiffLine
+	if len(a)*len(b) > maxDiffCells {
+		for i, s := range a {
+			lines = append(lines, DiffLine{Op: "-", Old: offset + i, New: -1, Text: s})
+		}
+		for i, s := range b {
+			lines = append(lines, DiffLine{Op: "+", Old: -1, New: offset + i, Text: s})
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, DiffLine{Op: " ", Old: offset + i, New: offset + j, Text: a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, DiffLine{Op: "-", Old: offset + i, New: -1, Text: a[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: "+", Old: -1, New: offset + j, Text: b[j]})
+			j++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,135 @@
+package debugui
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestDocumentTimeline(t *testing.T) {
+	rec := NewRecorder()
+	rec.SetCapabilities(map[string]any{"semanticTokensProvider": map[string]any{
+		"legend": map[string]any{"tokenTypes": []string{"keyword", "variable"}, "tokenModifiers": []string{"readonly"}},
+		"full":   map[string]any{"delta": true},
+	}})
+
+	client := func(body string) { rec.Store().Add(DirectionClientToServer, []byte(body)) }
+	server := func(body string) { rec.Store().Add(DirectionServerToClient, []byte(body)) }
+
+	client(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.txt","languageId":"plaintext","version":1,"text":"let x\nlet y\n"}}}`)
+	server(`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///a.txt","version":1,"diagnostics":[{"range":{"start":{"line":0,"character":4},"end":{"line":0,"character":5}},"message":"unused x"}]}}`)
+	client(`{"jsonrpc":"2.0","id":1,"method":"textDocument/semanticTokens/full","params":{"textDocument":{"uri":"file:///a.txt"}}}`)
+	server(`{"jsonrpc":"2.0","id":1,"result":{"resultId":"1","data":[0,0,3,0,0,0,4,1,1,1]}}`)
+	client(`{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":"file:///a.txt","version":2},"contentChanges":[{"range":{"start":{"line":0,"character":4},"end":{"line":0,"character":5}},"text":"z"}]}}`)
+	client(`{"jsonrpc":"2.0","id":2,"method":"textDocument/hover","params":{"textDocument":{"uri":"file:///a.txt"},"position":{"line":0,"character":4}}}`)
+	// Diagnostics for version 1 arriving late stay on version 1.
+	server(`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///a.txt","version":1,"diagnostics":[]}}`)
+	server(`{"jsonrpc":"2.0","id":2,"result":{"contents":{"kind":"markdown","value":"**z**"}}}`)
+	client(`{"jsonrpc":"2.0","id":3,"method":"textDocument/semanticTokens/full/delta","params":{"textDocument":{"uri":"file:///a.txt"},"previousResultId":"1"}}`)
+	server(`{"jsonrpc":"2.0","id":3,"result":{"edits":[{"start":9,"deleteCount":1,"data":[0]}]}}`)
+	client(`{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":"file:///a.txt","version":3},"contentChanges":[{"range":{"start":{"line":9,"character":0},"end":{"line":9,"character":0}},"text":"bad"}]}}`)
+	client(`{"jsonrpc":"2.0","method":"textDocument/didClose","params":{"textDocument":{"uri":"file:///a.txt"}}}`)
+
+	tl, ok := rec.DocumentTimeline("file:///a.txt")
+	if !ok {
+		t.Fatal("no timeline")
+	}
+	var events []string
+	for _, v := range tl.Versions {
+		events = append(events, v.Event)
+	}
+	if !reflect.DeepEqual(events, []string{"open", "change", "change", "close"}) {
+		t.Fatalf("events = %q", events)
+	}
+	open, edit, bad, closed := tl.Versions[0], tl.Versions[1], tl.Versions[2], tl.Versions[3]
+
+	if open.Diagnostics == nil || len(open.Diagnostics.Diagnostics) != 0 || open.Diagnostics.EntryID != 6 {
+		t.Errorf("open diagnostics = %+v, want the late empty publish", open.Diagnostics)
+	}
+	wantTokens := []SemanticToken{
+		{Line: 0, Character: 0, Length: 3, Type: "keyword"},
+		{Line: 0, Character: 4, Length: 1, Type: "variable", Modifiers: []string{"readonly"}},
+	}
+	if open.SemanticTokens == nil || !reflect.DeepEqual(open.SemanticTokens.Tokens, wantTokens) {
+		t.Errorf("open tokens = %+v", open.SemanticTokens)
+	}
+
+	wantDiff := []DiffLine{
+		{Op: "-", Old: 0, New: -1, Text: "let x"},
+		{Op: "+", Old: -1, New: 0, Text: "let z"},
+		{Op: " ", Old: 1, New: 1, Text: "let y"},
+		{Op: " ", Old: 2, New: 2, Text: ""},
+	}
+	if !reflect.DeepEqual(edit.Diff, wantDiff) {
+		t.Errorf("diff = %+v", edit.Diff)
+	}
+	if len(edit.Hovers) != 1 || edit.Hovers[0].Contents != "**z**" || edit.Hovers[0].Position.Character != 4 || edit.Hovers[0].EntryID != 5 {
+		t.Errorf("hovers = %+v", edit.Hovers)
+	}
+	if edit.SemanticTokens == nil || edit.SemanticTokens.Tokens[1].Modifiers != nil {
+		t.Errorf("tokens after delta = %+v", edit.SemanticTokens)
+	}
+
+	if bad.Error == "" || bad.Diff != nil {
+		t.Errorf("bad change = %+v, want an error", bad)
+	}
+	if text, _ := rec.DocumentText("file:///a.txt", bad.EntryID); text != "let z\nlet y\n" {
+		t.Errorf("text after bad change = %q, want the previous text", text)
+	}
+	if text, _ := rec.DocumentText("file:///a.txt", open.EntryID); text != "let x\nlet y\n" {
+		t.Errorf("text at open = %q", text)
+	}
+	if closed.Version != 3 {
+		t.Errorf("close = %+v", closed)
+	}
+
+	docs := rec.Documents()
+	if len(docs) != 1 || docs[0].Versions != 4 || docs[0].Open || docs[0].LanguageID != "plaintext" {
+		t.Errorf("documents = %+v", docs)
+	}
+}
+
+func TestDocumentEndpoints(t *testing.T) {
+	rec := NewRecorder()
+	rec.Store().Add(DirectionClientToServer, []byte(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.txt","languageId":"plaintext","version":1,"text":"hi"}}}`))
+	d := New("127.0.0.1:0", rec)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		d.srv.Handler.ServeHTTP(w, apiRequest(d, http.MethodGet, path, nil))
+		return w
+	}
+
+	var docs []DocumentSummary
+	if err := json.Unmarshal(get("/api/documents").Body.Bytes(), &docs); err != nil || len(docs) != 1 || !docs[0].Open {
+		t.Fatalf("documents = %+v, %v", docs, err)
+	}
+	uri := url.QueryEscape("file:///a.txt")
+	if w := get("/api/documents/timeline?uri=" + uri); w.Code != http.StatusOK {
+		t.Fatalf("timeline status = %d", w.Code)
+	}
+	if w := get("/api/documents/text?uri=" + uri + "&entry=0"); w.Body.String() != "hi" {
+		t.Fatalf("text = %q", w.Body.String())
+	}
+	if w := get("/api/documents/timeline?uri=file:///missing"); w.Code != http.StatusNotFound {
+		t.Fatalf("missing timeline status = %d", w.Code)
+	}
+}
+
+func TestLineDiffKeepsContext(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9"
+	b := "1\n2\n3\n4\nfive\n6\n7\n8\n9"
+	var got []string
+	for _, l := range lineDiff(a, b, 1) {
+		got = append(got, l.Op+l.Text)
+	}
+	if !reflect.DeepEqual(got, []string{" 4", "-5", "+five", " 6"}) {
+		t.Fatalf("diff = %q", got)
+	}
+	if lineDiff(a, a, 3) != nil {
+		t.Fatal("expected no diff for equal text")
+	}
+}
@@ -2,7 +2,10 @@ package debugui
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log/slog"
+	"math"
 	"sort"
 	"strings"
 	"sync"
@@ -17,6 +20,13 @@ type LogEntry struct {
 	Timestamp time.Time `json:"timestamp"`
 	Level     string    `json:"level"` // "error", "warning", "info", "debug"
 	Message   string    `json:"message"`
+	// Attrs holds the record's attributes as a JSON object, with groups as
+	// nested objects.
+	Attrs json.RawMessage `json:"attrs,omitempty"`
+	// RPCID and Method identify the message the server was handling when the
+	// entry was logged. RPCID is empty for a notification.
+	RPCID  string `json:"rpcId,omitempty"`
+	Method string `json:"method,omitempty"`
 }
 
 // LogSubscriber receives new log entries.
@@ -46,10 +56,14 @@ func (s *LogStore) Subscribe(fn LogSubscriber) {
 
 // Add stores a log entry and notifies subscribers.
 func (s *LogStore) Add(level, message string) {
-	e := LogEntry{
-		Timestamp: time.Now(),
-		Level:     level,
-		Message:   message,
+	s.AddEntry(LogEntry{Level: level, Message: message})
+}
+
+// AddEntry stores e with the next ID, and the current time if it has none,
+// and notifies subscribers.
+func (s *LogStore) AddEntry(e LogEntry) {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
 	}
 
 	s.mu.Lock()
@@ -72,6 +86,21 @@ func (s *LogStore) Add(level, message string) {
 	}
 }
 
+// Load replaces the stored log entries with entries, keeping their IDs and
+// timestamps. Subscribers are not notified.
+func (s *LogStore) Load(entries []LogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(entries) > maxLogEntries {
+		entries = entries[len(entries)-maxLogEntries:]
+	}
+	s.entries = append(make([]LogEntry, 0, len(entries)), entries...)
+	s.nextID = 0
+	if n := len(entries); n > 0 {
+		s.nextID = entries[n-1].ID + 1
+	}
+}
+
 // Clear removes all log entries.
 func (s *LogStore) Clear() {
 	s.mu.Lock()
@@ -106,7 +135,8 @@ func (s *LogStore) All() []LogEntry {
 	return result
 }
 
-// Search returns log entries where the message contains the query substring.
+// Search returns log entries where the message, level, attributes, or method
+// contains the query substring.
 func (s *LogStore) Search(query string) []LogEntry {
 	query = strings.ToLower(query)
 	s.mu.RLock()
@@ -115,18 +145,42 @@ func (s *LogStore) Search(query string) []LogEntry {
 	var result []LogEntry
 	for _, e := range s.entries {
 		if strings.Contains(strings.ToLower(e.Message), query) ||
-			strings.Contains(strings.ToLower(e.Level), query) {
+			strings.Contains(strings.ToLower(e.Level), query) ||
+			strings.Contains(strings.ToLower(string(e.Attrs)), query) ||
+			strings.Contains(strings.ToLower(e.Method), query) {
 			result = append(result, e)
 		}
 	}
 	return result
 }
 
-// SlogHandler is a slog.Handler that sends log records to a LogStore.
+type requestKey struct{}
+
+type requestInfo struct {
+	rpcID, method string
+}
+
+// ContextWithRequest returns a context that tags the records a SlogHandler
+// handles with it with the RPC ID and method of the message being handled.
+// rpcID is empty for a notification.
+func ContextWithRequest(ctx context.Context, rpcID, method string) context.Context {
+	return context.WithValue(ctx, requestKey{}, requestInfo{rpcID: rpcID, method: method})
+}
+
+// SlogHandler is a slog.Handler that sends log records to a LogStore. It keeps
+// their attributes as JSON, and tags them with the message being handled when
+// the record's context comes from ContextWithRequest.
 type SlogHandler struct {
-	store *LogStore
-	attrs []slog.Attr
-	group string
+	store  *LogStore
+	attrs  []groupedAttr
+	groups []string
+}
+
+// groupedAttr is an attribute added with WithAttrs, and the groups open when
+// it was added.
+type groupedAttr struct {
+	groups []string
+	attr   slog.Attr
 }
 
 // NewSlogHandler creates a slog.Handler that writes to the given LogStore.
@@ -138,51 +192,105 @@ func (h *SlogHandler) Enabled(_ context.Context, _ slog.Level) bool {
 	return true
 }
 
-func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
-	level := strings.ToLower(r.Level.String())
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	e := LogEntry{
+		Timestamp: r.Time,
+		Level:     strings.ToLower(r.Level.String()),
+		Message:   r.Message,
+	}
 
-	msg := r.Message
-	// Append attrs if any.
-	var parts []string
+	attrs := make(map[string]any)
 	for _, a := range h.attrs {
-		parts = append(parts, formatAttr(h.group, a))
+		addAttr(attrs, a.groups, a.attr)
 	}
 	r.Attrs(func(a slog.Attr) bool {
-		parts = append(parts, formatAttr(h.group, a))
+		addAttr(attrs, h.groups, a)
 		return true
 	})
-	if len(parts) > 0 {
-		msg += " " + strings.Join(parts, " ")
+	if len(attrs) > 0 {
+		e.Attrs, _ = json.Marshal(attrs)
+	}
+
+	if req, ok := ctx.Value(requestKey{}).(requestInfo); ok {
+		e.RPCID = req.rpcID
+		e.Method = req.method
 	}
 
-	h.store.Add(level, msg)
+	h.store.AddEntry(e)
 	return nil
 }
 
 func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return &SlogHandler{
-		store: h.store,
-		attrs: append(append([]slog.Attr{}, h.attrs...), attrs...),
-		group: h.group,
+	h2 := *h
+	h2.attrs = append([]groupedAttr(nil), h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = append(h2.attrs, groupedAttr{groups: h.groups, attr: a})
 	}
+	return &h2
 }
 
 func (h *SlogHandler) WithGroup(name string) slog.Handler {
-	prefix := name
-	if h.group != "" {
-		prefix = h.group + "." + name
+	if name == "" {
+		return h
 	}
-	return &SlogHandler{
-		store: h.store,
-		attrs: append([]slog.Attr{}, h.attrs...),
-		group: prefix,
+	h2 := *h
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &h2
+}
+
+// addAttr sets a in m, inside the nested object for each of groups.
+func addAttr(m map[string]any, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
 	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, ga := range a.Value.Group() {
+			addAttr(m, groups, ga)
+		}
+		return
+	}
+	for _, g := range groups {
+		child, ok := m[g].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			m[g] = child
+		}
+		m = child
+	}
+	m[a.Key] = attrValue(a.Value)
 }
 
-func formatAttr(group string, a slog.Attr) string {
-	key := a.Key
-	if group != "" {
-		key = group + "." + key
+// attrValue returns v as a value that encodes to JSON.
+func attrValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindString:
+		return v.String()
+	case slog.KindInt64:
+		return v.Int64()
+	case slog.KindUint64:
+		return v.Uint64()
+	case slog.KindFloat64:
+		if f := v.Float64(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f
+		}
+		return v.String()
+	case slog.KindBool:
+		return v.Bool()
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	}
+	x := v.Any()
+	if err, ok := x.(error); ok {
+		return err.Error()
+	}
+	if data, err := json.Marshal(x); err == nil {
+		return json.RawMessage(data)
 	}
-	return key + "=" + a.Value.String()
+	return fmt.Sprint(x)
 }
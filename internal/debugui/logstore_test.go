@@ -0,0 +1,70 @@
+package debugui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSlogHandlerKeepsStructuredAttrs(t *testing.T) {
+	store := NewLogStore()
+	logger := slog.New(NewSlogHandler(store)).With("server", "toy").WithGroup("doc")
+
+	logger.Info("parsed", "uri", "file:///a.txt", "took", 2*time.Millisecond,
+		slog.Group("stats", "nodes", 12, "ratio", math.NaN()), "err", errors.New("partial"),
+		slog.Group("empty"))
+
+	logs := store.All()
+	if len(logs) != 1 {
+		t.Fatalf("got %d entries, want 1", len(logs))
+	}
+	e := logs[0]
+	if e.Message != "parsed" || e.Level != "info" {
+		t.Errorf("entry = %+v, want the message without attributes", e)
+	}
+	var attrs map[string]any
+	if err := json.Unmarshal(e.Attrs, &attrs); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"server": "toy",
+		"doc": map[string]any{
+			"uri":   "file:///a.txt",
+			"took":  "2ms",
+			"err":   "partial",
+			"stats": map[string]any{"nodes": float64(12), "ratio": "NaN"},
+		},
+	}
+	if !reflect.DeepEqual(attrs, want) {
+		t.Errorf("attrs = %s", e.Attrs)
+	}
+	if len(store.Search("a.txt")) != 1 {
+		t.Error("search should match attribute values")
+	}
+}
+
+func TestSlogHandlerTagsRequest(t *testing.T) {
+	store := NewLogStore()
+	logger := slog.New(NewSlogHandler(store))
+
+	ctx := ContextWithRequest(context.Background(), "7", "textDocument/hover")
+	logger.InfoContext(ctx, "looking up symbol")
+	logger.InfoContext(ContextWithRequest(context.Background(), "", "textDocument/didOpen"), "parsing")
+	logger.Info("idle")
+
+	logs := store.All()
+	if logs[0].RPCID != "7" || logs[0].Method != "textDocument/hover" || logs[0].Attrs != nil {
+		t.Errorf("request log = %+v", logs[0])
+	}
+	if logs[1].RPCID != "" || logs[1].Method != "textDocument/didOpen" {
+		t.Errorf("notification log = %+v", logs[1])
+	}
+	if logs[2].RPCID != "" || logs[2].Method != "" {
+		t.Errorf("untagged log = %+v", logs[2])
+	}
+}
@@ -11,11 +11,13 @@ import (
 // the message Store, LogStore, and a snapshot of advertised capabilities, and
 // is the foundation that both capture-only mode and the full DebugUI build on.
 type Recorder struct {
-	store    *Store
-	logStore *LogStore
+	store      *Store
+	logStore   *LogStore
+	alertStore *AlertStore
 
 	capsMu       sync.RWMutex
 	capabilities json.RawMessage
+	stream       *TraceFile
 }
 
 // NewRecorder creates a Recorder with empty stores.
@@ -23,17 +25,33 @@ func NewRecorder() *Recorder {
 	logStore := NewLogStore()
 	store := NewStore(logStore)
 	return &Recorder{
-		store:    store,
-		logStore: logStore,
+		store:      store,
+		logStore:   logStore,
+		alertStore: NewAlertStore(),
 	}
 }
 
+// NewRecorderFromTrace creates a Recorder holding the messages, logs, and
+// capabilities of a saved trace, for viewing it offline.
+func NewRecorderFromTrace(trace *Trace) *Recorder {
+	r := NewRecorder()
+	r.store.Load(trace.Messages)
+	r.logStore.Load(trace.Logs)
+	if trace.Capabilities != nil {
+		r.capabilities = append(json.RawMessage(nil), trace.Capabilities...)
+	}
+	return r
+}
+
 // Store returns the underlying message store.
 func (r *Recorder) Store() *Store { return r.store }
 
 // LogStore returns the underlying log store.
 func (r *Recorder) LogStore() *LogStore { return r.logStore }
 
+// AlertStore returns the underlying alert store.
+func (r *Recorder) AlertStore() *AlertStore { return r.alertStore }
+
 // Tap wraps inner so all framed LSP messages flowing through it are captured.
 func (r *Recorder) Tap(inner io.ReadWriteCloser) *Tap {
 	return NewTap(inner, r.store)
@@ -53,26 +71,37 @@ func (r *Recorder) SetCapabilities(caps any) {
 	}
 	r.capsMu.Lock()
 	r.capabilities = data
+	stream := r.stream
+	r.capsMu.Unlock()
+	if stream != nil {
+		stream.WriteCapabilities(data)
+	}
+}
+
+// StreamTo writes every message and log captured from now on, and the
+// capabilities, to t. Messages already captured are not written.
+func (r *Recorder) StreamTo(t *TraceFile) {
+	r.capsMu.Lock()
+	r.stream = t
+	caps := r.capabilities
 	r.capsMu.Unlock()
+	if caps != nil {
+		t.WriteCapabilities(caps)
+	}
+	r.store.Subscribe(t.WriteEntry)
+	r.logStore.Subscribe(t.WriteLog)
 }
 
 // ExportTrace returns a JSON snapshot of captured messages, logs, and
 // capabilities, applying the requested redactions.
 func (r *Recorder) ExportTrace(opts TraceExportOptions) ([]byte, error) {
-	trace := Trace{
+	return MarshalTrace(&Trace{
 		Version:      TraceVersion,
 		CreatedAt:    time.Now().UTC(),
 		Messages:     r.store.All(),
 		Logs:         r.logStore.All(),
 		Capabilities: r.capabilitiesSnapshot(),
-	}
-
-	redactTrace(&trace, opts)
-
-	if opts.Pretty {
-		return json.MarshalIndent(trace, "", "  ")
-	}
-	return json.Marshal(trace)
+	}, opts)
 }
 
 func (r *Recorder) capabilitiesSnapshot() json.RawMessage {
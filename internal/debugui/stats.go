@@ -72,6 +72,10 @@ func NewStats(store *Store) *Stats {
 	}
 
 	store.Subscribe(s.onEntry)
+	// Count entries captured before the stats, such as a loaded trace.
+	for _, e := range store.All() {
+		s.onEntry(e)
+	}
 
 	return s
 }
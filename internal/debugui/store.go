@@ -20,8 +20,17 @@ type Entry struct {
 	RPCID      string          `json:"rpcId"`
 	Body       json.RawMessage `json:"body"`
 	PairedWith int             `json:"pairedWith"`
+	// Injected is set on messages sent from the debug UI's composer rather
+	// than by the editor, and on the server's responses to them.
+	Injected bool `json:"injected,omitempty"`
 }
 
+// Entry directions.
+const (
+	DirectionClientToServer = "client→server"
+	DirectionServerToClient = "server→client"
+)
+
 // Subscriber receives new entries.
 type Subscriber func(Entry)
 
@@ -54,11 +63,22 @@ func (s *Store) Subscribe(fn Subscriber) {
 
 // Add decodes a raw JSON-RPC message, correlates it, stores it, and notifies subscribers.
 func (s *Store) Add(direction string, raw []byte) {
+	s.add(direction, raw, false)
+}
+
+// AddInjected is Add for a message composed in the debug UI, which is tagged
+// as injected. It returns the stored entry.
+func (s *Store) AddInjected(direction string, raw []byte) Entry {
+	return s.add(direction, raw, true)
+}
+
+func (s *Store) add(direction string, raw []byte, injected bool) Entry {
 	e := Entry{
 		Timestamp:  time.Now(),
 		Direction:  direction,
 		Body:       json.RawMessage(append([]byte(nil), raw...)),
 		PairedWith: -1,
+		Injected:   injected,
 	}
 
 	// Decode to classify the message.
@@ -142,6 +162,7 @@ func (s *Store) Add(direction string, raw []byte) {
 			}
 		}
 	}
+	return e
 }
 
 func (s *Store) updatePairedWith(entryID, pairedID int) {
@@ -153,6 +174,23 @@ func (s *Store) updatePairedWith(entryID, pairedID int) {
 	}
 }
 
+// Load replaces the stored entries with entries, such as those in a saved
+// trace, keeping their IDs, timestamps, and pairing. Subscribers are not
+// notified.
+func (s *Store) Load(entries []Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+	}
+	s.entries = append(make([]Entry, 0, len(entries)), entries...)
+	s.nextID = 0
+	if n := len(entries); n > 0 {
+		s.nextID = entries[n-1].ID + 1
+	}
+	s.pending = make(map[string]int)
+}
+
 // Clear removes all entries and resets correlation state.
 func (s *Store) Clear() {
 	s.mu.Lock()
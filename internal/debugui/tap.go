@@ -32,7 +32,7 @@ func (t *Tap) Read(p []byte) (int, error) {
 	if n > 0 {
 		t.readMu.Lock()
 		t.readBuf.Write(p[:n])
-		t.extractMessages(&t.readBuf, "client→server")
+		t.extractMessages(&t.readBuf, DirectionClientToServer)
 		t.readMu.Unlock()
 	}
 	return n, err
@@ -43,7 +43,7 @@ func (t *Tap) Write(p []byte) (int, error) {
 	if n > 0 {
 		t.writeMu.Lock()
 		t.writeBuf.Write(p[:n])
-		t.extractMessages(&t.writeBuf, "server→client")
+		t.extractMessages(&t.writeBuf, DirectionServerToClient)
 		t.writeMu.Unlock()
 	}
 	return n, err
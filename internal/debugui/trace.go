@@ -3,6 +3,11 @@ package debugui
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -27,6 +32,87 @@ type Trace struct {
 	Capabilities json.RawMessage `json:"capabilities,omitempty"`
 }
 
+// ParseTrace decodes a trace written by ExportTrace.
+func ParseTrace(data []byte) (*Trace, error) {
+	var trace Trace
+	if err := json.Unmarshal(data, &trace); err != nil {
+		return nil, fmt.Errorf("decode trace: %w", err)
+	}
+	if trace.Version != TraceVersion {
+		return nil, fmt.Errorf("unsupported trace version %d", trace.Version)
+	}
+	return &trace, nil
+}
+
+// MarshalTrace encodes trace, such as one read by LoadTraceFiles, in the
+// format of an exported trace, applying the requested redactions. It modifies
+// trace.
+func MarshalTrace(trace *Trace, opts TraceExportOptions) ([]byte, error) {
+	redactTrace(trace, opts)
+	if opts.Pretty {
+		return json.MarshalIndent(trace, "", "  ")
+	}
+	return json.Marshal(trace)
+}
+
+// ErrInvalidTracePath is returned by SaveTrace when path is not a regular
+// file, or a file that does not exist yet.
+var ErrInvalidTracePath = errors.New("invalid debug trace path")
+
+// SaveTrace writes an exported trace to path with 0600 permissions, as traces
+// may contain source code and file paths. It refuses to follow a symlink or
+// write to anything but a regular file, and an existing file is made private
+// before it is overwritten.
+func SaveTrace(path string, data []byte) (err error) {
+	cleanPath := filepath.Clean(path)
+	dir, name := filepath.Split(cleanPath)
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return fmt.Errorf("%w: missing file name", ErrInvalidTracePath)
+	}
+	if dir == "" {
+		dir = "."
+	}
+
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := root.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	if info, statErr := root.Lstat(name); statErr == nil {
+		mode := info.Mode()
+		if mode&fs.ModeSymlink != 0 || !mode.IsRegular() {
+			return fmt.Errorf("%w: %s", ErrInvalidTracePath, cleanPath)
+		}
+	} else if !errors.Is(statErr, fs.ErrNotExist) {
+		return statErr
+	}
+
+	f, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	// Restrict an existing file before the trace goes into it.
+	if err := f.Chmod(0o600); err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
 func redactTrace(trace *Trace, opts TraceExportOptions) {
 	if opts.RedactLogs {
 		trace.Logs = nil
@@ -35,6 +121,9 @@ func redactTrace(trace *Trace, opts TraceExportOptions) {
 	for i := range trace.Messages {
 		trace.Messages[i].Body = redactRawMessage(trace.Messages[i].Body, opts)
 	}
+	for i := range trace.Logs {
+		trace.Logs[i].Attrs = redactRawMessage(trace.Logs[i].Attrs, opts)
+	}
 
 	if opts.RedactFilePaths {
 		for i := range trace.Logs {
@@ -2,6 +2,10 @@ package debugui
 
 import (
 	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -71,3 +75,102 @@ func TestExportTraceRedaction(t *testing.T) {
 		t.Fatalf("logs = %#v, want nil", trace.Logs)
 	}
 }
+
+func TestNewRecorderFromTrace(t *testing.T) {
+	rec := NewRecorder()
+	rec.SetCapabilities(map[string]any{"hoverProvider": true})
+	rec.Store().Add(DirectionClientToServer, []byte(`{"jsonrpc":"2.0","id":1,"method":"textDocument/hover","params":{}}`))
+	rec.Store().Add(DirectionServerToClient, []byte(`{"jsonrpc":"2.0","id":1,"result":null}`))
+	rec.LogStore().Add("info", "hovered")
+
+	data, err := rec.ExportTrace(TraceExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace, err := ParseTrace(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewRecorderFromTrace(trace)
+	want := rec.Store().All()
+	got := loaded.Store().All()
+	if len(got) != 2 || got[1].PairedWith != 0 || !got[1].Timestamp.Equal(want[1].Timestamp) {
+		t.Fatalf("messages = %+v, want %+v", got, want)
+	}
+	if logs := loaded.LogStore().All(); len(logs) != 1 || logs[0].Message != "hovered" {
+		t.Fatalf("logs = %+v", logs)
+	}
+	if string(loaded.capabilitiesSnapshot()) != `{"hoverProvider":true}` {
+		t.Fatalf("capabilities = %s", loaded.capabilitiesSnapshot())
+	}
+
+	// New entries continue the loaded IDs.
+	loaded.Store().Add(DirectionClientToServer, []byte(`{"jsonrpc":"2.0","method":"exit"}`))
+	if all := loaded.Store().All(); all[2].ID != 2 {
+		t.Fatalf("next ID = %d, want 2", all[2].ID)
+	}
+
+	stats := NewStats(loaded.Store()).Snapshot()
+	if stats.Requests != 1 || stats.Responses != 1 || stats.Notifications != 1 {
+		t.Fatalf("stats = %+v, want the loaded messages counted", stats)
+	}
+}
+
+func TestParseTraceRejectsUnknownVersion(t *testing.T) {
+	if _, err := ParseTrace([]byte(`{"version":99,"messages":[]}`)); err == nil || !strings.Contains(err.Error(), "version 99") {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := ParseTrace([]byte(`not json`)); err == nil {
+		t.Fatal("expected a decode error")
+	}
+}
+
+func TestExportTraceRedactsLogAttrs(t *testing.T) {
+	rec := NewRecorder()
+	slog.New(rec.SlogHandler()).Info("opened", "path", "/Users/owen/project/main.go", "text", "secret source")
+
+	data, err := rec.ExportTrace(TraceExportOptions{RedactDocumentText: true, RedactFilePaths: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret source", "/Users/owen/project"} {
+		if strings.Contains(string(data), secret) {
+			t.Fatalf("trace contains unredacted value %q: %s", secret, data)
+		}
+	}
+}
+
+func TestSaveTrace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "trace.json")
+	if err := os.WriteFile(path, []byte("an older, longer trace"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTrace(path, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("mode = %v, want 0600", perm)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "{}" {
+		t.Errorf("file = %q", data)
+	}
+
+	link := filepath.Join(dir, "link.json")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{link, dir} {
+		if err := SaveTrace(target, []byte("x")); !errors.Is(err, ErrInvalidTracePath) {
+			t.Errorf("SaveTrace(%s) error = %v, want ErrInvalidTracePath", target, err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "{}" {
+		t.Errorf("write through the symlink changed the file: %q", data)
+	}
+}
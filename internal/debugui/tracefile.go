@@ -0,0 +1,439 @@
+package debugui
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat is the timestamp in the names of rotated trace files. It
+// sorts in time order.
+const rotatedTimeFormat = "20060102T150405.000000000"
+
+// TraceFileOptions controls how a TraceFile is written and rotated.
+type TraceFileOptions struct {
+	// Redact is applied to each message and log as it is written. Pretty is
+	// ignored.
+	Redact TraceExportOptions
+	// MaxSize is the size in bytes at which the file is rotated. Zero never
+	// rotates by size.
+	MaxSize int64
+	// MaxAge is how long a file is written before it is rotated. Zero never
+	// rotates by age.
+	MaxAge time.Duration
+	// MaxFiles is the number of rotated files kept, removing the oldest. Zero
+	// keeps them all.
+	MaxFiles int
+}
+
+// traceLine is one line of a trace file. Each file starts with a header, and
+// then the capabilities if they are known.
+type traceLine struct {
+	Kind         string          `json:"kind"` // "header", "capabilities", "message", or "log"
+	Version      int             `json:"version,omitempty"`
+	CreatedAt    *time.Time      `json:"createdAt,omitempty"`
+	Capabilities json.RawMessage `json:"capabilities,omitempty"`
+	Message      *Entry          `json:"message,omitempty"`
+	Log          *LogEntry       `json:"log,omitempty"`
+}
+
+// TraceFile streams captured messages, logs, and capabilities to a JSON Lines
+// file as they happen, so a long session is not limited by the in-memory
+// stores. Rotated files are kept next to it, named after it with the time of
+// rotation. LoadTraceFiles reads them back. It is safe for concurrent use.
+type TraceFile struct {
+	root *os.Root
+	name string
+	opts TraceFileOptions
+	now  func() time.Time
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+	caps   json.RawMessage
+	err    error
+}
+
+// CreateTraceFile opens path for streaming. An existing trace at path is
+// rotated first, so each file holds one session from its header on. Like
+// SaveDebugTrace, it refuses symlinks and writes with 0600 permissions.
+func CreateTraceFile(path string, opts TraceFileOptions) (*TraceFile, error) {
+	dir, name := filepath.Split(filepath.Clean(path))
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return nil, fmt.Errorf("trace file %q: missing file name", path)
+	}
+	if dir == "" {
+		dir = "."
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	t := &TraceFile{root: root, name: name, opts: opts, now: time.Now}
+
+	if info, err := root.Lstat(name); err == nil {
+		if !info.Mode().IsRegular() {
+			_ = root.Close()
+			return nil, fmt.Errorf("trace file %s is not a regular file", path)
+		}
+		if info.Size() > 0 {
+			if err := t.rotateExisting(); err != nil {
+				_ = root.Close()
+				return nil, err
+			}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		_ = root.Close()
+		return nil, err
+	}
+
+	if err := t.open(); err != nil {
+		_ = root.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// WriteEntry appends a captured message.
+func (t *TraceFile) WriteEntry(e Entry) {
+	if t.redacting() {
+		trace := Trace{Messages: []Entry{e}}
+		redactTrace(&trace, t.opts.Redact)
+		e = trace.Messages[0]
+	}
+	t.write(traceLine{Kind: "message", Message: &e})
+}
+
+// WriteLog appends a captured log entry, unless logs are redacted.
+func (t *TraceFile) WriteLog(e LogEntry) {
+	if t.opts.Redact.RedactLogs {
+		return
+	}
+	if t.redacting() {
+		trace := Trace{Logs: []LogEntry{e}}
+		redactTrace(&trace, t.opts.Redact)
+		e = trace.Logs[0]
+	}
+	t.write(traceLine{Kind: "log", Log: &e})
+}
+
+// WriteCapabilities appends the server's capabilities, which are repeated at
+// the start of each file after a rotation.
+func (t *TraceFile) WriteCapabilities(caps json.RawMessage) {
+	if t.redacting() {
+		trace := Trace{Capabilities: caps}
+		redactTrace(&trace, t.opts.Redact)
+		caps = trace.Capabilities
+	}
+	t.mu.Lock()
+	t.caps = caps
+	t.mu.Unlock()
+	t.write(traceLine{Kind: "capabilities", Capabilities: caps})
+}
+
+// Close closes the file. It returns the first error met while writing, as
+// writes stop at the first error rather than failing the traced server.
+func (t *TraceFile) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.f != nil {
+		if err := t.f.Close(); err != nil && t.err == nil {
+			t.err = err
+		}
+		t.f = nil
+	}
+	if err := t.root.Close(); err != nil && t.err == nil {
+		t.err = err
+	}
+	return t.err
+}
+
+// redacting reports whether anything in a message is redacted, which costs
+// decoding it.
+func (t *TraceFile) redacting() bool {
+	return t.opts.Redact.RedactDocumentText || t.opts.Redact.RedactFilePaths
+}
+
+func (t *TraceFile) write(line traceLine) {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.f == nil || t.err != nil {
+		return
+	}
+	if t.shouldRotate(len(data)) {
+		if t.err = t.rotate(); t.err != nil {
+			return
+		}
+	}
+	t.append(data)
+}
+
+func (t *TraceFile) shouldRotate(n int) bool {
+	if t.opts.MaxSize > 0 && t.size+int64(n) > t.opts.MaxSize {
+		return true
+	}
+	return t.opts.MaxAge > 0 && t.now().Sub(t.opened) >= t.opts.MaxAge
+}
+
+func (t *TraceFile) append(data []byte) {
+	n, err := t.f.Write(data)
+	t.size += int64(n)
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+// open creates the current file and writes its header and the last known
+// capabilities.
+func (t *TraceFile) open() error {
+	f, err := t.root.OpenFile(t.name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	t.f, t.size, t.opened = f, 0, t.now()
+
+	created := t.opened.UTC()
+	header, _ := json.Marshal(traceLine{Kind: "header", Version: TraceVersion, CreatedAt: &created})
+	t.append(append(header, '\n'))
+	if t.caps != nil {
+		caps, _ := json.Marshal(traceLine{Kind: "capabilities", Capabilities: t.caps})
+		t.append(append(caps, '\n'))
+	}
+	return t.err
+}
+
+// rotate closes the current file, renames it, and opens a new one.
+func (t *TraceFile) rotate() error {
+	if err := t.f.Close(); err != nil {
+		return err
+	}
+	t.f = nil
+	if err := t.rotateExisting(); err != nil {
+		return err
+	}
+	return t.open()
+}
+
+// rotateExisting renames the current file and removes rotated files beyond
+// MaxFiles.
+func (t *TraceFile) rotateExisting() error {
+	stem, ext := splitTraceName(t.name)
+	if err := t.root.Rename(t.name, stem+"-"+t.now().UTC().Format(rotatedTimeFormat)+ext); err != nil {
+		return err
+	}
+	if t.opts.MaxFiles <= 0 {
+		return nil
+	}
+	rotated, err := rotatedTraceFiles(t.root.FS(), t.name)
+	if err != nil {
+		return err
+	}
+	for len(rotated) > t.opts.MaxFiles {
+		if err := t.root.Remove(rotated[0]); err != nil {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+// splitTraceName splits a trace file name into the parts before and after
+// the rotation timestamp.
+func splitTraceName(name string) (stem, ext string) {
+	ext = filepath.Ext(name)
+	return strings.TrimSuffix(name, ext), ext
+}
+
+// rotatedTraceFiles returns the names of the files rotated from name in
+// fsys, oldest first.
+func rotatedTraceFiles(fsys fs.FS, name string) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	stem, ext := splitTraceName(name)
+	var rotated []string
+	for _, e := range entries {
+		ts, ok := strings.CutPrefix(e.Name(), stem+"-")
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		if ts, ok = strings.CutSuffix(ts, ext); !ok {
+			continue
+		}
+		if _, err := time.Parse(rotatedTimeFormat, ts); err == nil {
+			rotated = append(rotated, e.Name())
+		}
+	}
+	sort.Strings(rotated)
+	return rotated, nil
+}
+
+// IsTraceFile reports whether data is the start of a file written by a
+// TraceFile rather than an exported trace.
+func IsTraceFile(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(`{"kind":"header"`))
+}
+
+// LoadTraceFiles reads the trace streamed to path, including the files
+// rotated from it, into a single Trace. Message and log IDs are renumbered
+// where they restarted, after the stores were cleared or the server was
+// restarted, so they are unique across the files. A line cut short by a
+// crash at the end of a file is skipped.
+func LoadTraceFiles(path string) (*Trace, error) {
+	dir, name := filepath.Split(filepath.Clean(path))
+	if dir == "" {
+		dir = "."
+	}
+	fsys := os.DirFS(dir)
+	files, err := rotatedTraceFiles(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.Stat(fsys, name); err == nil {
+		files = append(files, name)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: %w", path, fs.ErrNotExist)
+	}
+
+	l := &traceLoader{trace: &Trace{Version: TraceVersion, Messages: []Entry{}}, messageIDs: newIDRebaser(), logIDs: newIDRebaser()}
+	for _, file := range files {
+		if err := l.loadFile(fsys, file); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(dir, file), err)
+		}
+	}
+	l.pair()
+	return l.trace, nil
+}
+
+type traceLoader struct {
+	trace      *Trace
+	messageIDs idRebaser
+	logIDs     idRebaser
+}
+
+func (l *traceLoader) loadFile(fsys fs.FS, name string) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	r := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		data, err := r.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		last := errors.Is(err, io.EOF)
+		if len(bytes.TrimSpace(data)) > 0 {
+			var line traceLine
+			if jerr := json.Unmarshal(data, &line); jerr != nil {
+				if last {
+					return nil
+				}
+				return fmt.Errorf("line %d: %w", lineNo, jerr)
+			}
+			if err := l.add(line); err != nil {
+				return fmt.Errorf("line %d: %w", lineNo, err)
+			}
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+func (l *traceLoader) add(line traceLine) error {
+	switch line.Kind {
+	case "header":
+		if line.Version != TraceVersion {
+			return fmt.Errorf("unsupported trace version %d", line.Version)
+		}
+		if l.trace.CreatedAt.IsZero() && line.CreatedAt != nil {
+			l.trace.CreatedAt = *line.CreatedAt
+		}
+	case "capabilities":
+		l.trace.Capabilities = line.Capabilities
+	case "message":
+		if line.Message == nil {
+			return errors.New("message line without a message")
+		}
+		e := *line.Message
+		base := l.messageIDs.base
+		e.ID = l.messageIDs.id(e.ID)
+		// A response is paired with a request from the same session, which
+		// was renumbered by the same amount.
+		if e.PairedWith >= 0 && l.messageIDs.base == base {
+			e.PairedWith += base
+		} else {
+			e.PairedWith = -1
+		}
+		l.trace.Messages = append(l.trace.Messages, e)
+	case "log":
+		if line.Log == nil {
+			return errors.New("log line without a log")
+		}
+		e := *line.Log
+		e.ID = l.logIDs.id(e.ID)
+		l.trace.Logs = append(l.trace.Logs, e)
+	}
+	return nil
+}
+
+// pair points requests at their responses. Requests are written before they
+// are answered, so only the responses record the pairing.
+func (l *traceLoader) pair() {
+	index := make(map[int]int, len(l.trace.Messages))
+	for i, e := range l.trace.Messages {
+		index[e.ID] = i
+	}
+	for _, e := range l.trace.Messages {
+		if e.MsgType != "response" || e.PairedWith < 0 {
+			continue
+		}
+		if i, ok := index[e.PairedWith]; ok {
+			l.trace.Messages[i].PairedWith = e.ID
+		}
+	}
+}
+
+// idRebaser renumbers IDs that restart from zero so they stay unique. An ID
+// seen twice marks the restart; subscribers may see IDs slightly out of
+// order, so a smaller ID alone does not.
+type idRebaser struct {
+	base, max int
+	seen      map[int]bool
+}
+
+func newIDRebaser() idRebaser {
+	return idRebaser{max: -1, seen: make(map[int]bool)}
+}
+
+func (r *idRebaser) id(id int) int {
+	if r.seen[id] {
+		r.base = r.max + 1
+		clear(r.seen)
+	}
+	r.seen[id] = true
+	r.max = max(r.max, id+r.base)
+	return id + r.base
+}
@@ -0,0 +1,193 @@
+package debugui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceFileStreamsAndLoads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	tf, err := CreateTraceFile(path, TraceFileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := NewRecorder()
+	rec.SetCapabilities(map[string]any{"hoverProvider": true})
+	rec.StreamTo(tf)
+
+	rec.Store().Add(DirectionClientToServer, []byte(`{"jsonrpc":"2.0","id":1,"method":"textDocument/hover","params":{}}`))
+	rec.Store().Add(DirectionServerToClient, []byte(`{"jsonrpc":"2.0","id":1,"result":null}`))
+	rec.LogStore().Add("info", "hovered")
+	// Clearing the stores restarts their IDs.
+	rec.Store().Clear()
+	rec.LogStore().Clear()
+	rec.Store().Add(DirectionClientToServer, []byte(`{"jsonrpc":"2.0","id":2,"method":"textDocument/hover","params":{}}`))
+	rec.Store().Add(DirectionServerToClient, []byte(`{"jsonrpc":"2.0","id":2,"result":null}`))
+	rec.LogStore().Add("info", "hovered again")
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("mode = %v, want 0600", perm)
+	}
+	data, _ := os.ReadFile(path)
+	if !IsTraceFile(data) {
+		t.Errorf("file does not start with a header: %s", data)
+	}
+
+	trace, err := LoadTraceFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(trace.Capabilities) != `{"hoverProvider":true}` {
+		t.Errorf("capabilities = %s", trace.Capabilities)
+	}
+	if len(trace.Messages) != 4 || len(trace.Logs) != 2 {
+		t.Fatalf("loaded %d messages and %d logs, want 4 and 2", len(trace.Messages), len(trace.Logs))
+	}
+	for i, e := range trace.Messages {
+		if e.ID != i {
+			t.Errorf("message %d has ID %d", i, e.ID)
+		}
+	}
+	if trace.Messages[2].PairedWith != 3 || trace.Messages[3].PairedWith != 2 {
+		t.Errorf("second pair = %d/%d, want 3/2", trace.Messages[2].PairedWith, trace.Messages[3].PairedWith)
+	}
+	if trace.Logs[1].ID != 1 || trace.Logs[1].Message != "hovered again" {
+		t.Errorf("second log = %+v", trace.Logs[1])
+	}
+}
+
+func TestTraceFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session.jsonl")
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tf, err := CreateTraceFile(path, TraceFileOptions{MaxSize: 400, MaxAge: time.Hour, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf.now = func() time.Time { return now }
+	rec := NewRecorder()
+	rec.StreamTo(tf)
+	rec.SetCapabilities(map[string]any{"hoverProvider": true})
+
+	for i := range 12 {
+		now = now.Add(time.Second)
+		rec.LogStore().Add("info", strings.Repeat("x", 50))
+		if i == 8 {
+			// Past MaxAge, so the next write rotates however small the file is.
+			now = now.Add(time.Hour)
+		}
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := rotatedTraceFiles(os.DirFS(dir), "session.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("rotated files = %v, want the newest 2", rotated)
+	}
+	for _, name := range append(rotated, "session.jsonl") {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsTraceFile(data) || !strings.Contains(string(data), `"hoverProvider":true`) {
+			t.Errorf("%s does not start with a header and the capabilities", name)
+		}
+		if len(data) > 400 {
+			t.Errorf("%s is %d bytes, want at most 400", name, len(data))
+		}
+	}
+
+	trace, err := LoadTraceFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(trace.Logs); n == 0 || n >= 12 || trace.Logs[n-1].ID != 11 {
+		t.Errorf("loaded %d logs, want the latest ones after pruning", n)
+	}
+}
+
+func TestTraceFileRotatesPreviousSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	for _, msg := range []string{"first", "second"} {
+		tf, err := CreateTraceFile(path, TraceFileOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := NewRecorder()
+		rec.StreamTo(tf)
+		rec.LogStore().Add("info", msg)
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trace, err := LoadTraceFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace.Logs) != 2 || trace.Logs[0].Message != "first" || trace.Logs[1].ID != 1 {
+		t.Errorf("logs = %+v, want both sessions in order", trace.Logs)
+	}
+}
+
+func TestTraceFileRedaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	tf, err := CreateTraceFile(path, TraceFileOptions{Redact: TraceExportOptions{RedactDocumentText: true, RedactFilePaths: true, RedactLogs: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := NewRecorder()
+	rec.StreamTo(tf)
+	rec.Store().Add(DirectionClientToServer, []byte(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///Users/owen/project/main.go","text":"secret source"}}}`))
+	rec.LogStore().Add("info", "secret log")
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	for _, secret := range []string{"secret source", "/Users/owen", "secret log"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("trace file contains %q: %s", secret, data)
+		}
+	}
+}
+
+func TestLoadTraceFilesSkipsTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	data := `{"kind":"header","version":1,"createdAt":"2025-01-01T00:00:00Z"}` + "\n" +
+		`{"kind":"log","log":{"id":0,"level":"info","message":"kept"}}` + "\n" +
+		`{"kind":"log","log":{"id":1,"lev`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	trace, err := LoadTraceFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace.Logs) != 1 || trace.CreatedAt.Year() != 2025 {
+		t.Errorf("trace = %+v", trace)
+	}
+
+	bad := strings.Replace(data, `"kept"}}`, `"kept"`, 1)
+	if err := os.WriteFile(path, []byte(bad), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTraceFiles(path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("err = %v, want an error at line 2", err)
+	}
+}
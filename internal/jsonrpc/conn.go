@@ -26,8 +26,23 @@ type Conn struct {
 	pendingMu      sync.Mutex
 	pending        map[string]chan *Response
 	requestTimeout time.Duration
+	requestHooks   []RequestHook
+	notifyHooks    []NotificationHook
+	notifyMu       sync.Mutex
 }
 
+// RequestHook is called as each incoming request starts, with the request's
+// context. The handler runs with the context it returns. The function it
+// returns, if not nil, is called with the response once the request has been
+// handled, including when the handler panicked.
+type RequestHook func(ctx context.Context, req *Request) (context.Context, func(resp *Response))
+
+// NotificationHook is called as each incoming notification other than
+// $/cancelRequest starts. The handler runs with the context it returns. The
+// function it returns, if not nil, is called with the handler's error once it
+// has returned or panicked.
+type NotificationHook func(ctx context.Context, notif *Notification) (context.Context, func(err error))
+
 func NewConn(rw io.ReadWriteCloser, dispatcher *Dispatcher) *Conn {
 	return &Conn{
 		reader:     bufio.NewReader(rw),
@@ -113,13 +128,26 @@ func (c *Conn) Serve(ctx context.Context) error {
 		case *Request:
 			go c.handleRequest(ctx, m)
 		case *Notification:
-			c.handleNotification(ctx, m)
+			_ = c.handleNotification(ctx, m)
 		case *Response:
 			c.routeResponse(m)
 		}
 	}
 }
 
+// AddRequestHook adds a hook that observes every incoming request. Hooks run
+// in the order they were added, and their completion functions in reverse.
+// It must be called before Serve.
+func (c *Conn) AddRequestHook(hook RequestHook) {
+	c.requestHooks = append(c.requestHooks, hook)
+}
+
+// AddNotificationHook adds a hook that observes every incoming notification,
+// in the same way as AddRequestHook. It must be called before Serve.
+func (c *Conn) AddNotificationHook(hook NotificationHook) {
+	c.notifyHooks = append(c.notifyHooks, hook)
+}
+
 // SetRequestTimeout sets a default timeout for all incoming requests.
 // A zero duration means no timeout (the default).
 func (c *Conn) SetRequestTimeout(d time.Duration) {
@@ -127,6 +155,12 @@ func (c *Conn) SetRequestTimeout(d time.Duration) {
 }
 
 func (c *Conn) handleRequest(ctx context.Context, req *Request) {
+	_ = c.WriteMessage(c.runRequest(ctx, req))
+}
+
+// runRequest handles req and returns its response, recovering from a panic
+// in the handler.
+func (c *Conn) runRequest(ctx context.Context, req *Request) (resp *Response) {
 	var reqCtx context.Context
 	var cancel context.CancelFunc
 	if c.requestTimeout > 0 {
@@ -140,10 +174,21 @@ func (c *Conn) handleRequest(ctx context.Context, req *Request) {
 	c.cancels[idStr] = cancel
 	c.cancelMu.Unlock()
 
+	var dones []func(*Response)
+	for _, hook := range c.requestHooks {
+		var done func(*Response)
+		reqCtx, done = hook(reqCtx, req)
+		if done != nil {
+			dones = append(dones, done)
+		}
+	}
+
 	defer func() {
 		if r := recover(); r != nil {
-			resp := NewErrorResponse(req.ID, NewError(CodeInternalError, fmt.Sprintf("panic in handler %s: %v", req.Method, r)))
-			_ = c.WriteMessage(resp)
+			resp = NewErrorResponse(req.ID, NewError(CodeInternalError, fmt.Sprintf("panic in handler %s: %v", req.Method, r)))
+		}
+		for i := len(dones) - 1; i >= 0; i-- {
+			dones[i](resp)
 		}
 		cancel()
 		c.cancelMu.Lock()
@@ -151,22 +196,54 @@ func (c *Conn) handleRequest(ctx context.Context, req *Request) {
 		c.cancelMu.Unlock()
 	}()
 
-	resp := c.dispatcher.HandleRequest(reqCtx, req)
-	_ = c.WriteMessage(resp)
+	return c.dispatcher.HandleRequest(reqCtx, req)
 }
 
-func (c *Conn) handleNotification(ctx context.Context, notif *Notification) {
+// handleNotification handles notif and returns the handler's error. Handlers
+// run one at a time, in the order their notifications arrived.
+func (c *Conn) handleNotification(ctx context.Context, notif *Notification) (err error) {
+	if notif.Method == "$/cancelRequest" {
+		c.handleCancel(notif)
+		return nil
+	}
+
+	c.notifyMu.Lock()
+	defer c.notifyMu.Unlock()
+
+	var dones []func(error)
+	for _, hook := range c.notifyHooks {
+		var done func(error)
+		ctx, done = hook(ctx, notif)
+		if done != nil {
+			dones = append(dones, done)
+		}
+	}
+
 	defer func() {
 		if r := recover(); r != nil {
 			slog.Error("panic in notification handler", "method", notif.Method, "panic", r)
+			err = fmt.Errorf("panic in notification handler %s: %v", notif.Method, r)
+		}
+		for i := len(dones) - 1; i >= 0; i-- {
+			dones[i](err)
 		}
 	}()
 
-	if notif.Method == "$/cancelRequest" {
-		c.handleCancel(notif)
-		return
-	}
-	c.dispatcher.HandleNotification(ctx, notif)
+	return c.dispatcher.HandleNotification(ctx, notif)
+}
+
+// InjectRequest handles req as if the peer had sent it, and returns the
+// response instead of writing it to the peer. Hooks run as for any other
+// request.
+func (c *Conn) InjectRequest(ctx context.Context, req *Request) *Response {
+	return c.runRequest(ctx, req)
+}
+
+// InjectNotification handles notif as if the peer had sent it, and returns
+// the handler's error. It waits for any notification being handled to finish
+// first, so handlers still see notifications one at a time.
+func (c *Conn) InjectNotification(ctx context.Context, notif *Notification) error {
+	return c.handleNotification(ctx, notif)
 }
 
 func (c *Conn) handleCancel(notif *Notification) {
@@ -57,10 +57,12 @@ func (d *Dispatcher) HandleRequest(ctx context.Context, req *Request) *Response
 	return resp
 }
 
-func (d *Dispatcher) HandleNotification(ctx context.Context, notif *Notification) {
+// HandleNotification runs the handler for notif, if there is one, and
+// returns its error.
+func (d *Dispatcher) HandleNotification(ctx context.Context, notif *Notification) error {
 	handler, ok := d.notifications[notif.Method]
 	if !ok {
-		return
+		return nil
 	}
-	_ = handler(ctx, notif.Params)
+	return handler(ctx, notif.Params)
 }
@@ -233,3 +233,94 @@ func TestConn_HandleNotification_PanicRecovery(t *testing.T) {
 	// Should not panic — recovery catches it.
 	conn.handleNotification(t.Context(), notif)
 }
+
+func TestConn_RequestHook(t *testing.T) {
+	d := NewDispatcher()
+	d.RegisterMethod("ok", func(_ context.Context, _ json.RawMessage) (any, error) {
+		return "fine", nil
+	})
+	d.RegisterMethod("boom", func(_ context.Context, _ json.RawMessage) (any, error) {
+		panic("handler blew up")
+	})
+
+	conn := NewConn(nopCloser{Reader: bytes.NewReader(nil), Writer: io.Discard}, d)
+	var observed []string
+	conn.AddRequestHook(func(ctx context.Context, req *Request) (context.Context, func(*Response)) {
+		method := req.Method
+		observed = append(observed, "start "+method)
+		return ctx, func(resp *Response) {
+			code := 0
+			if resp.Error != nil {
+				code = resp.Error.Code
+			}
+			observed = append(observed, fmt.Sprintf("done %s %d", method, code))
+		}
+	})
+
+	conn.handleRequest(t.Context(), &Request{JSONRPC: Version, ID: IntID(1), Method: "ok"})
+	conn.handleRequest(t.Context(), &Request{JSONRPC: Version, ID: IntID(2), Method: "boom"})
+
+	want := []string{"start ok", "done ok 0", "start boom", fmt.Sprintf("done boom %d", CodeInternalError)}
+	if fmt.Sprint(observed) != fmt.Sprint(want) {
+		t.Fatalf("observed %q, want %q", observed, want)
+	}
+}
+
+func TestConn_NotificationHooks(t *testing.T) {
+	type key struct{}
+	d := NewDispatcher()
+	d.RegisterNotification("note", func(ctx context.Context, _ json.RawMessage) error {
+		return fmt.Errorf("handled with %v", ctx.Value(key{}))
+	})
+
+	conn := NewConn(nopCloser{Reader: bytes.NewReader(nil), Writer: io.Discard}, d)
+	var observed []string
+	for _, name := range []string{"outer", "inner"} {
+		conn.AddNotificationHook(func(ctx context.Context, notif *Notification) (context.Context, func(error)) {
+			observed = append(observed, "start "+name)
+			return context.WithValue(ctx, key{}, name), func(err error) {
+				observed = append(observed, fmt.Sprintf("done %s: %v", name, err))
+			}
+		})
+	}
+
+	conn.handleNotification(t.Context(), &Notification{JSONRPC: Version, Method: "note"})
+	conn.handleNotification(t.Context(), &Notification{JSONRPC: Version, Method: "$/cancelRequest", Params: json.RawMessage(`{"id":1}`)})
+
+	want := []string{"start outer", "start inner", "done inner: handled with inner", "done outer: handled with inner"}
+	if fmt.Sprint(observed) != fmt.Sprint(want) {
+		t.Fatalf("observed %q, want %q", observed, want)
+	}
+}
+
+func TestConn_Inject(t *testing.T) {
+	d := NewDispatcher()
+	d.RegisterMethod("echo", func(_ context.Context, params json.RawMessage) (any, error) {
+		return params, nil
+	})
+	d.RegisterNotification("note", func(_ context.Context, _ json.RawMessage) error {
+		return fmt.Errorf("rejected")
+	})
+
+	var written bytes.Buffer
+	conn := NewConn(nopCloser{Reader: bytes.NewReader(nil), Writer: &written}, d)
+	var hooked []string
+	conn.AddRequestHook(func(ctx context.Context, req *Request) (context.Context, func(*Response)) {
+		hooked = append(hooked, req.Method)
+		return ctx, nil
+	})
+
+	resp := conn.InjectRequest(t.Context(), &Request{JSONRPC: Version, ID: StringID("debug-1"), Method: "echo", Params: json.RawMessage(`{"a":1}`)})
+	if resp.Error != nil || string(resp.Result) != `{"a":1}` || resp.ID.String() != "debug-1" {
+		t.Fatalf("response = %+v", resp)
+	}
+	if err := conn.InjectNotification(t.Context(), &Notification{JSONRPC: Version, Method: "note"}); err == nil || err.Error() != "rejected" {
+		t.Fatalf("notification error = %v", err)
+	}
+	if written.Len() != 0 {
+		t.Fatalf("injected messages wrote %q to the peer", written.String())
+	}
+	if fmt.Sprint(hooked) != "[echo]" {
+		t.Fatalf("hooks saw %q", hooked)
+	}
+}
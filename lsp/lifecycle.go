@@ -124,6 +124,15 @@ type SetTraceParams struct {
 	Value TraceValue `json:"value"`
 }
 
+// LogTraceParams holds the parameters of a `$/logTrace` notification.
+type LogTraceParams struct {
+	// The message to be logged.
+	Message string `json:"message"`
+	// Additional information that can be computed if the `trace` configuration
+	// is set to `'verbose'`.
+	Verbose string `json:"verbose,omitempty"`
+}
+
 // DocumentHighlightParams holds the parameters for a [DocumentHighlightRequest].
 type DocumentHighlightParams struct {
 	TextDocumentPositionParams
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/owenrumney/go-lsp/internal/jsonrpc"
 	"github.com/owenrumney/go-lsp/lsp"
@@ -11,11 +12,23 @@ import (
 
 // Client provides methods for server-to-client communication.
 type Client struct {
-	conn *jsonrpc.Conn
+	conn          *jsonrpc.Conn
+	registrations *Registrations
+
+	mu    sync.RWMutex
+	trace lsp.TraceValue
 }
 
 func newClient(conn *jsonrpc.Conn) *Client {
-	return &Client{conn: conn}
+	c := &Client{conn: conn}
+	c.registrations = newRegistrations(c)
+	return c
+}
+
+// Registrations returns the manager for capabilities registered dynamically
+// with the client.
+func (c *Client) Registrations() *Registrations {
+	return c.registrations
 }
 
 // PublishDiagnostics sends a textDocument/publishDiagnostics notification to the client.
@@ -33,6 +46,37 @@ func (c *Client) LogMessage(ctx context.Context, params *lsp.LogMessageParams) e
 	return c.conn.Notify(ctx, "window/logMessage", params)
 }
 
+// Trace returns the trace level negotiated with the client in initialize or
+// most recently set with $/setTrace.
+func (c *Client) Trace() lsp.TraceValue {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.trace == "" {
+		return lsp.TraceOff
+	}
+	return c.trace
+}
+
+func (c *Client) setTrace(value lsp.TraceValue) {
+	c.mu.Lock()
+	c.trace = value
+	c.mu.Unlock()
+}
+
+// LogTrace sends a $/logTrace notification to the client. It does nothing when
+// tracing is off, and verbose is only sent when the trace level is verbose.
+func (c *Client) LogTrace(ctx context.Context, message, verbose string) error {
+	params := &lsp.LogTraceParams{Message: message}
+	switch c.Trace() {
+	case lsp.TraceMessages:
+	case lsp.TraceVerbose:
+		params.Verbose = verbose
+	default:
+		return nil
+	}
+	return c.conn.Notify(ctx, "$/logTrace", params)
+}
+
 // Progress sends a $/progress notification to the client.
 func (c *Client) Progress(ctx context.Context, params *lsp.ProgressParams) error {
 	return c.conn.Notify(ctx, "$/progress", params)
@@ -64,6 +108,49 @@ func (c *Client) CreateWorkDoneProgress(ctx context.Context, params *lsp.WorkDon
 	return err
 }
 
+// RegisterCapability sends a client/registerCapability request to the client.
+// Most servers should use [Client.Registrations] instead, which generates IDs
+// and tracks active registrations.
+func (c *Client) RegisterCapability(ctx context.Context, params *lsp.RegistrationParams) error {
+	resp, err := c.conn.Call(ctx, "client/registerCapability", params)
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("registerCapability: %s", resp.Error.Message)
+	}
+	return nil
+}
+
+// UnregisterCapability sends a client/unregisterCapability request to the client.
+func (c *Client) UnregisterCapability(ctx context.Context, params *lsp.UnregistrationParams) error {
+	resp, err := c.conn.Call(ctx, "client/unregisterCapability", params)
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("unregisterCapability: %s", resp.Error.Message)
+	}
+	return nil
+}
+
+// Configuration sends a workspace/configuration request to the client and
+// returns one raw settings value per requested item.
+func (c *Client) Configuration(ctx context.Context, params *lsp.ConfigurationParams) ([]json.RawMessage, error) {
+	resp, err := c.conn.Call(ctx, "workspace/configuration", params)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("configuration: %s", resp.Error.Message)
+	}
+	var result []json.RawMessage
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // InlayHintRefresh sends a workspace/inlayHint/refresh request to the client.
 func (c *Client) InlayHintRefresh(ctx context.Context) error {
 	_, err := c.conn.Call(ctx, "workspace/inlayHint/refresh", nil)
@@ -114,3 +201,19 @@ func (c *Client) ShowDocument(ctx context.Context, params *lsp.ShowDocumentParam
 	}
 	return &result, nil
 }
+
+// ApplyEdit sends a workspace/applyEdit request to the client and waits for a response.
+func (c *Client) ApplyEdit(ctx context.Context, params *lsp.ApplyWorkspaceEditParams) (*lsp.ApplyWorkspaceEditResult, error) {
+	resp, err := c.conn.Call(ctx, "workspace/applyEdit", params)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("applyEdit: %s", resp.Error.Message)
+	}
+	var result lsp.ApplyWorkspaceEditResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// ConfigurationOptions controls which settings a [Configuration] pulls from the
+// client.
+type ConfigurationOptions struct {
+	// Sections are the configuration sections requested with
+	// workspace/configuration, e.g. "mylang". Each section's value is decoded
+	// into the settings struct in order, so later sections override earlier
+	// ones. If empty, the whole configuration is requested.
+	Sections []string
+
+	// PerFolder additionally requests every section scoped to each workspace
+	// folder, making folder-specific settings available through For.
+	PerFolder bool
+}
+
+// Configuration pulls settings from the client and decodes them into T.
+//
+// Settings are layered: the defaults passed to NewConfiguration, then the
+// InitializationOptions from initialize, then the sections returned by
+// workspace/configuration. The configuration is fetched after the client sends
+// initialized and again on every workspace/didChangeConfiguration. Clients that
+// do not support workspace/configuration are handled by reading the sections
+// from the didChangeConfiguration settings payload instead.
+//
+// Enable it with [WithConfiguration]. Handlers that need to react to new
+// settings should use OnChange rather than DidChangeConfigurationHandler,
+// because the refresh completes asynchronously.
+type Configuration[T any] struct {
+	defaults T
+	opts     ConfigurationOptions
+
+	refreshMu sync.Mutex
+
+	mu          sync.RWMutex
+	client      *Client
+	pull        bool
+	initOptions json.RawMessage
+	folders     []lsp.WorkspaceFolder
+	global      T
+	perFolder   map[lsp.DocumentURI]T
+	subscribers []func(T)
+}
+
+// NewConfiguration creates a Configuration that starts out as defaults.
+func NewConfiguration[T any](defaults T, opts ConfigurationOptions) *Configuration[T] {
+	c := &Configuration[T]{
+		defaults:  defaults,
+		opts:      opts,
+		perFolder: make(map[lsp.DocumentURI]T),
+	}
+	c.global, _ = c.decode()
+	return c
+}
+
+// Get returns the current workspace-wide settings.
+func (c *Configuration[T]) Get() T {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.global
+}
+
+// For returns the settings for the workspace folder containing uri, falling
+// back to the workspace-wide settings when PerFolder is disabled or no folder
+// matches.
+func (c *Configuration[T]) For(uri lsp.DocumentURI) T {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var best lsp.DocumentURI
+	for folder := range c.perFolder {
+		if uriContains(folder, uri) && len(folder) > len(best) {
+			best = folder
+		}
+	}
+	if best != "" {
+		return c.perFolder[best]
+	}
+	return c.global
+}
+
+// OnChange registers fn to be called with the new workspace-wide settings
+// whenever a refresh changes any settings.
+func (c *Configuration[T]) OnChange(fn func(T)) {
+	c.mu.Lock()
+	c.subscribers = append(c.subscribers, fn)
+	c.mu.Unlock()
+}
+
+// Refresh pulls the configuration from the client. It waits for the client's
+// response, so it must not be called directly from a notification handler.
+func (c *Configuration[T]) Refresh(ctx context.Context) error {
+	c.mu.RLock()
+	client, pull := c.client, c.pull
+	c.mu.RUnlock()
+
+	if client == nil {
+		return fmt.Errorf("configuration: server not running")
+	}
+	if !pull {
+		return nil
+	}
+
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	c.mu.RLock()
+	folders := append([]lsp.WorkspaceFolder(nil), c.folders...)
+	c.mu.RUnlock()
+
+	sections := c.opts.Sections
+	if len(sections) == 0 {
+		sections = []string{""}
+	}
+	items := make([]lsp.ConfigurationItem, 0, len(sections)*(len(folders)+1))
+	for _, section := range sections {
+		items = append(items, lsp.ConfigurationItem{Section: section})
+	}
+	if c.opts.PerFolder {
+		for _, folder := range folders {
+			scope := folder.URI
+			for _, section := range sections {
+				items = append(items, lsp.ConfigurationItem{ScopeURI: &scope, Section: section})
+			}
+		}
+	}
+
+	results, err := client.Configuration(ctx, &lsp.ConfigurationParams{Items: items})
+	if err != nil {
+		return err
+	}
+	if len(results) != len(items) {
+		return fmt.Errorf("configuration: got %d results for %d items", len(results), len(items))
+	}
+
+	global, err := c.decode(results[:len(sections)]...)
+	if err != nil {
+		return err
+	}
+	perFolder := make(map[lsp.DocumentURI]T)
+	if c.opts.PerFolder {
+		for i, folder := range folders {
+			start := len(sections) * (i + 1)
+			value, err := c.decode(results[start : start+len(sections)]...)
+			if err != nil {
+				return err
+			}
+			perFolder[folder.URI] = value
+		}
+	}
+
+	c.update(global, perFolder)
+	return nil
+}
+
+func (c *Configuration[T]) update(global T, perFolder map[lsp.DocumentURI]T) {
+	c.mu.Lock()
+	changed := !reflect.DeepEqual(c.global, global) || !reflect.DeepEqual(c.perFolder, perFolder)
+	c.global = global
+	c.perFolder = perFolder
+	subs := slices.Clone(c.subscribers)
+	c.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	for _, fn := range subs {
+		fn(global)
+	}
+}
+
+// decode layers the defaults, InitializationOptions, and the given section
+// values into a fresh T.
+func (c *Configuration[T]) decode(layers ...json.RawMessage) (T, error) {
+	var value T
+	data, err := json.Marshal(c.defaults)
+	if err != nil {
+		return value, err
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, err
+	}
+
+	c.mu.RLock()
+	initOptions := c.initOptions
+	c.mu.RUnlock()
+
+	for _, layer := range append([]json.RawMessage{initOptions}, layers...) {
+		if len(layer) == 0 || string(layer) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(layer, &value); err != nil {
+			return value, fmt.Errorf("configuration: %w", err)
+		}
+	}
+	return value, nil
+}
+
+func (c *Configuration[T]) bind(client *Client) {
+	c.mu.Lock()
+	c.client = client
+	c.mu.Unlock()
+}
+
+func (c *Configuration[T]) initialize(params *lsp.InitializeParams) {
+	c.mu.Lock()
+	c.initOptions = append(json.RawMessage(nil), params.InitializationOptions...)
+	c.folders = initialWorkspaceFolders(params)
+	c.pull = params.Capabilities.Workspace != nil &&
+		params.Capabilities.Workspace.Configuration != nil &&
+		*params.Capabilities.Workspace.Configuration
+	c.mu.Unlock()
+
+	if global, err := c.decode(); err == nil {
+		c.update(global, make(map[lsp.DocumentURI]T))
+	}
+}
+
+// didChangeFolders applies a workspace folder change and reports whether the
+// settings need to be pulled again.
+func (c *Configuration[T]) didChangeFolders(event lsp.WorkspaceFoldersChangeEvent) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.folders = applyFolderChange(c.folders, event)
+	return c.pull && c.opts.PerFolder
+}
+
+func (c *Configuration[T]) sections() []string {
+	return c.opts.Sections
+}
+
+// didChange applies pushed settings when the client does not support
+// workspace/configuration, and otherwise reports that a fresh copy must be
+// pulled with Refresh. Pushed settings are applied before it returns, so
+// notifications handled in order apply in order.
+func (c *Configuration[T]) didChange(params *lsp.DidChangeConfigurationParams) (pull bool, err error) {
+	c.mu.RLock()
+	pull = c.pull
+	c.mu.RUnlock()
+	if pull {
+		return true, nil
+	}
+	return false, c.push(params)
+}
+
+func (c *Configuration[T]) push(params *lsp.DidChangeConfigurationParams) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	data, err := json.Marshal(params.Settings)
+	if err != nil {
+		return err
+	}
+	var layers []json.RawMessage
+	if len(c.opts.Sections) == 0 {
+		layers = append(layers, data)
+	} else {
+		var settings any
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return err
+		}
+		for _, section := range c.opts.Sections {
+			if v, ok := lookupSection(settings, section); ok {
+				raw, err := json.Marshal(v)
+				if err != nil {
+					return err
+				}
+				layers = append(layers, raw)
+			}
+		}
+	}
+
+	global, err := c.decode(layers...)
+	if err != nil {
+		return err
+	}
+	c.update(global, make(map[lsp.DocumentURI]T))
+	return nil
+}
+
+// ConfigurationSource is implemented by every [Configuration] instantiation so
+// the server can drive it without knowing the settings type.
+type ConfigurationSource interface {
+	bind(client *Client)
+	initialize(params *lsp.InitializeParams)
+	sections() []string
+	didChangeFolders(event lsp.WorkspaceFoldersChangeEvent) bool
+	didChange(params *lsp.DidChangeConfigurationParams) (pull bool, err error)
+	Refresh(ctx context.Context) error
+}
+
+// lookupSection resolves a dotted section name such as "mylang.format"
+// against a decoded settings object.
+func lookupSection(settings any, section string) (any, bool) {
+	v := settings
+	for _, key := range strings.Split(section, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// uriContains reports whether uri is folder or lies beneath it.
+func uriContains(folder, uri lsp.DocumentURI) bool {
+	f := strings.TrimSuffix(string(folder), "/")
+	return string(uri) == f || strings.HasPrefix(string(uri), f+"/")
+}
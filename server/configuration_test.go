@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+type testSettings struct {
+	TabSize int    `json:"tabSize"`
+	Name    string `json:"name"`
+	Lint    bool   `json:"lint"`
+}
+
+func waitForSettings(t *testing.T, ch <-chan testSettings) testSettings {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for configuration change")
+		return testSettings{}
+	}
+}
+
+func TestConfigurationPull(t *testing.T) {
+	var items []lsp.ConfigurationItem
+	d := jsonrpc.NewDispatcher()
+	d.RegisterMethod("workspace/configuration", func(_ context.Context, params json.RawMessage) (any, error) {
+		var p lsp.ConfigurationParams
+		_ = json.Unmarshal(params, &p)
+		items = p.Items
+		result := make([]any, len(p.Items))
+		for i, item := range p.Items {
+			if item.ScopeURI != nil {
+				result[i] = map[string]any{"tabSize": 8}
+			} else {
+				result[i] = map[string]any{"tabSize": 2}
+			}
+		}
+		return result, nil
+	})
+
+	cfg := NewConfiguration(testSettings{TabSize: 4, Name: "default", Lint: true}, ConfigurationOptions{
+		Sections:  []string{"mylang"},
+		PerFolder: true,
+	})
+	changes := make(chan testSettings, 4)
+	cfg.OnChange(func(v testSettings) { changes <- v })
+
+	conn := startClientConn(t, NewServer(&mockHandler{}, WithConfiguration(cfg)), d)
+
+	resp, err := conn.Call(t.Context(), "initialize", lsp.InitializeParams{
+		InitializationOptions: json.RawMessage(`{"name":"init"}`),
+		WorkspaceFolders:      []lsp.WorkspaceFolder{{URI: "file:///ws/a", Name: "a"}},
+		Capabilities: lsp.ClientCapabilities{
+			Workspace: &lsp.WorkspaceClientCapabilities{Configuration: &enabled},
+		},
+	})
+	if err != nil || resp.Error != nil {
+		t.Fatalf("initialize failed: %v %v", err, resp.Error)
+	}
+	if got := waitForSettings(t, changes); got.Name != "init" || got.TabSize != 4 {
+		t.Fatalf("settings after initialize = %+v", got)
+	}
+
+	if err := conn.Notify(t.Context(), "initialized", lsp.InitializedParams{}); err != nil {
+		t.Fatal(err)
+	}
+	got := waitForSettings(t, changes)
+	if got != (testSettings{TabSize: 2, Name: "init", Lint: true}) {
+		t.Fatalf("settings after pull = %+v", got)
+	}
+	if len(items) != 2 || items[0].Section != "mylang" || items[1].ScopeURI == nil || *items[1].ScopeURI != "file:///ws/a" {
+		t.Fatalf("configuration items = %+v", items)
+	}
+	if folder := cfg.For("file:///ws/a/main.go"); folder.TabSize != 8 {
+		t.Fatalf("folder settings = %+v", folder)
+	}
+	if other := cfg.For("file:///ws/b/main.go"); other.TabSize != 2 {
+		t.Fatalf("settings outside folder = %+v", other)
+	}
+}
+
+func TestConfigurationPushFallback(t *testing.T) {
+	cfg := NewConfiguration(testSettings{TabSize: 4}, ConfigurationOptions{Sections: []string{"mylang"}})
+	changes := make(chan testSettings, 4)
+	cfg.OnChange(func(v testSettings) { changes <- v })
+
+	conn := startClientConn(t, NewServer(&mockHandler{}, WithConfiguration(cfg)), jsonrpc.NewDispatcher())
+	initializeClient(t, conn, lsp.ClientCapabilities{})
+
+	err := conn.Notify(t.Context(), "workspace/didChangeConfiguration", lsp.DidChangeConfigurationParams{
+		Settings: map[string]any{"mylang": map[string]any{"tabSize": 3}, "other": map[string]any{"tabSize": 9}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := waitForSettings(t, changes); got.TabSize != 3 {
+		t.Fatalf("settings = %+v", got)
+	}
+	if cfg.Get().TabSize != 3 {
+		t.Fatalf("Get() = %+v", cfg.Get())
+	}
+}
+
+func TestConfigurationPushAppliesInOrder(t *testing.T) {
+	cfg := NewConfiguration(testSettings{}, ConfigurationOptions{})
+	changes := make(chan testSettings, 64)
+	cfg.OnChange(func(v testSettings) { changes <- v })
+
+	conn := startClientConn(t, NewServer(&mockHandler{}, WithConfiguration(cfg)), jsonrpc.NewDispatcher())
+	initializeClient(t, conn, lsp.ClientCapabilities{})
+
+	const last = 20
+	for i := 1; i <= last; i++ {
+		err := conn.Notify(t.Context(), "workspace/didChangeConfiguration", lsp.DidChangeConfigurationParams{
+			Settings: map[string]any{"tabSize": i},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for want := 1; want <= last; want++ {
+		if got := waitForSettings(t, changes); got.TabSize != want {
+			t.Fatalf("change %d applied tabSize %d", want, got.TabSize)
+		}
+	}
+	if cfg.Get().TabSize != last {
+		t.Fatalf("Get() = %+v, want the last settings", cfg.Get())
+	}
+}
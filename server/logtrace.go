@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// ClientLogHandlerOptions configures a handler created with
+// [NewClientLogHandler].
+type ClientLogHandlerOptions struct {
+	// Level is the minimum level sent to the client as window/logMessage.
+	// Records below it are sent as $/logTrace, and only while the client has
+	// tracing enabled. Defaults to slog.LevelInfo.
+	Level slog.Leveler
+
+	// TraceLevel is the minimum level sent as $/logTrace. Defaults to
+	// slog.LevelDebug.
+	TraceLevel slog.Leveler
+}
+
+// ClientLogHandler is a slog.Handler that forwards server logs to the client.
+//
+// Records at or above Level become window/logMessage notifications with a
+// matching message type. Lower records become $/logTrace notifications, which
+// honour the trace level negotiated with the client: nothing is sent while
+// tracing is off, and record attributes are sent as the verbose payload only
+// when tracing is verbose.
+type ClientLogHandler struct {
+	client     *Client
+	level      slog.Leveler
+	traceLevel slog.Leveler
+	attrs      []string
+	group      string
+}
+
+// NewClientLogHandler creates a ClientLogHandler that sends records to client.
+// opts may be nil.
+//
+// Usage, from a handler's SetClient:
+//
+//	logger := slog.New(server.NewClientLogHandler(client, nil))
+func NewClientLogHandler(client *Client, opts *ClientLogHandlerOptions) *ClientLogHandler {
+	h := &ClientLogHandler{client: client, level: slog.LevelInfo, traceLevel: slog.LevelDebug}
+	if opts != nil {
+		if opts.Level != nil {
+			h.level = opts.Level
+		}
+		if opts.TraceLevel != nil {
+			h.traceLevel = opts.TraceLevel
+		}
+	}
+	return h
+}
+
+func (h *ClientLogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if level >= h.level.Level() {
+		return true
+	}
+	return level >= h.traceLevel.Level() && h.client.Trace() != lsp.TraceOff
+}
+
+func (h *ClientLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	parts := append([]string(nil), h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		parts = append(parts, formatLogAttr(h.group, a))
+		return true
+	})
+	details := strings.Join(parts, " ")
+
+	if r.Level < h.level.Level() {
+		return h.client.LogTrace(ctx, r.Message, details)
+	}
+
+	msg := r.Message
+	if details != "" {
+		msg += " " + details
+	}
+	return h.client.LogMessage(ctx, &lsp.LogMessageParams{Type: logMessageType(r.Level), Message: msg})
+}
+
+func (h *ClientLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append([]string(nil), h.attrs...)
+	for _, a := range attrs {
+		clone.attrs = append(clone.attrs, formatLogAttr(h.group, a))
+	}
+	return &clone
+}
+
+func (h *ClientLogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.group = name
+	if h.group != "" {
+		clone.group = h.group + "." + name
+	}
+	return &clone
+}
+
+func logMessageType(level slog.Level) lsp.MessageType {
+	switch {
+	case level >= slog.LevelError:
+		return lsp.MessageTypeError
+	case level >= slog.LevelWarn:
+		return lsp.MessageTypeWarning
+	case level >= slog.LevelInfo:
+		return lsp.MessageTypeInfo
+	default:
+		return lsp.MessageTypeLog
+	}
+}
+
+func formatLogAttr(group string, a slog.Attr) string {
+	key := a.Key
+	if group != "" {
+		key = group + "." + key
+	}
+	return key + "=" + a.Value.String()
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+type clientHandler struct {
+	mockHandler
+	client *Client
+}
+
+func (h *clientHandler) SetClient(c *Client) { h.client = c }
+
+func TestClientLogHandler(t *testing.T) {
+	traces := make(chan lsp.LogTraceParams, 4)
+	logs := make(chan lsp.LogMessageParams, 4)
+	d := jsonrpc.NewDispatcher()
+	d.RegisterNotification("$/logTrace", func(_ context.Context, params json.RawMessage) error {
+		var p lsp.LogTraceParams
+		_ = json.Unmarshal(params, &p)
+		traces <- p
+		return nil
+	})
+	d.RegisterNotification("window/logMessage", func(_ context.Context, params json.RawMessage) error {
+		var p lsp.LogMessageParams
+		_ = json.Unmarshal(params, &p)
+		logs <- p
+		return nil
+	})
+
+	h := &clientHandler{}
+	conn := startClientConn(t, NewServer(h), d)
+	resp, err := conn.Call(t.Context(), "initialize", lsp.InitializeParams{Trace: string(lsp.TraceOff)})
+	if err != nil || resp.Error != nil {
+		t.Fatalf("initialize failed: %v %v", err, resp.Error)
+	}
+
+	logger := slog.New(NewClientLogHandler(h.client, nil)).With("component", "test")
+	logger.Debug("dropped while tracing is off")
+	logger.Warn("careful", "n", 1)
+
+	select {
+	case p := <-logs:
+		if p.Type != lsp.MessageTypeWarning || p.Message != "careful component=test n=1" {
+			t.Fatalf("logMessage = %+v", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for window/logMessage")
+	}
+
+	setTrace := func(value lsp.TraceValue) {
+		t.Helper()
+		if err := conn.Notify(t.Context(), "$/setTrace", lsp.SetTraceParams{Value: value}); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for h.client.Trace() != value && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if got := h.client.Trace(); got != value {
+			t.Fatalf("Trace() = %q, want %q", got, value)
+		}
+	}
+	waitTrace := func() lsp.LogTraceParams {
+		t.Helper()
+		select {
+		case p := <-traces:
+			return p
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for $/logTrace")
+			return lsp.LogTraceParams{}
+		}
+	}
+
+	setTrace(lsp.TraceVerbose)
+	logger.Debug("parsed", "file", "a.go")
+	if p := waitTrace(); p.Message != "parsed" || p.Verbose != "component=test file=a.go" {
+		t.Fatalf("verbose logTrace = %+v", p)
+	}
+
+	setTrace(lsp.TraceMessages)
+	logger.Debug("parsed", "file", "b.go")
+	if p := waitTrace(); p.Message != "parsed" || p.Verbose != "" {
+		t.Fatalf("messages logTrace = %+v", p)
+	}
+
+	select {
+	case p := <-traces:
+		t.Fatalf("unexpected $/logTrace %+v", p)
+	default:
+	}
+}
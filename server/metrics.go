@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the request
+// latency histogram buckets used by NewMetrics.
+var DefaultLatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics records, for each method, how many requests the server handled,
+// how many failed with each error code, how many were cancelled, how many are
+// in flight, and a histogram of their latency. Pass it to WithMetrics and
+// serve Handler to expose it in the OpenMetrics text format, which Prometheus
+// scrapes.
+//
+// A Metrics is safe for concurrent use, and may be shared by several servers.
+type Metrics struct {
+	buckets []float64
+
+	mu      sync.Mutex
+	methods map[string]*methodMetrics
+}
+
+type methodMetrics struct {
+	requests  uint64
+	cancelled uint64
+	inFlight  int64
+	errors    map[int]uint64
+	// counts[i] is the number of requests that took at most buckets[i]; the
+	// last element counts those slower than every bucket.
+	counts []uint64
+	sum    float64
+}
+
+// NewMetrics returns an empty Metrics with DefaultLatencyBuckets.
+func NewMetrics() *Metrics {
+	return NewMetricsWithBuckets(DefaultLatencyBuckets)
+}
+
+// NewMetricsWithBuckets returns an empty Metrics whose latency histograms use
+// the given bucket upper bounds, in seconds.
+func NewMetricsWithBuckets(buckets []float64) *Metrics {
+	b := slices.Clone(buckets)
+	slices.Sort(b)
+	return &Metrics{buckets: slices.Compact(b), methods: make(map[string]*methodMetrics)}
+}
+
+// WithMetrics records request metrics into m. When the debug UI is also
+// enabled with WithDebugUI, m is served on its /metrics endpoint.
+func WithMetrics(m *Metrics) Option {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+// MethodMetrics is a snapshot of the metrics recorded for one method.
+type MethodMetrics struct {
+	Method string
+	// Requests is the number of requests that have completed.
+	Requests uint64
+	// Errors is the number of error responses by error code.
+	Errors map[int]uint64
+	// Cancelled is the number of requests whose context was cancelled, by
+	// $/cancelRequest or the request timeout, before the handler returned.
+	Cancelled uint64
+	InFlight  int64
+	// P50, P95, and P99 are latency percentiles estimated from the
+	// histogram, by interpolating within the bucket they fall in.
+	P50, P95, P99 time.Duration
+}
+
+// Snapshot returns the metrics recorded so far, sorted by method.
+func (m *Metrics) Snapshot() []MethodMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make([]MethodMetrics, 0, len(m.methods))
+	for method, mm := range m.methods {
+		errs := make(map[int]uint64, len(mm.errors))
+		for code, n := range mm.errors {
+			errs[code] = n
+		}
+		snapshot = append(snapshot, MethodMetrics{
+			Method:    method,
+			Requests:  mm.requests,
+			Errors:    errs,
+			Cancelled: mm.cancelled,
+			InFlight:  mm.inFlight,
+			P50:       m.quantile(mm, 0.50),
+			P95:       m.quantile(mm, 0.95),
+			P99:       m.quantile(mm, 0.99),
+		})
+	}
+	slices.SortFunc(snapshot, func(a, b MethodMetrics) int { return strings.Compare(a.Method, b.Method) })
+	return snapshot
+}
+
+// quantile estimates the q-quantile of mm's latencies in the way
+// Prometheus's histogram_quantile does. Latencies above the last bucket are
+// reported as the last bucket's bound.
+func (m *Metrics) quantile(mm *methodMetrics, q float64) time.Duration {
+	if mm.requests == 0 || len(m.buckets) == 0 {
+		return 0
+	}
+	rank := q * float64(mm.requests)
+	var cumulative float64
+	for i, n := range mm.counts[:len(m.buckets)] {
+		prev := cumulative
+		cumulative += float64(n)
+		if cumulative >= rank && n > 0 {
+			lower := 0.0
+			if i > 0 {
+				lower = m.buckets[i-1]
+			}
+			seconds := lower + (m.buckets[i]-lower)*(rank-prev)/float64(n)
+			return time.Duration(seconds * float64(time.Second))
+		}
+	}
+	return time.Duration(m.buckets[len(m.buckets)-1] * float64(time.Second))
+}
+
+// observe is the jsonrpc request hook that records a request.
+func (m *Metrics) observe(ctx context.Context, req *jsonrpc.Request) (context.Context, func(*jsonrpc.Response)) {
+	method := req.Method
+	start := time.Now()
+	m.mu.Lock()
+	m.method(method).inFlight++
+	m.mu.Unlock()
+
+	return ctx, func(resp *jsonrpc.Response) {
+		seconds := time.Since(start).Seconds()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		mm := m.method(method)
+		mm.inFlight--
+		mm.requests++
+		if resp.Error != nil {
+			mm.errors[resp.Error.Code]++
+		}
+		if ctx.Err() != nil {
+			mm.cancelled++
+		}
+		i, _ := slices.BinarySearch(m.buckets, seconds)
+		mm.counts[i]++
+		mm.sum += seconds
+	}
+}
+
+// method returns the metrics for method, creating them. m.mu must be held.
+func (m *Metrics) method(method string) *methodMetrics {
+	mm, ok := m.methods[method]
+	if !ok {
+		mm = &methodMetrics{errors: make(map[int]uint64), counts: make([]uint64, len(m.buckets)+1)}
+		m.methods[method] = mm
+	}
+	return mm
+}
+
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Handler returns an http.Handler that serves the metrics in the OpenMetrics
+// text format.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", openMetricsContentType)
+		_ = m.WriteOpenMetrics(w)
+	})
+}
+
+// WriteOpenMetrics writes the metrics to w in the OpenMetrics text format.
+func (m *Metrics) WriteOpenMetrics(w io.Writer) error {
+	m.mu.Lock()
+	methods := make([]string, 0, len(m.methods))
+	for method := range m.methods {
+		methods = append(methods, method)
+	}
+	slices.Sort(methods)
+
+	var b strings.Builder
+	b.WriteString("# TYPE lsp_requests counter\n# HELP lsp_requests Requests handled, by method.\n")
+	for _, method := range methods {
+		fmt.Fprintf(&b, "lsp_requests_total{method=%s} %d\n", quoteLabel(method), m.methods[method].requests)
+	}
+
+	b.WriteString("# TYPE lsp_request_errors counter\n# HELP lsp_request_errors Error responses, by method and error code.\n")
+	for _, method := range methods {
+		mm := m.methods[method]
+		codes := make([]int, 0, len(mm.errors))
+		for code := range mm.errors {
+			codes = append(codes, code)
+		}
+		slices.Sort(codes)
+		for _, code := range codes {
+			fmt.Fprintf(&b, "lsp_request_errors_total{method=%s,code=\"%d\"} %d\n", quoteLabel(method), code, mm.errors[code])
+		}
+	}
+
+	b.WriteString("# TYPE lsp_requests_cancelled counter\n# HELP lsp_requests_cancelled Requests cancelled by the client or the request timeout, by method.\n")
+	for _, method := range methods {
+		fmt.Fprintf(&b, "lsp_requests_cancelled_total{method=%s} %d\n", quoteLabel(method), m.methods[method].cancelled)
+	}
+
+	b.WriteString("# TYPE lsp_requests_in_flight gauge\n# HELP lsp_requests_in_flight Requests being handled, by method.\n")
+	for _, method := range methods {
+		fmt.Fprintf(&b, "lsp_requests_in_flight{method=%s} %d\n", quoteLabel(method), m.methods[method].inFlight)
+	}
+
+	b.WriteString("# TYPE lsp_request_duration_seconds histogram\n# HELP lsp_request_duration_seconds Time taken to handle requests, by method.\n")
+	for _, method := range methods {
+		mm := m.methods[method]
+		label := quoteLabel(method)
+		var cumulative uint64
+		for i, bound := range m.buckets {
+			cumulative += mm.counts[i]
+			fmt.Fprintf(&b, "lsp_request_duration_seconds_bucket{method=%s,le=\"%s\"} %d\n", label, formatFloat(bound), cumulative)
+		}
+		cumulative += mm.counts[len(m.buckets)]
+		fmt.Fprintf(&b, "lsp_request_duration_seconds_bucket{method=%s,le=\"+Inf\"} %d\n", label, cumulative)
+		fmt.Fprintf(&b, "lsp_request_duration_seconds_count{method=%s} %d\n", label, cumulative)
+		fmt.Fprintf(&b, "lsp_request_duration_seconds_sum{method=%s} %s\n", label, formatFloat(mm.sum))
+	}
+	m.mu.Unlock()
+
+	b.WriteString("# EOF\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
+)
+
+func TestMetricsRecordsRequests(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	metrics := NewMetrics()
+	s := NewServer(&slowHoverHandler{delay: 2 * time.Second}, WithRequestTimeout(50*time.Millisecond), WithMetrics(metrics))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go func() {
+		_ = s.Run(ctx, pipeRWC{Reader: serverReader, Writer: serverWriter})
+	}()
+
+	clientConn := jsonrpc.NewConn(pipeRWC{Reader: clientReader, Writer: clientWriter}, jsonrpc.NewDispatcher())
+	for i, method := range []string{"initialize", "textDocument/hover", "no/such/method"} {
+		req, _ := jsonrpc.NewRequest(jsonrpc.IntID(int64(i+1)), method, map[string]any{})
+		if err := clientConn.WriteMessage(req); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := clientConn.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot) != 3 {
+		t.Fatalf("snapshot = %+v, want three methods", snapshot)
+	}
+	initialize, missing, hover := snapshot[0], snapshot[1], snapshot[2]
+	if initialize.Method != "initialize" || initialize.Requests != 1 || len(initialize.Errors) != 0 || initialize.InFlight != 0 {
+		t.Errorf("initialize = %+v", initialize)
+	}
+	if hover.Requests != 1 || hover.Cancelled != 1 || hover.Errors[jsonrpc.CodeRequestCancelled] != 1 {
+		t.Errorf("hover = %+v, want one cancelled request", hover)
+	}
+	if hover.P50 < 25*time.Millisecond || hover.P99 > 100*time.Millisecond {
+		t.Errorf("hover latency p50 = %v, p99 = %v, want around the 50ms timeout", hover.P50, hover.P99)
+	}
+	if missing.Errors[jsonrpc.CodeMethodNotFound] != 1 || missing.Cancelled != 0 {
+		t.Errorf("no/such/method = %+v", missing)
+	}
+}
+
+func TestMetricsOpenMetrics(t *testing.T) {
+	m := NewMetricsWithBuckets([]float64{0.1, 0.01})
+	_, done := m.observe(t.Context(), &jsonrpc.Request{Method: `odd"method`})
+	done(&jsonrpc.Response{})
+	_, done = m.observe(t.Context(), &jsonrpc.Request{Method: "textDocument/hover"})
+	done(jsonrpc.NewErrorResponse(jsonrpc.IntID(1), jsonrpc.NewError(jsonrpc.CodeInternalError, "boom")))
+	m.observe(t.Context(), &jsonrpc.Request{Method: "textDocument/hover"}) // still in flight
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Fatalf("content type = %q", ct)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE lsp_requests counter\n",
+		`lsp_requests_total{method="odd\"method"} 1`,
+		`lsp_requests_total{method="textDocument/hover"} 1`,
+		`lsp_request_errors_total{method="textDocument/hover",code="-32603"} 1`,
+		`lsp_requests_cancelled_total{method="textDocument/hover"} 0`,
+		`lsp_requests_in_flight{method="textDocument/hover"} 1`,
+		`lsp_request_duration_seconds_bucket{method="textDocument/hover",le="0.01"} 1`,
+		`lsp_request_duration_seconds_bucket{method="textDocument/hover",le="+Inf"} 1`,
+		`lsp_request_duration_seconds_count{method="textDocument/hover"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("metrics do not end with # EOF:\n%s", body)
+	}
+}
+
+func TestMetricsQuantiles(t *testing.T) {
+	m := NewMetricsWithBuckets([]float64{0.01, 0.1, 1})
+	mm := m.method("textDocument/completion")
+	// 90 requests at up to 10ms, 9 at up to 100ms, and one over a second.
+	mm.counts = []uint64{90, 9, 0, 1}
+	mm.requests = 100
+
+	got := m.Snapshot()[0]
+	for _, q := range []struct {
+		name      string
+		got, want time.Duration
+	}{
+		{"p50", got.P50, 5556 * time.Microsecond}, // 50/90 of the way into the first bucket
+		{"p95", got.P95, 60 * time.Millisecond},   // 5/9 of the way into the second
+		{"p99", got.P99, 100 * time.Millisecond},  // the end of the second
+	} {
+		if diff := q.got - q.want; diff < -time.Microsecond || diff > time.Microsecond {
+			t.Errorf("%s = %v, want %v", q.name, q.got, q.want)
+		}
+	}
+}
@@ -10,7 +10,15 @@ import (
 // Option configures a Server.
 type Option func(*Server)
 
-// WithDebugUI enables the debug web UI on the given address (e.g. ":7100").
+// WithDebugUI enables the debug web UI on the given address (e.g.
+// "localhost:7100"). The UI only listens on loopback: an address without a
+// host, such as ":7100", listens on 127.0.0.1, and any other address fails to
+// bind unless WithDebugUIAllowRemote is set. An address of the form
+// "unix:/path/to/socket" serves the UI on a Unix socket instead.
+//
+// The API and websocket need a token that is random for each Run. The URL to
+// open, including the token, is printed to the standard logger when the UI
+// starts.
 //
 // This implies WithDebugCapture: even if the HTTP listener fails to bind (for
 // example on a locked-down corporate machine), capture remains active so trace
@@ -23,6 +31,16 @@ func WithDebugUI(addr string) Option {
 	}
 }
 
+// WithDebugUIAllowRemote lets the debug UI listen on addresses other than
+// loopback, so it can be opened from another machine, such as the host of a
+// container. The token is still required, but it and the captured source code
+// travel over plain HTTP.
+func WithDebugUIAllowRemote() Option {
+	return func(s *Server) {
+		s.debugAllowRemote = true
+	}
+}
+
 // WithDebugCapture enables in-memory capture of LSP traffic and logs without
 // starting the HTTP debug UI. Capture has no port to bind, so it is safe to
 // enable by default in production builds. The captured data feeds
@@ -33,6 +51,22 @@ func WithDebugCapture() Option {
 	}
 }
 
+// WithDebugTraceFile streams every captured message and log to path as JSON
+// Lines while the server runs, so a long session can be inspected after the
+// in-memory capture has dropped its oldest entries, or after a crash. It
+// implies WithDebugCapture. See TraceFileOptions for rotation and redaction,
+// and LoadDebugTraceFile for reading the files back.
+//
+// If path cannot be opened, the failure is logged via the configured
+// WithLogger and the server runs without streaming.
+func WithDebugTraceFile(path string, opts TraceFileOptions) Option {
+	return func(s *Server) {
+		s.traceFilePath = path
+		s.traceFileOptions = opts
+		s.debugCapture = true
+	}
+}
+
 // WithLogger sets a logger for the server. The server logs lifecycle events,
 // method dispatch, and errors. If not set, no logging is performed.
 func WithLogger(logger *slog.Logger) Option {
@@ -51,6 +85,37 @@ func WithRequestTimeout(d time.Duration) Option {
 	}
 }
 
+// WithConfiguration enables pulling settings with workspace/configuration into
+// cfg, which is refreshed after initialization and whenever the client sends
+// workspace/didChangeConfiguration.
+func WithConfiguration(cfg ConfigurationSource) Option {
+	return func(s *Server) {
+		s.configuration = cfg
+	}
+}
+
+// WithWorkspaceFolders enables tracking of the client's workspace folders in
+// folders and advertises workspace folder support with change notifications.
+func WithWorkspaceFolders(folders *WorkspaceFolders) Option {
+	return func(s *Server) {
+		s.workspaceFolders = folders
+	}
+}
+
+// WithParentProcessWatch makes Run stop with [ErrParentProcessExited] when the
+// parent process named in InitializeParams.ProcessID exits, as the LSP
+// specification requires. The process is polled every interval; a
+// non-positive interval uses a default of three seconds.
+func WithParentProcessWatch(interval time.Duration) Option {
+	return func(s *Server) {
+		if interval <= 0 {
+			interval = defaultParentPollInterval
+		}
+		s.parentPollInterval = interval
+		s.parentPID = make(chan int, 1)
+	}
+}
+
 // CapabilityOptions configures detailed server capabilities that cannot be
 // inferred from handler interfaces alone.
 //
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrParentProcessExited is returned by [Server.Run] when the parent process
+// named in InitializeParams.ProcessID is no longer running.
+var ErrParentProcessExited = errors.New("parent process exited")
+
+// defaultParentPollInterval is used when WithParentProcessWatch is given a
+// non-positive interval.
+const defaultParentPollInterval = 3 * time.Second
+
+// serveWatchingParent serves the connection until it closes or the parent
+// process reported in initialize exits. The parent is not watched until the
+// client has sent a processId.
+func (s *Server) serveWatchingParent(ctx context.Context, rw io.ReadWriteCloser) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	go s.watchParent(ctx, cancel)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.conn.Serve(ctx)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		if cause := context.Cause(ctx); errors.Is(cause, ErrParentProcessExited) {
+			// Serve may be blocked reading a stream that never closes, such
+			// as stdin, so don't wait for it.
+			_ = rw.Close()
+			return cause
+		}
+		return <-errc
+	}
+}
+
+func (s *Server) watchParent(ctx context.Context, cancel context.CancelCauseFunc) {
+	var pid int
+	select {
+	case pid = <-s.parentPID:
+	case <-ctx.Done():
+		return
+	}
+
+	ticker := time.NewTicker(s.parentPollInterval)
+	defer ticker.Stop()
+	for {
+		if !processAlive(pid) {
+			if s.logger != nil {
+				s.logger.Warn("parent process exited, stopping server", "pid", pid)
+			}
+			cancel(fmt.Errorf("%w: pid %d", ErrParentProcessExited, pid))
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// runWatchingParent initializes a server that watches pid and returns the
+// channel Run's result is delivered on.
+func runWatchingParent(t *testing.T, pid int) <-chan error {
+	t.Helper()
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	s := NewServer(&mockHandler{}, WithParentProcessWatch(10*time.Millisecond))
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(t.Context(), pipeRWC{Reader: serverReader, Writer: serverWriter})
+	}()
+
+	conn := jsonrpc.NewConn(pipeRWC{Reader: clientReader, Writer: clientWriter}, jsonrpc.NewDispatcher())
+	req, _ := jsonrpc.NewRequest(jsonrpc.IntID(1), "initialize", lsp.InitializeParams{ProcessID: &pid})
+	if err := conn.WriteMessage(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	return done
+}
+
+func TestParentProcessWatchExits(t *testing.T) {
+	// The test binary with no matching tests exits almost immediately.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = cmd.Wait() }()
+
+	done := runWatchingParent(t, cmd.Process.Pid)
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrParentProcessExited) {
+			t.Fatalf("Run() error = %v, want ErrParentProcessExited", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not stop after the parent process exited")
+	}
+}
+
+func TestParentProcessWatchAlive(t *testing.T) {
+	done := runWatchingParent(t, os.Getpid())
+	select {
+	case err := <-done:
+		t.Fatalf("Run() returned %v while the parent is alive", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestParentProcessWatchContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	s := NewServer(&mockHandler{}, WithParentProcessWatch(0))
+	if s.parentPollInterval != defaultParentPollInterval {
+		t.Fatalf("interval = %v, want default", s.parentPollInterval)
+	}
+
+	serverReader, clientWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(ctx, pipeRWC{Reader: serverReader, Writer: io.Discard})
+	}()
+	cancel()
+	_ = clientWriter.Close()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Run() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not stop after cancellation")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package server
+
+import "os"
+
+// processAlive reports whether pid names a running process.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
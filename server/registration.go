@@ -0,0 +1,333 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// ErrDynamicRegistrationUnsupported is returned when the client does not
+// support dynamic registration for a method and the registration can no longer
+// be folded into the static capabilities returned from initialize.
+var ErrDynamicRegistrationUnsupported = errors.New("dynamic registration unsupported")
+
+// ErrUnknownRegistration is returned when unregistering a handle that is not
+// active.
+var ErrUnknownRegistration = errors.New("unknown registration")
+
+// Registration is a handle to a capability registered through [Registrations].
+type Registration struct {
+	// ID is the identifier sent to the client in client/registerCapability.
+	ID string
+	// Method is the registered method, e.g. "workspace/didChangeWatchedFiles".
+	Method string
+	// Options are the registration options as sent to the client.
+	Options json.RawMessage
+	// Static is true when the client does not support dynamic registration
+	// for Method and the registration was advertised in the initialize result
+	// instead. Static registrations cannot be unregistered.
+	Static bool
+}
+
+// registrationCapability maps a registrable method to the client capability
+// that gates dynamic registration and the server capability used as a static
+// fallback.
+type registrationCapability struct {
+	client []string
+	server string
+	// boolean is true when the server capability is a plain boolean rather
+	// than an options object.
+	boolean bool
+}
+
+var registrationCapabilities = map[string]registrationCapability{
+	"textDocument/didOpen":              {client: []string{"textDocument", "synchronization"}},
+	"textDocument/didChange":            {client: []string{"textDocument", "synchronization"}},
+	"textDocument/didClose":             {client: []string{"textDocument", "synchronization"}},
+	"textDocument/didSave":              {client: []string{"textDocument", "synchronization"}},
+	"textDocument/willSave":             {client: []string{"textDocument", "synchronization"}},
+	"textDocument/willSaveWaitUntil":    {client: []string{"textDocument", "synchronization"}},
+	"textDocument/completion":           {client: []string{"textDocument", "completion"}, server: "completionProvider"},
+	"textDocument/hover":                {client: []string{"textDocument", "hover"}, server: "hoverProvider", boolean: true},
+	"textDocument/signatureHelp":        {client: []string{"textDocument", "signatureHelp"}, server: "signatureHelpProvider"},
+	"textDocument/declaration":          {client: []string{"textDocument", "declaration"}, server: "declarationProvider", boolean: true},
+	"textDocument/definition":           {client: []string{"textDocument", "definition"}, server: "definitionProvider", boolean: true},
+	"textDocument/typeDefinition":       {client: []string{"textDocument", "typeDefinition"}, server: "typeDefinitionProvider", boolean: true},
+	"textDocument/implementation":       {client: []string{"textDocument", "implementation"}, server: "implementationProvider", boolean: true},
+	"textDocument/references":           {client: []string{"textDocument", "references"}, server: "referencesProvider", boolean: true},
+	"textDocument/documentHighlight":    {client: []string{"textDocument", "documentHighlight"}, server: "documentHighlightProvider", boolean: true},
+	"textDocument/documentSymbol":       {client: []string{"textDocument", "documentSymbol"}, server: "documentSymbolProvider", boolean: true},
+	"textDocument/codeAction":           {client: []string{"textDocument", "codeAction"}, server: "codeActionProvider"},
+	"textDocument/codeLens":             {client: []string{"textDocument", "codeLens"}, server: "codeLensProvider"},
+	"textDocument/documentLink":         {client: []string{"textDocument", "documentLink"}, server: "documentLinkProvider"},
+	"textDocument/documentColor":        {client: []string{"textDocument", "colorProvider"}, server: "colorProvider", boolean: true},
+	"textDocument/formatting":           {client: []string{"textDocument", "formatting"}, server: "documentFormattingProvider", boolean: true},
+	"textDocument/rangeFormatting":      {client: []string{"textDocument", "rangeFormatting"}, server: "documentRangeFormattingProvider", boolean: true},
+	"textDocument/onTypeFormatting":     {client: []string{"textDocument", "onTypeFormatting"}, server: "documentOnTypeFormattingProvider"},
+	"textDocument/rename":               {client: []string{"textDocument", "rename"}, server: "renameProvider"},
+	"textDocument/foldingRange":         {client: []string{"textDocument", "foldingRange"}, server: "foldingRangeProvider", boolean: true},
+	"textDocument/selectionRange":       {client: []string{"textDocument", "selectionRange"}, server: "selectionRangeProvider", boolean: true},
+	"textDocument/linkedEditingRange":   {client: []string{"textDocument", "linkedEditingRange"}, server: "linkedEditingRangeProvider", boolean: true},
+	"textDocument/prepareCallHierarchy": {client: []string{"textDocument", "callHierarchy"}, server: "callHierarchyProvider", boolean: true},
+	"textDocument/semanticTokens":       {client: []string{"textDocument", "semanticTokens"}, server: "semanticTokensProvider"},
+	"textDocument/moniker":              {client: []string{"textDocument", "moniker"}, server: "monikerProvider", boolean: true},
+	"textDocument/prepareTypeHierarchy": {client: []string{"textDocument", "typeHierarchy"}, server: "typeHierarchyProvider", boolean: true},
+	"textDocument/inlayHint":            {client: []string{"textDocument", "inlayHint"}, server: "inlayHintProvider"},
+	"textDocument/inlineValue":          {client: []string{"textDocument", "inlineValue"}, server: "inlineValueProvider", boolean: true},
+	"textDocument/diagnostic":           {client: []string{"textDocument", "diagnostic"}, server: "diagnosticProvider"},
+	"workspace/symbol":                  {client: []string{"workspace", "symbol"}, server: "workspaceSymbolProvider", boolean: true},
+	"workspace/executeCommand":          {client: []string{"workspace", "executeCommand"}, server: "executeCommandProvider"},
+	"workspace/didChangeConfiguration":  {client: []string{"workspace", "didChangeConfiguration"}},
+	"workspace/didChangeWatchedFiles":   {client: []string{"workspace", "didChangeWatchedFiles"}},
+}
+
+// Registrations manages capabilities registered with the client at runtime
+// through client/registerCapability.
+//
+// Register may be called from Initialize: registrations are queued and sent
+// once the client confirms with the initialized notification. If the client
+// does not support dynamic registration for a method, a registration made
+// during Initialize is folded into the static capabilities of the initialize
+// result instead.
+//
+// Register and Unregister wait for the client's response, so they must not be
+// called directly from a notification handler, which runs on the connection's
+// read loop.
+type Registrations struct {
+	client *Client
+	logger *slog.Logger
+
+	mu          sync.Mutex
+	nextID      int
+	clientCaps  json.RawMessage
+	initialized bool
+	ready       bool
+	active      []Registration
+	pending     []Registration
+	static      []Registration
+}
+
+func newRegistrations(client *Client) *Registrations {
+	return &Registrations{client: client}
+}
+
+// SupportsDynamic reports whether the client declared dynamicRegistration
+// support for method in its initialize capabilities.
+func (r *Registrations) SupportsDynamic(method string) bool {
+	r.mu.Lock()
+	caps := r.clientCaps
+	r.mu.Unlock()
+
+	rc, ok := registrationCapabilities[method]
+	if !ok || len(rc.client) == 0 || caps == nil {
+		return false
+	}
+
+	var v any
+	if err := json.Unmarshal(caps, &v); err != nil {
+		return false
+	}
+	for _, key := range rc.client {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return false
+		}
+		v = m[key]
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return false
+	}
+	dynamic, _ := m["dynamicRegistration"].(bool)
+	return dynamic
+}
+
+// Register registers method with the client using the given registration
+// options, which may be nil. The returned handle can be passed to Unregister.
+func (r *Registrations) Register(ctx context.Context, method string, options any) (Registration, error) {
+	var raw json.RawMessage
+	if options != nil {
+		data, err := json.Marshal(options)
+		if err != nil {
+			return Registration{}, err
+		}
+		raw = data
+	}
+
+	dynamic := r.SupportsDynamic(method)
+
+	r.mu.Lock()
+	r.nextID++
+	reg := Registration{
+		ID:      fmt.Sprintf("go-lsp-%d", r.nextID),
+		Method:  method,
+		Options: raw,
+	}
+
+	if !dynamic {
+		defer r.mu.Unlock()
+		if r.initialized || registrationCapabilities[method].server == "" {
+			return Registration{}, fmt.Errorf("%w: %s", ErrDynamicRegistrationUnsupported, method)
+		}
+		reg.Static = true
+		r.static = append(r.static, reg)
+		return reg, nil
+	}
+
+	if !r.ready {
+		r.pending = append(r.pending, reg)
+		r.mu.Unlock()
+		return reg, nil
+	}
+	r.mu.Unlock()
+
+	if err := r.send(ctx, []Registration{reg}); err != nil {
+		return Registration{}, err
+	}
+	return reg, nil
+}
+
+// Unregister removes a dynamic registration from the client.
+func (r *Registrations) Unregister(ctx context.Context, reg Registration) error {
+	if reg.Static {
+		return fmt.Errorf("%w: static registration %s cannot be unregistered", ErrUnknownRegistration, reg.ID)
+	}
+
+	r.mu.Lock()
+	for i, p := range r.pending {
+		if p.ID == reg.ID {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			r.mu.Unlock()
+			return nil
+		}
+	}
+	if !slices.ContainsFunc(r.active, func(a Registration) bool { return a.ID == reg.ID }) {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownRegistration, reg.ID)
+	}
+	r.mu.Unlock()
+
+	err := r.client.UnregisterCapability(ctx, &lsp.UnregistrationParams{
+		Unregisterations: []lsp.Unregistration{{ID: reg.ID, Method: reg.Method}},
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.active = slices.DeleteFunc(r.active, func(a Registration) bool { return a.ID == reg.ID })
+	r.mu.Unlock()
+	return nil
+}
+
+// Active returns the dynamic registrations currently acknowledged by the
+// client, in registration order.
+func (r *Registrations) Active() []Registration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Registration(nil), r.active...)
+}
+
+func (r *Registrations) send(ctx context.Context, regs []Registration) error {
+	params := &lsp.RegistrationParams{Registrations: make([]lsp.Registration, len(regs))}
+	for i, reg := range regs {
+		params.Registrations[i] = lsp.Registration{ID: reg.ID, Method: reg.Method, RegisterOptions: reg.Options}
+	}
+	if err := r.client.RegisterCapability(ctx, params); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.active = append(r.active, regs...)
+	r.mu.Unlock()
+	return nil
+}
+
+// setClientCapabilities records the capabilities from the initialize request.
+func (r *Registrations) setClientCapabilities(caps lsp.ClientCapabilities) {
+	data, err := json.Marshal(caps)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	r.clientCaps = data
+	r.mu.Unlock()
+}
+
+// applyStatic folds static fallback registrations into the initialize result
+// and stops accepting new ones. Capabilities the handler already set are kept.
+func (r *Registrations) applyStatic(caps *lsp.ServerCapabilities) {
+	r.mu.Lock()
+	r.initialized = true
+	static := append([]Registration(nil), r.static...)
+	r.mu.Unlock()
+
+	if len(static) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(caps)
+	if err != nil {
+		r.logStaticError(err)
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		r.logStaticError(err)
+		return
+	}
+	for _, reg := range static {
+		rc := registrationCapabilities[reg.Method]
+		if v, ok := fields[rc.server]; ok && string(v) != "null" {
+			continue
+		}
+		value := reg.Options
+		switch {
+		case rc.boolean:
+			value = json.RawMessage("true")
+		case len(value) == 0 || string(value) == "null":
+			value = json.RawMessage("{}")
+		}
+		fields[rc.server] = value
+	}
+	data, err = json.Marshal(fields)
+	if err != nil {
+		r.logStaticError(err)
+		return
+	}
+	var merged lsp.ServerCapabilities
+	if err := json.Unmarshal(data, &merged); err != nil {
+		r.logStaticError(err)
+		return
+	}
+	*caps = merged
+}
+
+func (r *Registrations) logStaticError(err error) {
+	if r.logger != nil {
+		r.logger.Error("static registration fallback failed", "error", err)
+	}
+}
+
+// flush sends registrations queued before the initialized notification.
+func (r *Registrations) flush(ctx context.Context) {
+	r.mu.Lock()
+	r.initialized = true
+	r.ready = true
+	pending := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	if err := r.send(ctx, pending); err != nil && r.logger != nil {
+		r.logger.Error("dynamic registration failed", "count", len(pending), "error", err)
+	}
+}
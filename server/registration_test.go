@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+type registrationHandler struct {
+	client  *Client
+	method  string
+	options any
+	reg     Registration
+	regErr  error
+}
+
+func (h *registrationHandler) SetClient(c *Client) { h.client = c }
+
+func (h *registrationHandler) Initialize(ctx context.Context, _ *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	h.reg, h.regErr = h.client.Registrations().Register(ctx, h.method, h.options)
+	return &lsp.InitializeResult{}, nil
+}
+
+func (h *registrationHandler) Shutdown(_ context.Context) error { return nil }
+
+// startClientConn runs s over in-memory pipes and returns a client-side
+// connection that dispatches server→client requests to d.
+func startClientConn(t *testing.T, s *Server, d *jsonrpc.Dispatcher) *jsonrpc.Conn {
+	t.Helper()
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	t.Cleanup(cancel)
+
+	go func() {
+		_ = s.Run(ctx, pipeRWC{Reader: serverReader, Writer: serverWriter})
+	}()
+
+	conn := jsonrpc.NewConn(pipeRWC{Reader: clientReader, Writer: clientWriter}, d)
+	go func() {
+		_ = conn.Serve(ctx)
+	}()
+	return conn
+}
+
+func initializeClient(t *testing.T, conn *jsonrpc.Conn, caps lsp.ClientCapabilities) lsp.InitializeResult {
+	t.Helper()
+	resp, err := conn.Call(t.Context(), "initialize", lsp.InitializeParams{Capabilities: caps})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != nil {
+		t.Fatalf("initialize failed: %s", resp.Error.Message)
+	}
+	var result lsp.InitializeResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Notify(t.Context(), "initialized", lsp.InitializedParams{}); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestRegistrationsDynamic(t *testing.T) {
+	registered := make(chan lsp.RegistrationParams, 1)
+	unregistered := make(chan lsp.UnregistrationParams, 1)
+	d := jsonrpc.NewDispatcher()
+	d.RegisterMethod("client/registerCapability", func(_ context.Context, params json.RawMessage) (any, error) {
+		var p lsp.RegistrationParams
+		_ = json.Unmarshal(params, &p)
+		registered <- p
+		return nil, nil
+	})
+	d.RegisterMethod("client/unregisterCapability", func(_ context.Context, params json.RawMessage) (any, error) {
+		var p lsp.UnregistrationParams
+		_ = json.Unmarshal(params, &p)
+		unregistered <- p
+		return nil, nil
+	})
+
+	h := &registrationHandler{
+		method: "workspace/didChangeWatchedFiles",
+		options: lsp.DidChangeWatchedFilesRegistrationOptions{
+			Watchers: []lsp.FileSystemWatcher{{GlobPattern: "**/*.go"}},
+		},
+	}
+	conn := startClientConn(t, NewServer(h), d)
+	initializeClient(t, conn, lsp.ClientCapabilities{
+		Workspace: &lsp.WorkspaceClientCapabilities{
+			DidChangeWatchedFiles: &lsp.DynamicRegistrationCapability{DynamicRegistration: &enabled},
+		},
+	})
+
+	if h.regErr != nil {
+		t.Fatal(h.regErr)
+	}
+	if h.reg.Static {
+		t.Fatal("expected a dynamic registration")
+	}
+
+	var p lsp.RegistrationParams
+	select {
+	case p = <-registered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for client/registerCapability")
+	}
+	if len(p.Registrations) != 1 || p.Registrations[0].ID != h.reg.ID || p.Registrations[0].Method != h.method {
+		t.Fatalf("registrations = %+v", p.Registrations)
+	}
+
+	regs := h.client.Registrations()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(regs.Active()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := regs.Active(); len(got) != 1 || got[0].ID != h.reg.ID {
+		t.Fatalf("active = %+v", got)
+	}
+
+	if err := regs.Unregister(t.Context(), h.reg); err != nil {
+		t.Fatal(err)
+	}
+	u := <-unregistered
+	if len(u.Unregisterations) != 1 || u.Unregisterations[0].ID != h.reg.ID {
+		t.Fatalf("unregistrations = %+v", u.Unregisterations)
+	}
+	if got := regs.Active(); len(got) != 0 {
+		t.Fatalf("active after unregister = %+v", got)
+	}
+	if err := regs.Unregister(t.Context(), h.reg); !errors.Is(err, ErrUnknownRegistration) {
+		t.Fatalf("second unregister error = %v, want ErrUnknownRegistration", err)
+	}
+}
+
+// presetCapsHandler advertises completion itself and also registers it.
+type presetCapsHandler struct {
+	registrationHandler
+}
+
+func (h *presetCapsHandler) Initialize(ctx context.Context, p *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	if _, err := h.registrationHandler.Initialize(ctx, p); err != nil {
+		return nil, err
+	}
+	return &lsp.InitializeResult{Capabilities: lsp.ServerCapabilities{
+		CompletionProvider: &lsp.CompletionOptions{TriggerCharacters: []string{"."}},
+	}}, nil
+}
+
+func TestRegistrationsStaticFallbackKeepsHandlerCapabilities(t *testing.T) {
+	h := &presetCapsHandler{registrationHandler{
+		method:  "textDocument/completion",
+		options: lsp.CompletionOptions{TriggerCharacters: []string{":"}},
+	}}
+	conn := startClientConn(t, NewServer(h), jsonrpc.NewDispatcher())
+	result := initializeClient(t, conn, lsp.ClientCapabilities{})
+
+	if h.regErr != nil || !h.reg.Static {
+		t.Fatalf("registration = %+v, %v, want a static registration", h.reg, h.regErr)
+	}
+	cp := result.Capabilities.CompletionProvider
+	if cp == nil || len(cp.TriggerCharacters) != 1 || cp.TriggerCharacters[0] != "." {
+		t.Fatalf("completionProvider = %+v, want the handler's", cp)
+	}
+}
+
+func TestRegistrationsStaticFallback(t *testing.T) {
+	h := &registrationHandler{method: "textDocument/formatting"}
+	conn := startClientConn(t, NewServer(h), jsonrpc.NewDispatcher())
+	result := initializeClient(t, conn, lsp.ClientCapabilities{})
+
+	if h.regErr != nil {
+		t.Fatal(h.regErr)
+	}
+	if !h.reg.Static {
+		t.Fatal("expected a static registration")
+	}
+	if result.Capabilities.DocumentFormattingProvider == nil || !*result.Capabilities.DocumentFormattingProvider {
+		t.Fatal("expected documentFormattingProvider in initialize result")
+	}
+
+	_, err := h.client.Registrations().Register(t.Context(), "textDocument/rangeFormatting", nil)
+	if !errors.Is(err, ErrDynamicRegistrationUnsupported) {
+		t.Fatalf("error = %v, want ErrDynamicRegistrationUnsupported", err)
+	}
+}
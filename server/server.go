@@ -3,9 +3,11 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/owenrumney/go-lsp/internal/debugui"
@@ -19,16 +21,28 @@ type Server struct {
 	conn                *jsonrpc.Conn
 	Client              *Client
 	initialized         bool
-	shutdown            bool
+	shutdown            atomic.Bool
+	exited              atomic.Bool
 	customMethods       map[string]jsonrpc.MethodHandler
 	customNotifications map[string]jsonrpc.NotificationHandler
 	debugAddr           string
 	debugCapture        bool
+	debugAllowRemote    bool
+	traceFilePath       string
+	traceFileOptions    TraceFileOptions
 	recorder            *debugui.Recorder
 	debugUI             *debugui.DebugUI
 	logger              *slog.Logger
 	requestTimeout      time.Duration
+	metrics             *Metrics
+	slowThreshold       time.Duration
+	slow                *slowRequests
+	tracer              Tracer
 	capabilityOptions   CapabilityOptions
+	configuration       ConfigurationSource
+	workspaceFolders    *WorkspaceFolders
+	parentPollInterval  time.Duration
+	parentPID           chan int
 }
 
 // NewServer creates a new LSP server with the given handler.
@@ -50,6 +64,11 @@ func NewServer(handler LifecycleHandler, opts ...Option) *Server {
 // neither WithDebugCapture nor WithDebugUI was set. Must be called after Run
 // has started.
 //
+// Records keep their attributes, and records logged with a handler's context,
+// as with logger.InfoContext(ctx, ...), are tagged with the ID and method of
+// the request or notification being handled, so the debug UI can show the
+// logs for each request.
+//
 // Usage: logger := slog.New(srv.DebugHandler())
 func (s *Server) DebugHandler() slog.Handler {
 	if s.recorder == nil {
@@ -70,20 +89,17 @@ func (s *Server) HandleNotification(method string, handler jsonrpc.NotificationH
 	s.customNotifications[method] = handler
 }
 
-// Run starts the server, reading from and writing to rw.
+// Run starts the server, reading from and writing to rw. It returns when the
+// input ends, with nil if the client had sent shutdown and then exit, and
+// with the read error otherwise.
 func (s *Server) Run(ctx context.Context, rw io.ReadWriteCloser) error {
 	if s.debugCapture || s.debugAddr != "" {
 		s.recorder = debugui.NewRecorder()
 		rw = s.recorder.Tap(rw)
 	}
-	if s.debugAddr != "" {
-		s.debugUI = debugui.New(s.debugAddr, s.recorder)
-		if err := s.debugUI.ListenAndServe(ctx); err != nil {
-			if s.logger != nil {
-				s.logger.Warn("debugui: HTTP UI unavailable, continuing with capture only",
-					"addr", s.debugAddr, "err", err)
-			}
-			s.debugUI = nil
+	if s.traceFilePath != "" {
+		if tf := s.openDebugTraceFile(); tf != nil {
+			defer s.closeDebugTraceFile(tf)
 		}
 	}
 
@@ -92,7 +108,27 @@ func (s *Server) Run(ctx context.Context, rw io.ReadWriteCloser) error {
 	if s.requestTimeout > 0 {
 		s.conn.SetRequestTimeout(s.requestTimeout)
 	}
+	if s.recorder != nil {
+		s.conn.AddRequestHook(tagRequestLogs)
+		s.conn.AddNotificationHook(tagNotificationLogs)
+	}
+	if s.metrics != nil {
+		s.conn.AddRequestHook(s.metrics.observe)
+	}
+	if s.tracer != nil {
+		s.conn.AddRequestHook(s.traceRequest)
+		s.conn.AddNotificationHook(s.traceNotification)
+	}
+	if s.slowThreshold > 0 {
+		s.slow = newSlowRequests(s.slowThreshold, s.logger, s.recorder)
+		s.conn.AddRequestHook(s.slow.observeRequest)
+		s.conn.AddNotificationHook(s.slow.observeNotification)
+	}
 	s.Client = newClient(s.conn)
+	s.Client.registrations.logger = s.logger
+	if s.configuration != nil {
+		s.configuration.bind(s.Client)
+	}
 
 	if h, ok := s.handler.(ClientHandler); ok {
 		h.SetClient(s.Client)
@@ -108,11 +144,59 @@ func (s *Server) Run(ctx context.Context, rw io.ReadWriteCloser) error {
 		dispatcher.RegisterNotification(method, s.logNotification(method, handler))
 	}
 
+	// The debug UI starts once every method is registered, as its request
+	// composer dispatches through the connection.
+	if s.debugAddr != "" {
+		opts := []debugui.Option{debugui.WithInjector(s.injectMessage)}
+		if s.debugAllowRemote {
+			opts = append(opts, debugui.AllowRemote())
+		}
+		if s.metrics != nil {
+			opts = append(opts, debugui.WithMetrics(s.metrics.Handler()))
+		}
+		s.debugUI = debugui.New(s.debugAddr, s.recorder, opts...)
+		if err := s.debugUI.ListenAndServe(ctx); err != nil {
+			if s.logger != nil {
+				s.logger.Warn("debugui: HTTP UI unavailable, continuing with capture only",
+					"addr", s.debugAddr, "err", err)
+			}
+			s.debugUI = nil
+		}
+	}
+
 	if s.logger != nil {
 		s.logger.Info("server starting")
 	}
 
-	return s.conn.Serve(ctx)
+	var err error
+	if s.parentPID != nil {
+		err = s.serveWatchingParent(ctx, rw)
+	} else {
+		err = s.conn.Serve(ctx)
+	}
+	// An editor closes the stream once it has sent exit, so the end of the
+	// input is then a clean stop.
+	if errors.Is(err, io.EOF) && s.exited.Load() {
+		return nil
+	}
+	return err
+}
+
+// injectMessage handles a request or notification composed in the debug UI
+// as if the client had sent it, and returns the response to a request.
+func (s *Server) injectMessage(ctx context.Context, data []byte) ([]byte, error) {
+	msg, err := jsonrpc.DecodeMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	switch m := msg.(type) {
+	case *jsonrpc.Request:
+		return json.Marshal(s.conn.InjectRequest(ctx, m))
+	case *jsonrpc.Notification:
+		return nil, s.conn.InjectNotification(ctx, m)
+	default:
+		return nil, errors.New("only requests and notifications can be injected")
+	}
 }
 
 func (s *Server) registerMethods(d *jsonrpc.Dispatcher) {
@@ -184,11 +268,12 @@ func (s *Server) registerMethods(d *jsonrpc.Dispatcher) {
 }
 
 func (s *Server) registerNotifications(d *jsonrpc.Dispatcher) {
-	d.RegisterNotification("initialized", s.logNotification("initialized", func(_ context.Context, _ json.RawMessage) error {
-		return nil
-	}))
+	d.RegisterNotification("initialized", s.logNotification("initialized", s.handleInitialized))
 
 	d.RegisterNotification("exit", s.logNotification("exit", func(_ context.Context, _ json.RawMessage) error {
+		if s.shutdown.Load() {
+			s.exited.Store(true)
+		}
 		return fmt.Errorf("exit")
 	}))
 
@@ -206,21 +291,20 @@ func (s *Server) registerNotifications(d *jsonrpc.Dispatcher) {
 		d.RegisterNotification("textDocument/willSave", s.logNotification("textDocument/willSave", notifHandler(h, TextDocumentWillSaveHandler.WillSave)))
 	}
 
-	if h, ok := s.handler.(WorkspaceFoldersHandler); ok {
-		d.RegisterNotification("workspace/didChangeWorkspaceFolders", s.logNotification("workspace/didChangeWorkspaceFolders", notifHandler(h, WorkspaceFoldersHandler.DidChangeWorkspaceFolders)))
+	if h, ok := s.handler.(WorkspaceFoldersHandler); ok || s.workspaceFolders != nil || s.configuration != nil {
+		d.RegisterNotification("workspace/didChangeWorkspaceFolders", s.logNotification("workspace/didChangeWorkspaceFolders", s.handleDidChangeWorkspaceFolders(h)))
 	}
 
-	if h, ok := s.handler.(DidChangeConfigurationHandler); ok {
-		d.RegisterNotification("workspace/didChangeConfiguration", s.logNotification("workspace/didChangeConfiguration", notifHandler(h, DidChangeConfigurationHandler.DidChangeConfiguration)))
+	if h, ok := s.handler.(DidChangeConfigurationHandler); ok || s.configuration != nil {
+		d.RegisterNotification("workspace/didChangeConfiguration", s.logNotification("workspace/didChangeConfiguration", s.handleDidChangeConfiguration(h)))
 	}
 
 	if h, ok := s.handler.(DidChangeWatchedFilesHandler); ok {
 		d.RegisterNotification("workspace/didChangeWatchedFiles", s.logNotification("workspace/didChangeWatchedFiles", notifHandler(h, DidChangeWatchedFilesHandler.DidChangeWatchedFiles)))
 	}
 
-	if h, ok := s.handler.(SetTraceHandler); ok {
-		d.RegisterNotification("$/setTrace", s.logNotification("$/setTrace", notifHandler(h, SetTraceHandler.SetTrace)))
-	}
+	h, _ := s.handler.(SetTraceHandler)
+	d.RegisterNotification("$/setTrace", s.logNotification("$/setTrace", s.handleSetTrace(h)))
 }
 
 func (s *Server) handleInitialize(ctx context.Context, params json.RawMessage) (any, error) {
@@ -229,6 +313,21 @@ func (s *Server) handleInitialize(ctx context.Context, params json.RawMessage) (
 		return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, err.Error())
 	}
 
+	s.Client.registrations.setClientCapabilities(p.Capabilities)
+	s.Client.setTrace(lsp.TraceValue(p.Trace))
+	if s.parentPID != nil && p.ProcessID != nil && *p.ProcessID > 0 {
+		select {
+		case s.parentPID <- *p.ProcessID:
+		default:
+		}
+	}
+	if s.workspaceFolders != nil {
+		s.workspaceFolders.initialize(&p)
+	}
+	if s.configuration != nil {
+		s.configuration.initialize(&p)
+	}
+
 	h := s.handler.(LifecycleHandler)
 	result, err := h.Initialize(ctx, &p)
 	if err != nil {
@@ -239,6 +338,10 @@ func (s *Server) handleInitialize(ctx context.Context, params json.RawMessage) (
 	autoCaps := buildCapabilities(s.handler)
 	applyCapabilityOptions(&autoCaps, s.handler, s.capabilityOptions)
 	mergeCapabilities(&result.Capabilities, &autoCaps)
+	if s.workspaceFolders != nil {
+		advertiseWorkspaceFolders(&result.Capabilities)
+	}
+	s.Client.registrations.applyStatic(&result.Capabilities)
 
 	if s.recorder != nil {
 		s.recorder.SetCapabilities(result.Capabilities)
@@ -253,10 +356,126 @@ func (s *Server) handleInitialize(ctx context.Context, params json.RawMessage) (
 	return result, nil
 }
 
+func (s *Server) handleInitialized(ctx context.Context, _ json.RawMessage) error {
+	// Registrations and configuration requests wait for client responses,
+	// which are read by the same loop that dispatches this notification.
+	go func() {
+		s.Client.registrations.flush(ctx)
+		if s.configuration != nil {
+			s.startConfiguration(ctx)
+		}
+	}()
+	return nil
+}
+
+// startConfiguration registers for configuration change notifications where
+// the client requires it and performs the initial configuration pull.
+func (s *Server) startConfiguration(ctx context.Context) {
+	regs := s.Client.registrations
+	if regs.SupportsDynamic("workspace/didChangeConfiguration") {
+		opts := map[string]any{}
+		if sections := s.configuration.sections(); len(sections) > 0 {
+			opts["section"] = sections
+		}
+		if _, err := regs.Register(ctx, "workspace/didChangeConfiguration", opts); err != nil && s.logger != nil {
+			s.logger.Error("configuration change registration failed", "error", err)
+		}
+	}
+	if err := s.configuration.Refresh(ctx); err != nil && s.logger != nil {
+		s.logger.Error("configuration refresh failed", "error", err)
+	}
+}
+
+// handleDidChangeConfiguration refreshes the configuration, if enabled, and
+// then forwards the notification to h, which may be nil.
+func (s *Server) handleDidChangeConfiguration(h DidChangeConfigurationHandler) jsonrpc.NotificationHandler {
+	return func(ctx context.Context, params json.RawMessage) error {
+		var p lsp.DidChangeConfigurationParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return err
+		}
+		if s.configuration != nil {
+			pull, err := s.configuration.didChange(&p)
+			if err != nil && s.logger != nil {
+				s.logger.Error("configuration refresh failed", "error", err)
+			}
+			if pull {
+				// Refresh waits for the client, which cannot answer while
+				// notifications are blocked.
+				go func() {
+					if err := s.configuration.Refresh(ctx); err != nil && s.logger != nil {
+						s.logger.Error("configuration refresh failed", "error", err)
+					}
+				}()
+			}
+		}
+		if h == nil {
+			return nil
+		}
+		return h.DidChangeConfiguration(ctx, &p)
+	}
+}
+
+// handleDidChangeWorkspaceFolders updates the folder tracker and
+// configuration, if enabled, and then forwards the notification to h, which
+// may be nil.
+func (s *Server) handleDidChangeWorkspaceFolders(h WorkspaceFoldersHandler) jsonrpc.NotificationHandler {
+	return func(ctx context.Context, params json.RawMessage) error {
+		var p lsp.DidChangeWorkspaceFoldersParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return err
+		}
+		if s.workspaceFolders != nil {
+			s.workspaceFolders.apply(p.Event)
+		}
+		if s.configuration != nil && s.configuration.didChangeFolders(p.Event) {
+			go func() {
+				if err := s.configuration.Refresh(ctx); err != nil && s.logger != nil {
+					s.logger.Error("configuration refresh failed", "error", err)
+				}
+			}()
+		}
+		if h == nil {
+			return nil
+		}
+		return h.DidChangeWorkspaceFolders(ctx, &p)
+	}
+}
+
+// handleSetTrace records the new trace level and then forwards the
+// notification to h, which may be nil.
+func (s *Server) handleSetTrace(h SetTraceHandler) jsonrpc.NotificationHandler {
+	return func(ctx context.Context, params json.RawMessage) error {
+		var p lsp.SetTraceParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return err
+		}
+		s.Client.setTrace(p.Value)
+		if h == nil {
+			return nil
+		}
+		return h.SetTrace(ctx, &p)
+	}
+}
+
+// advertiseWorkspaceFolders declares workspace folder support unless the
+// handler configured it explicitly.
+func advertiseWorkspaceFolders(caps *lsp.ServerCapabilities) {
+	if caps.Workspace == nil {
+		caps.Workspace = &lsp.ServerWorkspaceCapabilities{}
+	}
+	if caps.Workspace.WorkspaceFolders == nil {
+		caps.Workspace.WorkspaceFolders = &lsp.WorkspaceFoldersServerCapabilities{
+			Supported:           &enabled,
+			ChangeNotifications: &enabled,
+		}
+	}
+}
+
 func (s *Server) handleShutdown(ctx context.Context, _ json.RawMessage) (any, error) {
 	h := s.handler.(LifecycleHandler)
 	err := h.Shutdown(ctx)
-	s.shutdown = true
+	s.shutdown.Store(true)
 
 	if s.logger != nil {
 		s.logger.Info("server shutdown")
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"testing"
 
@@ -339,3 +340,55 @@ func TestServerInitializeHandshake(t *testing.T) {
 
 	cancel()
 }
+
+func TestRunEndOfInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+		clean    bool
+	}{
+		{name: "after shutdown and exit", messages: []string{"shutdown", "exit"}, clean: true},
+		{name: "exit without shutdown", messages: []string{"exit"}},
+		{name: "shutdown without exit", messages: []string{"shutdown"}},
+		{name: "no messages"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientReader, serverWriter := io.Pipe()
+			serverReader, clientWriter := io.Pipe()
+
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- NewServer(&mockHandler{}).Run(t.Context(), pipeRWC{Reader: serverReader, Writer: serverWriter})
+			}()
+			clientConn := jsonrpc.NewConn(pipeRWC{Reader: clientReader, Writer: clientWriter}, jsonrpc.NewDispatcher())
+
+			for _, method := range tt.messages {
+				if method == "shutdown" {
+					req, _ := jsonrpc.NewRequest(jsonrpc.IntID(1), method, nil)
+					if err := clientConn.WriteMessage(req); err != nil {
+						t.Fatal(err)
+					}
+					if _, err := clientConn.ReadMessage(); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				notif, _ := jsonrpc.NewNotification(method, nil)
+				if err := clientConn.WriteMessage(notif); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_ = clientWriter.Close()
+
+			err := <-errCh
+			if tt.clean && err != nil {
+				t.Fatalf("Run() error = %v, want nil", err)
+			}
+			if !tt.clean && !errors.Is(err, io.EOF) {
+				t.Fatalf("Run() error = %v, want io.EOF", err)
+			}
+		})
+	}
+}
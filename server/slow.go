@@ -0,0 +1,247 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/owenrumney/go-lsp/internal/debugui"
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
+)
+
+// maxParamsSummary is the length at which params are cut short in slow
+// request reports.
+const maxParamsSummary = 200
+
+// WithSlowRequestThreshold reports requests and notifications whose handler
+// runs for longer than d, to find the handler that is holding a lock or
+// waiting on something it should not. Each report is logged as a warning via
+// the configured WithLogger, with the method, a summary of the params, and
+// the stack of the handler's goroutine. It is also shown as an alert in the
+// debug UI, and counted in SlowRequests.
+//
+// A request is reported again as stuck if its handler is still running d
+// after its context was cancelled, by $/cancelRequest or the timeout set with
+// WithRequestTimeout, as the handler is not checking its context.
+func WithSlowRequestThreshold(d time.Duration) Option {
+	return func(s *Server) {
+		s.slowThreshold = d
+	}
+}
+
+// SlowRequestCount is the number of times requests for a method were
+// reported by WithSlowRequestThreshold.
+type SlowRequestCount struct {
+	Method string
+	// Slow is the number of requests and notifications that ran for longer
+	// than the threshold.
+	Slow uint64
+	// Stuck is the number of requests still running the threshold after they
+	// were cancelled.
+	Stuck uint64
+}
+
+// SlowRequests returns the counts of slow and stuck requests so far, sorted
+// by method. It returns nil unless WithSlowRequestThreshold was set.
+func (s *Server) SlowRequests() []SlowRequestCount {
+	if s.slow == nil {
+		return nil
+	}
+	return s.slow.snapshot()
+}
+
+// slowRequests watches handlers for WithSlowRequestThreshold.
+type slowRequests struct {
+	threshold time.Duration
+	logger    *slog.Logger
+	alerts    *debugui.AlertStore
+
+	mu     sync.Mutex
+	counts map[string]*SlowRequestCount
+}
+
+func newSlowRequests(threshold time.Duration, logger *slog.Logger, recorder *debugui.Recorder) *slowRequests {
+	w := &slowRequests{threshold: threshold, logger: logger, counts: make(map[string]*SlowRequestCount)}
+	if recorder != nil {
+		w.alerts = recorder.AlertStore()
+	}
+	return w
+}
+
+// handling is a handler being watched. Its timers report it unless it has
+// finished.
+type handling struct {
+	w       *slowRequests
+	method  string
+	rpcID   string
+	params  json.RawMessage
+	start   time.Time
+	routine string
+
+	mu       sync.Mutex
+	finished bool
+	stuck    *time.Timer
+}
+
+// observeRequest is the jsonrpc request hook that watches a request. It runs
+// on the handler's goroutine, so it can find its stack later.
+func (w *slowRequests) observeRequest(ctx context.Context, req *jsonrpc.Request) (context.Context, func(*jsonrpc.Response)) {
+	h := w.watch(req.Method, req.ID.String(), req.Params)
+	slow := time.AfterFunc(w.threshold, func() { h.report("slow") })
+	stopCancelled := context.AfterFunc(ctx, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if !h.finished {
+			h.stuck = time.AfterFunc(w.threshold, func() { h.report("stuck") })
+		}
+	})
+	return ctx, func(*jsonrpc.Response) {
+		slow.Stop()
+		stopCancelled()
+		h.finish()
+	}
+}
+
+// observeNotification is observeRequest for notifications. Their handlers
+// run one at a time, so a slow one holds up every notification after it.
+func (w *slowRequests) observeNotification(ctx context.Context, notif *jsonrpc.Notification) (context.Context, func(error)) {
+	h := w.watch(notif.Method, "", notif.Params)
+	slow := time.AfterFunc(w.threshold, func() { h.report("slow") })
+	return ctx, func(error) {
+		slow.Stop()
+		h.finish()
+	}
+}
+
+func (w *slowRequests) watch(method, rpcID string, params json.RawMessage) *handling {
+	return &handling{w: w, method: method, rpcID: rpcID, params: params, start: time.Now(), routine: goroutineID()}
+}
+
+func (h *handling) finish() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.finished = true
+	if h.stuck != nil {
+		h.stuck.Stop()
+	}
+}
+
+func (h *handling) done() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.finished
+}
+
+// report logs and records the handler, if it is still running.
+func (h *handling) report(kind string) {
+	stack := goroutineStack(h.routine)
+	// The stack is only worth reporting if the handler had not returned
+	// while it was taken.
+	if h.done() {
+		return
+	}
+	elapsed := time.Since(h.start)
+	params := summarizeParams(h.params)
+	h.w.count(h.method, kind)
+
+	if h.w.logger != nil {
+		msg := "slow request"
+		if kind == "stuck" {
+			msg = "request still running after cancellation"
+		}
+		h.w.logger.Warn(msg, "method", h.method, "id", h.rpcID, "elapsed", elapsed, "params", params, "stack", stack)
+	}
+	if h.w.alerts != nil {
+		h.w.alerts.Add(debugui.Alert{
+			Kind:      kind,
+			Method:    h.method,
+			RPCID:     h.rpcID,
+			ElapsedMs: float64(elapsed.Microseconds()) / 1000,
+			Params:    params,
+			Stack:     stack,
+		})
+	}
+}
+
+func (w *slowRequests) count(method, kind string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c, ok := w.counts[method]
+	if !ok {
+		c = &SlowRequestCount{Method: method}
+		w.counts[method] = c
+	}
+	if kind == "stuck" {
+		c.Stuck++
+	} else {
+		c.Slow++
+	}
+}
+
+func (w *slowRequests) snapshot() []SlowRequestCount {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	counts := make([]SlowRequestCount, 0, len(w.counts))
+	for _, c := range w.counts {
+		counts = append(counts, *c)
+	}
+	slices.SortFunc(counts, func(a, b SlowRequestCount) int { return strings.Compare(a.Method, b.Method) })
+	return counts
+}
+
+// summarizeParams returns params as compact JSON, cut short after
+// maxParamsSummary bytes.
+func summarizeParams(params json.RawMessage) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, params); err != nil {
+		b.Reset()
+		b.Write(params)
+	}
+	s := b.String()
+	if len(s) <= maxParamsSummary {
+		return s
+	}
+	cut := maxParamsSummary
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
+
+// goroutineID returns the ID of the calling goroutine, from the first line
+// of its stack: "goroutine 18 [running]:".
+func goroutineID() string {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	id, _, _ := strings.Cut(strings.TrimPrefix(string(buf[:n]), "goroutine "), " ")
+	return id
+}
+
+// goroutineStack returns the stack of the goroutine with the given ID, or ""
+// if it has exited. It briefly stops every goroutine, so it is only taken
+// when a handler is already slow.
+func goroutineStack(id string) string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 64<<20 {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	prefix := "goroutine " + id + " ["
+	for stack := range strings.SplitSeq(string(buf), "\n\n") {
+		if strings.HasPrefix(stack, prefix) {
+			return stack
+		}
+	}
+	return ""
+}
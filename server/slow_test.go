@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/owenrumney/go-lsp/internal/debugui"
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// blockingHandler's Hover waits for release without checking its context.
+type blockingHandler struct {
+	release chan struct{}
+}
+
+func (h *blockingHandler) Initialize(context.Context, *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	return &lsp.InitializeResult{}, nil
+}
+
+func (h *blockingHandler) Shutdown(context.Context) error { return nil }
+
+func (h *blockingHandler) Hover(context.Context, *lsp.HoverParams) (*lsp.Hover, error) {
+	<-h.release
+	return nil, nil
+}
+
+func TestSlowRequestThreshold(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	var logs lockedBuffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	h := &blockingHandler{release: make(chan struct{})}
+	s := NewServer(h, WithDebugCapture(), WithLogger(logger),
+		WithRequestTimeout(100*time.Millisecond), WithSlowRequestThreshold(50*time.Millisecond))
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go func() {
+		_ = s.Run(ctx, pipeRWC{Reader: serverReader, Writer: serverWriter})
+	}()
+
+	clientConn := jsonrpc.NewConn(pipeRWC{Reader: clientReader, Writer: clientWriter}, jsonrpc.NewDispatcher())
+	send := func(id int64, method string, params any) {
+		t.Helper()
+		req, _ := jsonrpc.NewRequest(jsonrpc.IntID(id), method, params)
+		if err := clientConn.WriteMessage(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send(1, "initialize", lsp.InitializeParams{})
+	if _, err := clientConn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	send(2, "textDocument/hover", lsp.HoverParams{TextDocumentPositionParams: lsp.TextDocumentPositionParams{TextDocument: lsp.TextDocumentIdentifier{URI: "file:///a.txt"}}})
+
+	var alerts []debugui.Alert
+	for deadline := time.Now().Add(5 * time.Second); len(alerts) < 2; alerts = s.recorder.AlertStore().All() {
+		if time.Now().After(deadline) {
+			t.Fatalf("alerts = %+v, want slow and stuck", alerts)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(h.release)
+	if _, err := clientConn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, kind := range []string{"slow", "stuck"} {
+		a := alerts[i]
+		if a.Kind != kind || a.Method != "textDocument/hover" || a.RPCID != "2" || a.ElapsedMs < 50 {
+			t.Errorf("alert %d = %+v, want the %s hover", i, a, kind)
+		}
+		if !strings.Contains(a.Params, "file:///a.txt") {
+			t.Errorf("alert %d params = %q", i, a.Params)
+		}
+		if !strings.Contains(a.Stack, "(*blockingHandler).Hover") {
+			t.Errorf("alert %d stack does not show the handler:\n%s", i, a.Stack)
+		}
+	}
+	got := s.SlowRequests()
+	if len(got) != 1 || got[0] != (SlowRequestCount{Method: "textDocument/hover", Slow: 1, Stuck: 1}) {
+		t.Errorf("SlowRequests = %+v, want only the hover", got)
+	}
+	if !strings.Contains(logs.String(), "slow request") || !strings.Contains(logs.String(), "method=textDocument/hover") {
+		t.Errorf("expected a warning, got: %s", logs.String())
+	}
+}
+
+func TestSummarizeParams(t *testing.T) {
+	if got := summarizeParams([]byte(`{ "a": 1 }`)); got != `{"a":1}` {
+		t.Errorf("got %q, want compact JSON", got)
+	}
+	long := `{"text":"` + strings.Repeat("é", maxParamsSummary) + `"}`
+	got := summarizeParams([]byte(long))
+	if !strings.HasSuffix(got, "...") || len(got) > maxParamsSummary+3 || !strings.HasPrefix(got, `{"text":"éé`) {
+		t.Errorf("got %q, want it cut short", got)
+	}
+	if !utf8.ValidString(got) {
+		t.Errorf("got %q, cut inside a character", got)
+	}
+}
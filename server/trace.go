@@ -1,13 +1,12 @@
 package server
 
 import (
+	"context"
 	"errors"
-	"fmt"
-	"io/fs"
-	"os"
-	"path/filepath"
+	"time"
 
 	"github.com/owenrumney/go-lsp/internal/debugui"
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
 )
 
 // ErrDebugTraceUnavailable is returned when trace export is requested without
@@ -16,7 +15,7 @@ var ErrDebugTraceUnavailable = errors.New("debug trace unavailable")
 
 // ErrInvalidDebugTracePath is returned when the trace destination is not a
 // writable regular file path.
-var ErrInvalidDebugTracePath = errors.New("invalid debug trace path")
+var ErrInvalidDebugTracePath = debugui.ErrInvalidTracePath
 
 // TraceExportOptions controls how a debug trace is exported.
 type TraceExportOptions struct {
@@ -60,50 +59,84 @@ func (s *Server) SaveDebugTrace(path string, opts TraceExportOptions) error {
 	if err != nil {
 		return err
 	}
-	return writeDebugTraceFile(path, data)
+	return debugui.SaveTrace(path, data)
 }
 
-func writeDebugTraceFile(path string, data []byte) (err error) {
-	cleanPath := filepath.Clean(path)
-	dir, name := filepath.Split(cleanPath)
-	if name == "" || name == "." || name == string(filepath.Separator) {
-		return fmt.Errorf("%w: missing file name", ErrInvalidDebugTracePath)
-	}
-	if dir == "" {
-		dir = "."
-	}
+// TraceFileOptions controls the trace file written by WithDebugTraceFile.
+type TraceFileOptions struct {
+	// MaxSize is the size in bytes at which the file is rotated. Zero never
+	// rotates by size.
+	MaxSize int64
+
+	// MaxAge is how long a file is written before it is rotated. Zero never
+	// rotates by age.
+	MaxAge time.Duration
+
+	// MaxFiles is the number of rotated files kept, removing the oldest. Zero
+	// keeps them all.
+	MaxFiles int
+
+	// RedactDocumentText, RedactFilePaths, and RedactLogs are applied as each
+	// message and log is written, as for TraceExportOptions.
+	RedactDocumentText bool
+	RedactFilePaths    bool
+	RedactLogs         bool
+}
 
-	root, err := os.OpenRoot(dir)
+// openDebugTraceFile starts streaming the capture to the WithDebugTraceFile
+// path. It returns nil if the file cannot be opened.
+func (s *Server) openDebugTraceFile() *debugui.TraceFile {
+	tf, err := debugui.CreateTraceFile(s.traceFilePath, debugui.TraceFileOptions{
+		Redact: debugui.TraceExportOptions{
+			RedactDocumentText: s.traceFileOptions.RedactDocumentText,
+			RedactFilePaths:    s.traceFileOptions.RedactFilePaths,
+			RedactLogs:         s.traceFileOptions.RedactLogs,
+		},
+		MaxSize:  s.traceFileOptions.MaxSize,
+		MaxAge:   s.traceFileOptions.MaxAge,
+		MaxFiles: s.traceFileOptions.MaxFiles,
+	})
 	if err != nil {
-		return err
-	}
-	defer func() {
-		if cerr := root.Close(); cerr != nil && err == nil {
-			err = cerr
+		if s.logger != nil {
+			s.logger.Warn("debugui: trace file unavailable, continuing with in-memory capture",
+				"path", s.traceFilePath, "err", err)
 		}
-	}()
+		return nil
+	}
+	s.recorder.StreamTo(tf)
+	return tf
+}
 
-	if info, statErr := root.Lstat(name); statErr == nil {
-		mode := info.Mode()
-		if mode&fs.ModeSymlink != 0 || !mode.IsRegular() {
-			return fmt.Errorf("%w: %s", ErrInvalidDebugTracePath, cleanPath)
-		}
-	} else if !errors.Is(statErr, fs.ErrNotExist) {
-		return statErr
+func (s *Server) closeDebugTraceFile(tf *debugui.TraceFile) {
+	if err := tf.Close(); err != nil && s.logger != nil {
+		s.logger.Warn("debugui: trace file incomplete", "path", s.traceFilePath, "err", err)
 	}
+}
 
-	f, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+// LoadDebugTraceFile reads the files written by WithDebugTraceFile at path,
+// including those rotated from it, into a single trace in the format of
+// ExportDebugTrace, which lsptrace and the debug UI can open. Pretty and the
+// redactions in opts are applied on top of those made while writing.
+func LoadDebugTraceFile(path string, opts TraceExportOptions) ([]byte, error) {
+	trace, err := debugui.LoadTraceFiles(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer func() {
-		if cerr := f.Close(); cerr != nil && err == nil {
-			err = cerr
-		}
-	}()
+	return debugui.MarshalTrace(trace, debugui.TraceExportOptions{
+		RedactDocumentText: opts.RedactDocumentText,
+		RedactFilePaths:    opts.RedactFilePaths,
+		RedactLogs:         opts.RedactLogs,
+		Pretty:             opts.Pretty,
+	})
+}
 
-	if _, err := f.Write(data); err != nil {
-		return err
-	}
-	return nil
+// tagRequestLogs is the jsonrpc request hook that tags the records logged
+// through DebugHandler while a request is handled with its ID and method.
+func tagRequestLogs(ctx context.Context, req *jsonrpc.Request) (context.Context, func(*jsonrpc.Response)) {
+	return debugui.ContextWithRequest(ctx, req.ID.String(), req.Method), nil
+}
+
+// tagNotificationLogs is tagRequestLogs for notifications, which have no ID.
+func tagNotificationLogs(ctx context.Context, notif *jsonrpc.Notification) (context.Context, func(error)) {
+	return debugui.ContextWithRequest(ctx, "", notif.Method), nil
 }
@@ -8,13 +8,17 @@ import (
 	"io"
 	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/owenrumney/go-lsp/internal/debugui"
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
+	"github.com/owenrumney/go-lsp/lsp"
 )
 
 func TestExportDebugTraceUnavailable(t *testing.T) {
@@ -229,3 +233,204 @@ func (b *lockedBuffer) String() string {
 	defer b.mu.Unlock()
 	return b.buf.String()
 }
+
+func TestDebugUIComposerReachesHandler(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	s := NewServer(&tracedHandler{}, WithDebugUI("127.0.0.1:0"))
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go func() {
+		_ = s.Run(ctx, pipeRWC{Reader: serverReader, Writer: serverWriter})
+	}()
+
+	clientConn := jsonrpc.NewConn(pipeRWC{Reader: clientReader, Writer: clientWriter}, jsonrpc.NewDispatcher())
+	call := func(id int64, method string) *jsonrpc.Response {
+		t.Helper()
+		req, _ := jsonrpc.NewRequest(jsonrpc.IntID(id), method, lsp.InitializeParams{})
+		if err := clientConn.WriteMessage(req); err != nil {
+			t.Fatal(err)
+		}
+		msg, err := clientConn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg.(*jsonrpc.Response)
+	}
+	call(1, "initialize")
+
+	compose := func(body string) debugui.ComposeResult {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, "http://"+s.debugUI.Addr().String()+"/api/compose", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+s.debugUI.Token())
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var res debugui.ComposeResult
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := compose(`{"method":"textDocument/hover","params":{"textDocument":{"uri":"file:///a.txt"},"position":{"line":0,"character":0}}}`)
+	var hover struct {
+		Result lsp.Hover `json:"result"`
+	}
+	if err := json.Unmarshal(res.Response, &hover); err != nil || hover.Result.Contents.Value != "x" {
+		t.Fatalf("composed hover = %+v, %v", res, err)
+	}
+	if res = compose(`{"method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.txt"}},"notification":true}`); res.Error != "cannot parse" {
+		t.Fatalf("composed didOpen = %+v, want the handler's error", res)
+	}
+
+	// The editor only sees responses to its own requests.
+	if resp := call(2, "shutdown"); resp.ID.String() != "2" {
+		t.Fatalf("editor received %+v", resp)
+	}
+
+	var injected int
+	for _, e := range s.recorder.Store().All() {
+		if e.Injected {
+			injected++
+		}
+	}
+	if injected != 3 {
+		t.Fatalf("recorded %d injected messages, want 3", injected)
+	}
+}
+
+type loggingHandler struct {
+	srv *Server
+}
+
+func (h *loggingHandler) Initialize(context.Context, *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	return &lsp.InitializeResult{}, nil
+}
+
+func (h *loggingHandler) Shutdown(context.Context) error { return nil }
+
+func (h *loggingHandler) Hover(ctx context.Context, p *lsp.HoverParams) (*lsp.Hover, error) {
+	slog.New(h.srv.DebugHandler()).InfoContext(ctx, "hovering", "uri", p.TextDocument.URI)
+	return nil, nil
+}
+
+func TestDebugHandlerTagsLogsWithRequest(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	h := &loggingHandler{}
+	s := NewServer(h, WithDebugCapture())
+	h.srv = s
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go func() {
+		_ = s.Run(ctx, pipeRWC{Reader: serverReader, Writer: serverWriter})
+	}()
+
+	clientConn := jsonrpc.NewConn(pipeRWC{Reader: clientReader, Writer: clientWriter}, jsonrpc.NewDispatcher())
+	for i, method := range []string{"initialize", "textDocument/hover"} {
+		req, _ := jsonrpc.NewRequest(jsonrpc.IntID(int64(i+1)), method, lsp.HoverParams{TextDocumentPositionParams: lsp.TextDocumentPositionParams{TextDocument: lsp.TextDocumentIdentifier{URI: "file:///a.txt"}}})
+		if err := clientConn.WriteMessage(req); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := clientConn.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logs := s.recorder.LogStore().All()
+	if len(logs) != 1 {
+		t.Fatalf("logs = %+v, want 1", logs)
+	}
+	if l := logs[0]; l.RPCID != "2" || l.Method != "textDocument/hover" || string(l.Attrs) != `{"uri":"file:///a.txt"}` {
+		t.Fatalf("log = %+v, want it tagged with the hover request", l)
+	}
+}
+
+func TestWithDebugTraceFile(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	s := NewServer(&mockHandler{}, WithDebugTraceFile(path, TraceFileOptions{RedactFilePaths: true}))
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(ctx, pipeRWC{Reader: serverReader, Writer: serverWriter})
+	}()
+
+	clientConn := jsonrpc.NewConn(pipeRWC{Reader: clientReader, Writer: clientWriter}, jsonrpc.NewDispatcher())
+	req, _ := jsonrpc.NewRequest(jsonrpc.IntID(1), "initialize", map[string]any{"rootUri": "file:///Users/owen/project"})
+	if err := clientConn.WriteMessage(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clientConn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	// The response is captured once its write returns.
+	for deadline := time.Now().Add(2 * time.Second); len(s.recorder.Store().All()) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("response was not captured within 2s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	_ = clientWriter.Close()
+	<-done
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0o600 {
+		t.Fatalf("permissions = %v, want 0600", got)
+	}
+
+	data, err := LoadDebugTraceFile(path, TraceExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace, err := debugui.ParseTrace(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace.Messages) != 2 || trace.Messages[0].PairedWith != 1 {
+		t.Fatalf("messages = %+v, want the paired initialize request", trace.Messages)
+	}
+	if len(trace.Capabilities) == 0 {
+		t.Error("expected capabilities")
+	}
+	if strings.Contains(string(data), "/Users/owen") {
+		t.Errorf("trace file contains an unredacted path: %s", data)
+	}
+}
+
+func TestWithDebugTraceFileDegradesGracefully(t *testing.T) {
+	var logs lockedBuffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	s := NewServer(&mockHandler{}, WithDebugTraceFile(t.TempDir(), TraceFileOptions{}), WithLogger(logger))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	rw := newSignalingPipe()
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx, rw) }()
+
+	waitForStart(t, rw)
+
+	if !bytes.Contains(logs.Bytes(), []byte("trace file unavailable")) {
+		t.Fatalf("expected warning log, got: %s", logs.String())
+	}
+	if _, err := s.ExportDebugTrace(TraceExportOptions{}); err != nil {
+		t.Fatalf("in-memory capture should still work: %v", err)
+	}
+
+	cancel()
+	_ = rw.Close()
+	<-done
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
+)
+
+// Attribute is a key-value pair attached to a span. Values are strings, ints,
+// int64s, float64s, or bools.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Attribute keys set on the spans the server starts. They follow the
+// OpenTelemetry semantic conventions for JSON-RPC where there is one.
+const (
+	AttrRPCSystem    = "rpc.system"
+	AttrRPCMethod    = "rpc.method"
+	AttrRequestID    = "rpc.jsonrpc.request_id"
+	AttrErrorCode    = "rpc.jsonrpc.error_code"
+	AttrErrorMessage = "rpc.jsonrpc.error_message"
+	AttrDocumentURI  = "lsp.document.uri"
+	AttrResultSize   = "lsp.result.size"
+)
+
+// Tracer starts spans. Implement it to send spans to a tracing system such as
+// OpenTelemetry, or use InMemoryTracer in tests.
+type Tracer interface {
+	// Start starts a span named name. It is a child of the span in ctx, if
+	// any, and the returned context carries the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a timed operation started by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	// SetError marks the span as failed with err.
+	SetError(err error)
+	End()
+}
+
+// WithTracer starts a span with t around every request and notification the
+// server handles. The span is named after the method and carries its request
+// ID, the document URI from its params, the size in bytes of its result, and
+// its error code. Handlers receive it in their context, and can start child
+// spans with StartSpan.
+func WithTracer(t Tracer) Option {
+	return func(s *Server) {
+		s.tracer = t
+	}
+}
+
+type tracerKey struct{}
+
+type spanKey struct{}
+
+// StartSpan starts a span named name as a child of the span in ctx, using the
+// tracer set with WithTracer. Without a tracer it returns ctx and a span that
+// does nothing, so handlers can call it unconditionally.
+//
+//	ctx, span := server.StartSpan(ctx, "parse")
+//	defer span.End()
+func StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	t, ok := ctx.Value(tracerKey{}).(Tracer)
+	if !ok {
+		return ctx, noopSpan{}
+	}
+	ctx, span := t.Start(ctx, name, attrs...)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SpanFromContext returns the span in ctx, such as the one the server started
+// for the request being handled, or a span that does nothing.
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) SetError(error)             {}
+func (noopSpan) End()                       {}
+
+// startSpan starts the span for an incoming message and puts it and the
+// tracer in the returned context.
+func (s *Server) startSpan(ctx context.Context, method string, params json.RawMessage, attrs ...Attribute) (context.Context, Span) {
+	attrs = append(attrs, Attribute{AttrRPCSystem, "jsonrpc"}, Attribute{AttrRPCMethod, method})
+	if uri := documentURI(params); uri != "" {
+		attrs = append(attrs, Attribute{AttrDocumentURI, uri})
+	}
+	ctx = context.WithValue(ctx, tracerKey{}, s.tracer)
+	ctx, span := s.tracer.Start(ctx, method, attrs...)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// traceRequest is the jsonrpc request hook that wraps a request in a span.
+func (s *Server) traceRequest(ctx context.Context, req *jsonrpc.Request) (context.Context, func(*jsonrpc.Response)) {
+	ctx, span := s.startSpan(ctx, req.Method, req.Params, Attribute{AttrRequestID, req.ID.String()})
+	return ctx, func(resp *jsonrpc.Response) {
+		if resp.Error != nil {
+			span.SetAttributes(Attribute{AttrErrorCode, resp.Error.Code}, Attribute{AttrErrorMessage, resp.Error.Message})
+			span.SetError(resp.Error)
+		} else {
+			span.SetAttributes(Attribute{AttrResultSize, len(resp.Result)})
+		}
+		span.End()
+	}
+}
+
+// traceNotification is the jsonrpc notification hook that wraps a
+// notification in a span.
+func (s *Server) traceNotification(ctx context.Context, notif *jsonrpc.Notification) (context.Context, func(error)) {
+	ctx, span := s.startSpan(ctx, notif.Method, notif.Params)
+	return ctx, func(err error) {
+		if err != nil {
+			span.SetError(err)
+		}
+		span.End()
+	}
+}
+
+// documentURI returns params.textDocument.uri, if params has one.
+func documentURI(params json.RawMessage) string {
+	var p struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+	}
+	if len(params) == 0 || json.Unmarshal(params, &p) != nil {
+		return ""
+	}
+	return p.TextDocument.URI
+}
+
+// InMemoryTracer is a Tracer that keeps the spans it starts in memory, for
+// asserting on in tests. It is safe for concurrent use.
+type InMemoryTracer struct {
+	mu     sync.Mutex
+	nextID int
+	spans  []RecordedSpan
+}
+
+// RecordedSpan is a span that an InMemoryTracer has ended.
+type RecordedSpan struct {
+	// ID identifies the span within its tracer, starting at 1.
+	ID int
+	// ParentID is the ID of the span's parent, or 0 for a root span.
+	ParentID   int
+	Name       string
+	Attributes map[string]any
+	Err        error
+	Start, End time.Time
+}
+
+// NewInMemoryTracer returns an InMemoryTracer with no spans.
+func NewInMemoryTracer() *InMemoryTracer {
+	return &InMemoryTracer{}
+}
+
+type memorySpanKey struct{}
+
+// Start implements Tracer.
+func (t *InMemoryTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	t.mu.Lock()
+	t.nextID++
+	id := t.nextID
+	t.mu.Unlock()
+
+	span := &memorySpan{tracer: t, span: RecordedSpan{ID: id, Name: name, Attributes: make(map[string]any), Start: time.Now()}}
+	if parent, ok := ctx.Value(memorySpanKey{}).(*memorySpan); ok && parent.tracer == t {
+		span.span.ParentID = parent.span.ID
+	}
+	span.SetAttributes(attrs...)
+	return context.WithValue(ctx, memorySpanKey{}, span), span
+}
+
+// Spans returns the spans that have ended, in the order they ended.
+func (t *InMemoryTracer) Spans() []RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spans := make([]RecordedSpan, len(t.spans))
+	for i, s := range t.spans {
+		s.Attributes = maps.Clone(s.Attributes)
+		spans[i] = s
+	}
+	return spans
+}
+
+// Reset discards the ended spans.
+func (t *InMemoryTracer) Reset() {
+	t.mu.Lock()
+	t.spans = nil
+	t.mu.Unlock()
+}
+
+type memorySpan struct {
+	tracer *InMemoryTracer
+
+	mu    sync.Mutex
+	span  RecordedSpan
+	ended bool
+}
+
+func (s *memorySpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range attrs {
+		s.span.Attributes[a.Key] = a.Value
+	}
+}
+
+func (s *memorySpan) SetError(err error) {
+	s.mu.Lock()
+	s.span.Err = err
+	s.mu.Unlock()
+}
+
+func (s *memorySpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.span.End = time.Now()
+	span := s.span
+	span.Attributes = maps.Clone(s.span.Attributes)
+	s.mu.Unlock()
+
+	s.tracer.mu.Lock()
+	s.tracer.spans = append(s.tracer.spans, span)
+	s.tracer.mu.Unlock()
+}
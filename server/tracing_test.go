@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+type tracedHandler struct{}
+
+func (h *tracedHandler) Initialize(context.Context, *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	return &lsp.InitializeResult{}, nil
+}
+
+func (h *tracedHandler) Shutdown(context.Context) error { return nil }
+
+func (h *tracedHandler) DidOpen(context.Context, *lsp.DidOpenTextDocumentParams) error {
+	return errors.New("cannot parse")
+}
+
+func (h *tracedHandler) DidChange(context.Context, *lsp.DidChangeTextDocumentParams) error {
+	return nil
+}
+
+func (h *tracedHandler) DidClose(context.Context, *lsp.DidCloseTextDocumentParams) error {
+	return nil
+}
+
+func (h *tracedHandler) Hover(ctx context.Context, _ *lsp.HoverParams) (*lsp.Hover, error) {
+	SpanFromContext(ctx).SetAttributes(Attribute{"hover.cached", false})
+	_, span := StartSpan(ctx, "lookup", Attribute{"symbols", 3})
+	span.End()
+	return &lsp.Hover{Contents: lsp.MarkupContent{Kind: lsp.PlainText, Value: "x"}}, nil
+}
+
+func TestTracerWrapsMessagesInSpans(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	tracer := NewInMemoryTracer()
+	s := NewServer(&tracedHandler{}, WithTracer(tracer))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go func() {
+		_ = s.Run(ctx, pipeRWC{Reader: serverReader, Writer: serverWriter})
+	}()
+
+	clientConn := jsonrpc.NewConn(pipeRWC{Reader: clientReader, Writer: clientWriter}, jsonrpc.NewDispatcher())
+	call := func(id int64, method string, params any) {
+		t.Helper()
+		req, _ := jsonrpc.NewRequest(jsonrpc.IntID(id), method, params)
+		if err := clientConn.WriteMessage(req); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := clientConn.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	call(1, "initialize", lsp.InitializeParams{})
+	if err := clientConn.Notify(ctx, "textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: "file:///a.txt", LanguageID: "plaintext", Text: "x"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Notifications are handled in order, before the next request is read.
+	call(2, "textDocument/hover", lsp.HoverParams{TextDocumentPositionParams: lsp.TextDocumentPositionParams{TextDocument: lsp.TextDocumentIdentifier{URI: "file:///a.txt"}}})
+	call(3, "no/such/method", nil)
+
+	spans := tracer.Spans()
+	if len(spans) != 5 {
+		t.Fatalf("spans = %+v, want 5", spans)
+	}
+	initialize, didOpen, lookup, hover, missing := spans[0], spans[1], spans[2], spans[3], spans[4]
+
+	if initialize.Name != "initialize" || initialize.Attributes[AttrRequestID] != "1" || initialize.Attributes[AttrRPCSystem] != "jsonrpc" {
+		t.Errorf("initialize span = %+v", initialize)
+	}
+	if _, ok := initialize.Attributes[AttrResultSize].(int); !ok || initialize.Err != nil {
+		t.Errorf("initialize span = %+v, want a result size and no error", initialize)
+	}
+
+	if didOpen.Name != "textDocument/didOpen" || didOpen.Attributes[AttrDocumentURI] != "file:///a.txt" || didOpen.Err == nil || didOpen.Err.Error() != "cannot parse" {
+		t.Errorf("didOpen span = %+v", didOpen)
+	}
+
+	if hover.Name != "textDocument/hover" || hover.Attributes[AttrDocumentURI] != "file:///a.txt" || hover.Attributes["hover.cached"] != false {
+		t.Errorf("hover span = %+v", hover)
+	}
+	if lookup.Name != "lookup" || lookup.ParentID != hover.ID || lookup.Attributes["symbols"] != 3 {
+		t.Errorf("lookup span = %+v, want a child of hover %d", lookup, hover.ID)
+	}
+	if hover.ParentID != 0 || lookup.Start.Before(hover.Start) || lookup.End.After(hover.End) {
+		t.Errorf("hover span = %+v, lookup span = %+v", hover, lookup)
+	}
+
+	if missing.Attributes[AttrErrorCode] != jsonrpc.CodeMethodNotFound || missing.Err == nil {
+		t.Errorf("no/such/method span = %+v", missing)
+	}
+}
+
+func TestStartSpanWithoutTracer(t *testing.T) {
+	ctx, span := StartSpan(t.Context(), "work")
+	span.SetAttributes(Attribute{"k", "v"})
+	span.SetError(errors.New("ignored"))
+	span.End()
+	if ctx != t.Context() {
+		t.Fatal("expected the context to be returned unchanged")
+	}
+	SpanFromContext(ctx).End()
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// WorkspaceFolders tracks the client's workspace folders.
+//
+// The initial folders are taken from InitializeParams.WorkspaceFolders, or
+// from rootUri/rootPath for clients that predate multi-root workspaces. Folders
+// are then kept current from workspace/didChangeWorkspaceFolders.
+//
+// Enable it with [WithWorkspaceFolders]; the server then advertises
+// workspace.workspaceFolders support automatically.
+type WorkspaceFolders struct {
+	mu          sync.RWMutex
+	folders     []lsp.WorkspaceFolder
+	subscribers []func(lsp.WorkspaceFoldersChangeEvent)
+}
+
+// NewWorkspaceFolders creates an empty WorkspaceFolders tracker.
+func NewWorkspaceFolders() *WorkspaceFolders {
+	return &WorkspaceFolders{}
+}
+
+// Folders returns a copy of the current workspace folders.
+func (w *WorkspaceFolders) Folders() []lsp.WorkspaceFolder {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return slices.Clone(w.folders)
+}
+
+// Owner returns the innermost workspace folder containing uri.
+func (w *WorkspaceFolders) Owner(uri lsp.DocumentURI) (lsp.WorkspaceFolder, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	var best lsp.WorkspaceFolder
+	found := false
+	for _, folder := range w.folders {
+		if uriContains(folder.URI, uri) && (!found || len(folder.URI) > len(best.URI)) {
+			best, found = folder, true
+		}
+	}
+	return best, found
+}
+
+// OnChange registers fn to be called after each folder change has been
+// applied. fn runs on the connection's read loop, so it must not wait for
+// responses from the client; start a goroutine for that.
+func (w *WorkspaceFolders) OnChange(fn func(lsp.WorkspaceFoldersChangeEvent)) {
+	w.mu.Lock()
+	w.subscribers = append(w.subscribers, fn)
+	w.mu.Unlock()
+}
+
+func (w *WorkspaceFolders) initialize(params *lsp.InitializeParams) {
+	w.mu.Lock()
+	w.folders = initialWorkspaceFolders(params)
+	w.mu.Unlock()
+}
+
+func (w *WorkspaceFolders) apply(event lsp.WorkspaceFoldersChangeEvent) {
+	w.mu.Lock()
+	w.folders = applyFolderChange(w.folders, event)
+	subs := slices.Clone(w.subscribers)
+	w.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(event)
+	}
+}
+
+// initialWorkspaceFolders returns the workspace folders from initialize,
+// falling back to a single folder for rootUri or the deprecated rootPath.
+func initialWorkspaceFolders(params *lsp.InitializeParams) []lsp.WorkspaceFolder {
+	if len(params.WorkspaceFolders) > 0 {
+		return slices.Clone(params.WorkspaceFolders)
+	}
+	if params.RootURI != nil && *params.RootURI != "" {
+		root := *params.RootURI
+		return []lsp.WorkspaceFolder{{URI: root, Name: path.Base(string(root))}}
+	}
+	if params.RootPath != nil && *params.RootPath != "" {
+		p := filepath.ToSlash(*params.RootPath)
+		if !path.IsAbs(p) {
+			p = "/" + p
+		}
+		uri := (&url.URL{Scheme: "file", Path: p}).String()
+		return []lsp.WorkspaceFolder{{URI: lsp.DocumentURI(uri), Name: path.Base(p)}}
+	}
+	return nil
+}
+
+// applyFolderChange returns folders with event's removals and additions
+// applied. Folders are matched by URI.
+func applyFolderChange(folders []lsp.WorkspaceFolder, event lsp.WorkspaceFoldersChangeEvent) []lsp.WorkspaceFolder {
+	out := slices.DeleteFunc(slices.Clone(folders), func(f lsp.WorkspaceFolder) bool {
+		return slices.ContainsFunc(event.Removed, func(r lsp.WorkspaceFolder) bool { return r.URI == f.URI })
+	})
+	for _, added := range event.Added {
+		if !slices.ContainsFunc(out, func(f lsp.WorkspaceFolder) bool { return f.URI == added.URI }) {
+			out = append(out, added)
+		}
+	}
+	return out
+}
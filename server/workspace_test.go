@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+func TestWorkspaceFolders(t *testing.T) {
+	folders := NewWorkspaceFolders()
+	changes := make(chan lsp.WorkspaceFoldersChangeEvent, 1)
+	folders.OnChange(func(e lsp.WorkspaceFoldersChangeEvent) { changes <- e })
+
+	conn := startClientConn(t, NewServer(&mockHandler{}, WithWorkspaceFolders(folders)), jsonrpc.NewDispatcher())
+
+	root := lsp.DocumentURI("file:///ws/root")
+	resp, err := conn.Call(t.Context(), "initialize", lsp.InitializeParams{RootURI: &root})
+	if err != nil || resp.Error != nil {
+		t.Fatalf("initialize failed: %v %v", err, resp.Error)
+	}
+	var result lsp.InitializeResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		t.Fatal(err)
+	}
+	wf := result.Capabilities.Workspace
+	if wf == nil || wf.WorkspaceFolders == nil || !*wf.WorkspaceFolders.Supported || !*wf.WorkspaceFolders.ChangeNotifications {
+		t.Fatalf("workspace capabilities = %+v", wf)
+	}
+	if got := folders.Folders(); len(got) != 1 || got[0].URI != root || got[0].Name != "root" {
+		t.Fatalf("initial folders = %+v", got)
+	}
+
+	event := lsp.WorkspaceFoldersChangeEvent{
+		Added:   []lsp.WorkspaceFolder{{URI: "file:///ws/a", Name: "a"}, {URI: "file:///ws/a/nested", Name: "nested"}},
+		Removed: []lsp.WorkspaceFolder{{URI: root, Name: "root"}},
+	}
+	if err := conn.Notify(t.Context(), "workspace/didChangeWorkspaceFolders", lsp.DidChangeWorkspaceFoldersParams{Event: event}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for folder change")
+	}
+
+	if got := folders.Folders(); len(got) != 2 {
+		t.Fatalf("folders = %+v", got)
+	}
+	if owner, ok := folders.Owner("file:///ws/a/nested/x.go"); !ok || owner.Name != "nested" {
+		t.Fatalf("owner = %+v, %v", owner, ok)
+	}
+	if owner, ok := folders.Owner("file:///ws/a/x.go"); !ok || owner.Name != "a" {
+		t.Fatalf("owner = %+v, %v", owner, ok)
+	}
+	if _, ok := folders.Owner("file:///ws/root/x.go"); ok {
+		t.Fatal("removed folder still owns documents")
+	}
+}
+
+func TestInitialWorkspaceFoldersRootPath(t *testing.T) {
+	rootPath := "/home/user/project"
+	got := initialWorkspaceFolders(&lsp.InitializeParams{RootPath: &rootPath})
+	if len(got) != 1 || got[0].URI != "file:///home/user/project" || got[0].Name != "project" {
+		t.Fatalf("folders = %+v", got)
+	}
+}
+
+func TestWorkspaceFoldersRefreshConfiguration(t *testing.T) {
+	scopes := make(chan []lsp.DocumentURI, 4)
+	d := jsonrpc.NewDispatcher()
+	d.RegisterMethod("workspace/configuration", func(_ context.Context, params json.RawMessage) (any, error) {
+		var p lsp.ConfigurationParams
+		_ = json.Unmarshal(params, &p)
+		var uris []lsp.DocumentURI
+		result := make([]any, len(p.Items))
+		for i, item := range p.Items {
+			result[i] = map[string]any{"tabSize": 2}
+			if item.ScopeURI != nil {
+				uris = append(uris, *item.ScopeURI)
+				result[i] = map[string]any{"tabSize": 8}
+			}
+		}
+		scopes <- uris
+		return result, nil
+	})
+
+	cfg := NewConfiguration(testSettings{}, ConfigurationOptions{Sections: []string{"mylang"}, PerFolder: true})
+	conn := startClientConn(t, NewServer(&mockHandler{}, WithConfiguration(cfg)), d)
+	initializeClient(t, conn, lsp.ClientCapabilities{
+		Workspace: &lsp.WorkspaceClientCapabilities{Configuration: &enabled},
+	})
+
+	waitScopes := func() []lsp.DocumentURI {
+		t.Helper()
+		select {
+		case s := <-scopes:
+			return s
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for workspace/configuration")
+			return nil
+		}
+	}
+	if got := waitScopes(); len(got) != 0 {
+		t.Fatalf("initial scopes = %v", got)
+	}
+
+	err := conn.Notify(t.Context(), "workspace/didChangeWorkspaceFolders", lsp.DidChangeWorkspaceFoldersParams{
+		Event: lsp.WorkspaceFoldersChangeEvent{Added: []lsp.WorkspaceFolder{{URI: "file:///ws/b", Name: "b"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := waitScopes(); len(got) != 1 || got[0] != "file:///ws/b" {
+		t.Fatalf("scopes after folder change = %v", got)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for cfg.For("file:///ws/b/main.go").TabSize != 8 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := cfg.For("file:///ws/b/main.go"); got.TabSize != 8 {
+		t.Fatalf("folder settings = %+v", got)
+	}
+}
@@ -0,0 +1,113 @@
+package servertest
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// ApplyEditResponder returns a ClientResponder for workspace/applyEdit that
+// behaves like an editor: it applies the edit to the harness's copy of each
+// open document, sends the resulting textDocument/didChange notifications to
+// the server, and then reports the edit as applied.
+//
+// The edit is rejected, and nothing is changed, if it touches a document that
+// is not open, names a version other than the current one, or contains
+// overlapping edits. Applied edits are available from AppliedEdits.
+//
+//	h.SetClientResponder("workspace/applyEdit", h.ApplyEditResponder())
+func (h *Harness) ApplyEditResponder() ClientResponder {
+	return func(params json.RawMessage) (any, error) {
+		var p lsp.ApplyWorkspaceEditParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		if err := h.applyWorkspaceEdit(&p.Edit); err != nil {
+			return lsp.ApplyWorkspaceEditResult{FailureReason: err.Error()}, nil
+		}
+
+		h.clientRequests.mu.Lock()
+		h.clientRequests.applied = append(h.clientRequests.applied, p)
+		h.clientRequests.mu.Unlock()
+		return lsp.ApplyWorkspaceEditResult{Applied: true}, nil
+	}
+}
+
+// AppliedEdits returns the workspace edits applied by ApplyEditResponder, in
+// the order they were applied.
+func (h *Harness) AppliedEdits() []lsp.ApplyWorkspaceEditParams {
+	h.clientRequests.mu.Lock()
+	defer h.clientRequests.mu.Unlock()
+	return slices.Clone(h.clientRequests.applied)
+}
+
+func (h *Harness) applyWorkspaceEdit(edit *lsp.WorkspaceEdit) error {
+	type docEdit struct {
+		uri   lsp.DocumentURI
+		edits []lsp.TextEdit
+	}
+	var docs []docEdit
+	for _, uri := range slices.Sorted(maps.Keys(edit.Changes)) {
+		docs = append(docs, docEdit{uri: uri, edits: edit.Changes[uri]})
+	}
+	for _, change := range edit.DocumentChanges {
+		uri := change.TextDocument.URI
+		doc, ok := h.docs.Get(uri)
+		if ok && change.TextDocument.Version != nil && *change.TextDocument.Version != doc.Version() {
+			return fmt.Errorf("%s: version %d does not match current version %d", uri, *change.TextDocument.Version, doc.Version())
+		}
+		docs = append(docs, docEdit{uri: uri, edits: change.Edits})
+	}
+
+	// Check every document before changing any of them.
+	for _, d := range docs {
+		text, ok := h.docs.Text(d.uri)
+		if !ok {
+			return fmt.Errorf("%s: document is not open", d.uri)
+		}
+		if _, err := applyTextEdits(text, h.encoding, d.edits); err != nil {
+			return fmt.Errorf("%s: %w", d.uri, err)
+		}
+	}
+
+	for _, d := range docs {
+		if err := h.Edit(d.uri, reverseChanges(d.edits)...); err != nil {
+			return fmt.Errorf("%s: %w", d.uri, err)
+		}
+	}
+	return nil
+}
+
+// reverseChanges converts edits that are all relative to the same text into
+// content changes that can be applied one after another, by ordering them
+// from the end of the document to the start.
+func reverseChanges(edits []lsp.TextEdit) []lsp.TextDocumentContentChangeEvent {
+	order := make([]int, len(edits))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		ra, rb := edits[a].Range, edits[b].Range
+		return cmp.Or(
+			cmp.Compare(rb.Start.Line, ra.Start.Line),
+			cmp.Compare(rb.Start.Character, ra.Start.Character),
+			// At the same start, a replacement is applied before an insertion,
+			// so the insertion is not swallowed by it.
+			cmp.Compare(rb.End.Line, ra.End.Line),
+			cmp.Compare(rb.End.Character, ra.End.Character),
+			// Edits inserted at the same position keep their order.
+			cmp.Compare(b, a),
+		)
+	})
+
+	changes := make([]lsp.TextDocumentContentChangeEvent, len(order))
+	for i, j := range order {
+		r := edits[j].Range
+		changes[i] = lsp.TextDocumentContentChangeEvent{Range: &r, Text: edits[j].NewText}
+	}
+	return changes
+}
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
+
+	"github.com/owenrumney/go-lsp/lsp"
 )
 
 // ClientRequest is a server-to-client request captured by the harness.
@@ -13,39 +16,97 @@ type ClientRequest struct {
 	Params json.RawMessage
 }
 
-type clientResponse struct {
-	result any
-	err    error
+// ClientResponder produces the response to a server-to-client request from
+// its params. Returning an error sends a JSON-RPC error response.
+type ClientResponder func(params json.RawMessage) (any, error)
+
+// Respond returns a ClientResponder that always answers with result.
+func Respond(result any) ClientResponder {
+	return func(json.RawMessage) (any, error) { return result, nil }
+}
+
+// RespondError returns a ClientResponder that always answers with an error.
+func RespondError(err error) ClientResponder {
+	if err == nil {
+		err = fmt.Errorf("client request failed")
+	}
+	return func(json.RawMessage) (any, error) { return nil, err }
+}
+
+// Delay returns a ClientResponder that waits for d before calling r, to
+// simulate a slow client.
+func Delay(d time.Duration, r ClientResponder) ClientResponder {
+	return func(params json.RawMessage) (any, error) {
+		time.Sleep(d)
+		return r(params)
+	}
+}
+
+// RespondConfiguration returns a ClientResponder for workspace/configuration
+// that calls settings once per requested item, so answers can depend on the
+// item's section and scopeUri.
+func RespondConfiguration(settings func(item lsp.ConfigurationItem) any) ClientResponder {
+	return func(params json.RawMessage) (any, error) {
+		var p lsp.ConfigurationParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		result := make([]any, len(p.Items))
+		for i, item := range p.Items {
+			result[i] = settings(item)
+		}
+		return result, nil
+	}
 }
 
 type clientRequestStore struct {
-	mu        sync.Mutex
-	cond      *sync.Cond
-	requests  []ClientRequest
-	responses map[string]clientResponse
+	mu         sync.Mutex
+	cond       *sync.Cond
+	requests   []ClientRequest
+	responders map[string]ClientResponder
+	queued     map[string][]ClientResponder
+	applied    []lsp.ApplyWorkspaceEditParams
 }
 
 func newClientRequestStore() *clientRequestStore {
 	s := &clientRequestStore{
-		responses: make(map[string]clientResponse),
+		responders: make(map[string]ClientResponder),
+		queued:     make(map[string][]ClientResponder),
 	}
 	s.cond = sync.NewCond(&s.mu)
 	return s
 }
 
-func (s *clientRequestStore) handle(method string, params json.RawMessage) (any, error) {
+// handle records the request and picks its responder in arrival order; the
+// responder itself runs later, off the read loop.
+func (s *clientRequestStore) handle(method string, params json.RawMessage) func() (any, error) {
 	s.mu.Lock()
-	s.requests = append(s.requests, ClientRequest{Method: method, Params: cloneRawMessage(params)})
-	resp := s.responses[method]
+	defer s.mu.Unlock()
+	params = cloneRawMessage(params)
+	s.requests = append(s.requests, ClientRequest{Method: method, Params: params})
 	s.cond.Broadcast()
-	s.mu.Unlock()
-	return resp.result, resp.err
+
+	respond := s.responders[method]
+	if queue := s.queued[method]; len(queue) > 0 {
+		respond = queue[0]
+		s.queued[method] = queue[1:]
+	}
+	if respond == nil {
+		return func() (any, error) { return nil, nil }
+	}
+	return func() (any, error) { return respond(params) }
+}
+
+func (s *clientRequestStore) setResponder(method string, r ClientResponder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responders[method] = r
 }
 
-func (s *clientRequestStore) setResponse(method string, result any, err error) {
+func (s *clientRequestStore) queue(method string, rs []ClientResponder) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.responses[method] = clientResponse{result: result, err: err}
+	s.queued[method] = append(s.queued[method], rs...)
 }
 
 func (s *clientRequestStore) all() []ClientRequest {
@@ -79,15 +140,26 @@ func (s *clientRequestStore) wait(ctx context.Context, method string) (ClientReq
 
 // SetClientResponse configures the response returned for a server-to-client request method.
 func (h *Harness) SetClientResponse(method string, result any) {
-	h.clientRequests.setResponse(method, result, nil)
+	h.clientRequests.setResponder(method, Respond(result))
 }
 
 // SetClientError configures an error response for a server-to-client request method.
 func (h *Harness) SetClientError(method string, err error) {
-	if err == nil {
-		err = fmt.Errorf("client request failed")
-	}
-	h.clientRequests.setResponse(method, nil, err)
+	h.clientRequests.setResponder(method, RespondError(err))
+}
+
+// SetClientResponder configures r to answer every request for method,
+// replacing any response set earlier. Requests without a responder are
+// answered with null.
+func (h *Harness) SetClientResponder(method string, r ClientResponder) {
+	h.clientRequests.setResponder(method, r)
+}
+
+// QueueClientResponses queues responders that answer the next requests for
+// method, one request each, in order. Once the queue is used up, requests are
+// answered by the responder set with SetClientResponder.
+func (h *Harness) QueueClientResponses(method string, rs ...ClientResponder) {
+	h.clientRequests.queue(method, rs)
 }
 
 // ClientRequests returns all server-to-client requests captured so far.
@@ -0,0 +1,205 @@
+package servertest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/owenrumney/go-lsp/document"
+	"github.com/owenrumney/go-lsp/lsp"
+	"github.com/owenrumney/go-lsp/server"
+	"github.com/owenrumney/go-lsp/servertest"
+)
+
+// scriptedClientHandler runs commands that make requests to the client and
+// returns what the client answered.
+type scriptedClientHandler struct {
+	*incrementalHandler
+	client *server.Client
+}
+
+func (h *scriptedClientHandler) SetClient(c *server.Client) { h.client = c }
+
+func (h *scriptedClientHandler) ExecuteCommand(ctx context.Context, params *lsp.ExecuteCommandParams) (any, error) {
+	switch params.Command {
+	case "ask":
+		item, err := h.client.ShowMessageRequest(ctx, &lsp.ShowMessageRequestParams{Message: "Continue?"})
+		if err != nil || item == nil {
+			return nil, err
+		}
+		return item.Title, nil
+	case "config":
+		scope := lsp.DocumentURI("file:///project")
+		return h.client.Configuration(ctx, &lsp.ConfigurationParams{Items: []lsp.ConfigurationItem{
+			{Section: "tabSize"},
+			{Section: "tabSize", ScopeURI: &scope},
+		}})
+	case "edit":
+		var edit lsp.WorkspaceEdit
+		if err := json.Unmarshal(params.Arguments[0], &edit); err != nil {
+			return nil, err
+		}
+		return h.client.ApplyEdit(ctx, &lsp.ApplyWorkspaceEditParams{Edit: edit})
+	}
+	return nil, nil
+}
+
+func newScriptedHarness(t *testing.T) *servertest.Harness {
+	return servertest.New(t, &scriptedClientHandler{incrementalHandler: &incrementalHandler{docs: document.NewStore()}})
+}
+
+func TestQueuedClientResponses(t *testing.T) {
+	h := newScriptedHarness(t)
+	h.QueueClientResponses("window/showMessageRequest",
+		servertest.Respond(lsp.MessageActionItem{Title: "Yes"}),
+		servertest.Respond(lsp.MessageActionItem{Title: "No"}),
+	)
+	h.SetClientResponse("window/showMessageRequest", lsp.MessageActionItem{Title: "Maybe"})
+
+	for _, want := range []string{`"Yes"`, `"No"`, `"Maybe"`, `"Maybe"`} {
+		got, err := h.ExecuteCommand("ask", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatalf("answer = %s, want %s", got, want)
+		}
+	}
+
+	h.QueueClientResponses("window/showMessageRequest", servertest.RespondError(errors.New("dismissed")))
+	if _, err := h.ExecuteCommand("ask", nil); err == nil || !strings.Contains(err.Error(), "dismissed") {
+		t.Fatalf("error = %v, want dismissed", err)
+	}
+}
+
+func TestRespondConfiguration(t *testing.T) {
+	h := newScriptedHarness(t)
+	h.SetClientResponder("workspace/configuration", servertest.RespondConfiguration(func(item lsp.ConfigurationItem) any {
+		if item.ScopeURI != nil {
+			return 2
+		}
+		return 4
+	}))
+
+	got, err := h.ExecuteCommand("config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "[4,2]" {
+		t.Fatalf("configuration = %s", got)
+	}
+}
+
+func TestDelayedClientResponse(t *testing.T) {
+	h := newScriptedHarness(t)
+	uri := lsp.DocumentURI("file:///a.txt")
+	if err := h.DidOpen(uri, "plaintext", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	h.SetClientResponder("window/showMessageRequest",
+		servertest.Delay(200*time.Millisecond, servertest.Respond(lsp.MessageActionItem{Title: "Late"})))
+
+	start := time.Now()
+	call, err := h.CallAsync("workspace/executeCommand", &lsp.ExecuteCommandParams{Command: "ask"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := h.WaitForClientRequest(ctx, "window/showMessageRequest"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The slow client must not hold up other traffic.
+	if _, err := h.Hover(uri, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Fatalf("hover waited for the delayed response (%v)", elapsed)
+	}
+
+	got, err := call.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `"Late"` || time.Since(start) < 200*time.Millisecond {
+		t.Fatalf("answer = %s after %v", got, time.Since(start))
+	}
+}
+
+func TestApplyEditResponder(t *testing.T) {
+	h := newScriptedHarness(t)
+	uri := lsp.DocumentURI("file:///a.txt")
+	if err := h.DidOpen(uri, "plaintext", "one two\nthree"); err != nil {
+		t.Fatal(err)
+	}
+	h.SetClientResponder("workspace/applyEdit", h.ApplyEditResponder())
+
+	applyEdit := func(edit lsp.WorkspaceEdit) lsp.ApplyWorkspaceEditResult {
+		t.Helper()
+		arg, _ := json.Marshal(edit)
+		raw, err := h.ExecuteCommand("edit", []json.RawMessage{arg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result lsp.ApplyWorkspaceEditResult
+		if err := json.Unmarshal(raw, &result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	at := func(line, char int) lsp.Position { return lsp.Position{Line: line, Character: char} }
+
+	result := applyEdit(lsp.WorkspaceEdit{Changes: map[lsp.DocumentURI][]lsp.TextEdit{uri: {
+		{Range: lsp.Range{Start: at(1, 0), End: at(1, 5)}, NewText: "3"},
+		{Range: lsp.Range{Start: at(0, 0), End: at(0, 3)}, NewText: "1"},
+		{Range: lsp.Range{Start: at(0, 7), End: at(0, 7)}, NewText: "!"},
+	}}})
+	if !result.Applied {
+		t.Fatalf("edit not applied: %s", result.FailureReason)
+	}
+	if text, _ := h.Text(uri); text != "1 two!\n3" {
+		t.Fatalf("mirror text = %q", text)
+	}
+	_, text := serverText(t, h, uri)
+	h.AssertText(uri, text)
+	if len(h.AppliedEdits()) != 1 {
+		t.Fatalf("AppliedEdits() = %d, want 1", len(h.AppliedEdits()))
+	}
+
+	// A replacement listed before an insertion at the same start.
+	result = applyEdit(lsp.WorkspaceEdit{Changes: map[lsp.DocumentURI][]lsp.TextEdit{uri: {
+		{Range: lsp.Range{Start: at(0, 2), End: at(0, 5)}, NewText: "2"},
+		{Range: lsp.Range{Start: at(0, 2), End: at(0, 2)}, NewText: "+"},
+	}}})
+	if !result.Applied {
+		t.Fatalf("edit not applied: %s", result.FailureReason)
+	}
+	if text, _ := h.Text(uri); text != "1 +2!\n3" {
+		t.Fatalf("mirror text = %q", text)
+	}
+	_, text = serverText(t, h, uri)
+	h.AssertText(uri, text)
+
+	stale := 1
+	result = applyEdit(lsp.WorkspaceEdit{DocumentChanges: []lsp.TextDocumentEdit{{
+		TextDocument: lsp.OptionalVersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri},
+			Version:                &stale,
+		},
+		Edits: []lsp.TextEdit{{Range: lsp.Range{Start: at(0, 0), End: at(0, 1)}, NewText: "x"}},
+	}}})
+	if result.Applied || !strings.Contains(result.FailureReason, "version") {
+		t.Fatalf("stale edit result = %+v", result)
+	}
+	result = applyEdit(lsp.WorkspaceEdit{Changes: map[lsp.DocumentURI][]lsp.TextEdit{"file:///closed.txt": {{NewText: "x"}}}})
+	if result.Applied || !strings.Contains(result.FailureReason, "not open") {
+		t.Fatalf("closed document result = %+v", result)
+	}
+	if text, _ := h.Text(uri); text != "1 +2!\n3" || len(h.AppliedEdits()) != 2 {
+		t.Fatalf("rejected edits changed state: %q, %d applied", text, len(h.AppliedEdits()))
+	}
+}
@@ -0,0 +1,674 @@
+package servertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/owenrumney/go-lsp/document"
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// Violation is a protocol rule broken by the server under test, found by the
+// checks enabled with WithConformanceChecks.
+type Violation struct {
+	// Method is the method of the offending message, or of the request a
+	// response answers.
+	Method string
+	// Message explains which rule was broken.
+	Message string
+}
+
+func (v Violation) String() string {
+	return v.Method + ": " + v.Message
+}
+
+// WithConformanceChecks validates every message the server sends against the
+// protocol. The test fails when it ends if the server:
+//
+//   - answers a request with a result of the wrong shape for its method
+//   - returns or publishes a range outside an open document, or one that is
+//     not measured in the negotiated position encoding (UTF-16 unless the
+//     server chose another)
+//   - answers a request for a method it did not advertise in its
+//     capabilities or register dynamically
+//   - publishes diagnostics for a document the client never opened, or with
+//     a version other than the document's current one
+//     (see WithStaleDiagnosticsAllowed)
+//   - sends a notification or request before the client sent initialized,
+//     other than those the protocol allows during initialization
+//
+// Ranges are checked against the harness's copy of each document. Use
+// Violations or AssertConformance to check earlier.
+func WithConformanceChecks() Option {
+	return func(c *config) {
+		c.conformance = true
+	}
+}
+
+// WithStaleDiagnosticsAllowed relaxes the conformance check on published
+// diagnostics to accept any version the client has sent for the document,
+// not only the current one. Use it for servers that compute diagnostics in
+// the background and may publish for a version the client has since changed;
+// versions the client never sent are still reported.
+func WithStaleDiagnosticsAllowed() Option {
+	return func(c *config) {
+		c.staleDiagnostics = true
+	}
+}
+
+// Violations returns the protocol violations found so far. It is always
+// empty unless the harness was created with WithConformanceChecks.
+func (h *Harness) Violations() []Violation {
+	if h.conformance == nil {
+		return nil
+	}
+	h.conformance.mu.Lock()
+	defer h.conformance.mu.Unlock()
+	return slices.Clone(h.conformance.violations)
+}
+
+// AssertConformance fails the test for each protocol violation found so far.
+// Reported violations are not reported again when the test ends.
+func (h *Harness) AssertConformance() {
+	h.t.Helper()
+	if h.conformance == nil {
+		return
+	}
+	for _, v := range h.conformance.take() {
+		h.t.Errorf("protocol violation: %s", v)
+	}
+}
+
+type pendingRequest struct {
+	method string
+	uri    lsp.DocumentURI
+}
+
+// conformance observes the frames exchanged with the server and records
+// protocol violations.
+type conformance struct {
+	docs *document.Store
+	// allowStale accepts diagnostics for earlier versions of a document.
+	allowStale bool
+
+	mu           sync.Mutex
+	violations   []Violation
+	initialized  bool
+	capabilities map[string]any
+	encoding     lsp.PositionEncodingKind
+	registered   map[string]bool
+	pending      map[string]pendingRequest
+	opened       map[lsp.DocumentURI]bool
+	versions     map[lsp.DocumentURI][]int
+}
+
+func newConformance(docs *document.Store, allowStale bool) *conformance {
+	return &conformance{
+		docs:       docs,
+		allowStale: allowStale,
+		encoding:   lsp.PositionEncodingUTF16,
+		registered: make(map[string]bool),
+		pending:    make(map[string]pendingRequest),
+		opened:     make(map[lsp.DocumentURI]bool),
+		versions:   make(map[lsp.DocumentURI][]int),
+	}
+}
+
+func (c *conformance) take() []Violation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v := c.violations
+	c.violations = nil
+	return v
+}
+
+func (c *conformance) violation(method, format string, args ...any) {
+	c.violations = append(c.violations, Violation{Method: method, Message: fmt.Sprintf(format, args...)})
+}
+
+// observe is called with every frame, before it is written or routed.
+func (c *conformance) observe(outgoing bool, data []byte) {
+	var msg rawMsg
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+	hasID := msg.ID != nil && string(*msg.ID) != "null"
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case outgoing && msg.Method != nil && hasID:
+		c.pending[idToString(msg.ID)] = pendingRequest{method: *msg.Method, uri: paramsURI(msg.Params)}
+	case outgoing && msg.Method != nil:
+		c.clientNotification(*msg.Method, msg.Params)
+	case !outgoing && msg.Method == nil && hasID:
+		id := idToString(msg.ID)
+		if req, ok := c.pending[id]; ok {
+			delete(c.pending, id)
+			c.response(req, msg)
+		}
+	case !outgoing && msg.Method != nil:
+		c.serverMessage(*msg.Method, msg.Params)
+	}
+}
+
+func paramsURI(params json.RawMessage) lsp.DocumentURI {
+	var p struct {
+		TextDocument struct {
+			URI lsp.DocumentURI `json:"uri"`
+		} `json:"textDocument"`
+	}
+	_ = json.Unmarshal(params, &p)
+	return p.TextDocument.URI
+}
+
+// clientNotification tracks the lifecycle and document state the client has
+// announced.
+func (c *conformance) clientNotification(method string, params json.RawMessage) {
+	var p struct {
+		TextDocument struct {
+			URI     lsp.DocumentURI `json:"uri"`
+			Version int             `json:"version"`
+		} `json:"textDocument"`
+	}
+	_ = json.Unmarshal(params, &p)
+	uri := p.TextDocument.URI
+
+	switch method {
+	case "initialized":
+		c.initialized = true
+	case "textDocument/didOpen":
+		c.opened[uri] = true
+		c.versions[uri] = []int{p.TextDocument.Version}
+	case "textDocument/didChange":
+		c.versions[uri] = append(c.versions[uri], p.TextDocument.Version)
+	case "textDocument/didClose":
+		delete(c.versions, uri)
+	}
+}
+
+// allowedBeforeInitialized lists the messages a server may send while the
+// client is still initializing.
+var allowedBeforeInitialized = []string{
+	"window/showMessage",
+	"window/logMessage",
+	"telemetry/event",
+	"window/showMessageRequest",
+	"window/workDoneProgress/create",
+	"$/progress",
+}
+
+func (c *conformance) serverMessage(method string, params json.RawMessage) {
+	if !c.initialized && !slices.Contains(allowedBeforeInitialized, method) {
+		c.violation(method, "sent before the client sent initialized; only %s are allowed then",
+			strings.Join(allowedBeforeInitialized, ", "))
+	}
+
+	switch method {
+	case "textDocument/publishDiagnostics":
+		c.diagnostics(method, params)
+	case "client/registerCapability", "client/unregisterCapability":
+		var p struct {
+			Registrations   []struct{ Method string } `json:"registrations"`
+			Unregistrations []struct{ Method string } `json:"unregisterations"`
+		}
+		_ = json.Unmarshal(params, &p)
+		for _, r := range p.Registrations {
+			c.registered[r.Method] = true
+		}
+		for _, r := range p.Unregistrations {
+			delete(c.registered, r.Method)
+		}
+	}
+}
+
+func (c *conformance) diagnostics(method string, params json.RawMessage) {
+	var p lsp.PublishDiagnosticsParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		c.violation(method, "invalid params: %v", err)
+		return
+	}
+	if !c.opened[p.URI] {
+		if len(p.Diagnostics) > 0 {
+			c.violation(method, "diagnostics published for %s, which the client never opened", p.URI)
+		}
+		return
+	}
+
+	versions, open := c.versions[p.URI]
+	current := 0
+	if open {
+		current = versions[len(versions)-1]
+	}
+	if p.Version != nil && open && *p.Version != current {
+		switch {
+		case !slices.Contains(versions, *p.Version):
+			c.violation(method, "diagnostics for %s have version %d, which the client never sent (current version %d)",
+				p.URI, *p.Version, current)
+			return
+		case !c.allowStale:
+			c.violation(method, "diagnostics for %s have version %d, but the current version is %d; "+
+				"publish for the current version or use WithStaleDiagnosticsAllowed", p.URI, *p.Version, current)
+			return
+		}
+	}
+	// Ranges can only be checked against the text they were computed for.
+	if p.Version == nil || *p.Version == current {
+		var v any
+		_ = json.Unmarshal(params, &v)
+		c.checkRanges(method, v, p.URI)
+	}
+}
+
+func (c *conformance) response(req pendingRequest, msg rawMsg) {
+	if msg.Error != nil {
+		return
+	}
+	var result any
+	if err := json.Unmarshal(msg.Result, &result); err != nil && len(msg.Result) > 0 {
+		c.violation(req.method, "invalid result: %v", err)
+		return
+	}
+
+	if req.method == "initialize" {
+		if m, ok := result.(map[string]any); ok {
+			c.capabilities, _ = m["capabilities"].(map[string]any)
+		}
+		var init lsp.InitializeResult
+		if json.Unmarshal(msg.Result, &init) == nil {
+			c.encoding = negotiatedEncoding(init.Capabilities)
+		}
+	} else if path, ok := c.unadvertised(req.method); ok {
+		c.violation(req.method, "answered although the server did not advertise %s or register %s; "+
+			"return MethodNotFound or advertise the capability", path, req.method)
+	}
+
+	if s, ok := resultShapes[req.method]; ok {
+		if problem := s(result); problem != "" {
+			c.violation(req.method, "result has the wrong shape: %s", problem)
+			return
+		}
+	}
+	c.checkRanges(req.method, result, req.uri)
+}
+
+// methodCapabilities maps requests to the server capability that advertises
+// them, as a dotted path into ServerCapabilities.
+var methodCapabilities = map[string]string{
+	"textDocument/hover":                     "hoverProvider",
+	"textDocument/completion":                "completionProvider",
+	"completionItem/resolve":                 "completionProvider.resolveProvider",
+	"textDocument/signatureHelp":             "signatureHelpProvider",
+	"textDocument/declaration":               "declarationProvider",
+	"textDocument/definition":                "definitionProvider",
+	"textDocument/typeDefinition":            "typeDefinitionProvider",
+	"textDocument/implementation":            "implementationProvider",
+	"textDocument/references":                "referencesProvider",
+	"textDocument/documentHighlight":         "documentHighlightProvider",
+	"textDocument/documentSymbol":            "documentSymbolProvider",
+	"textDocument/codeAction":                "codeActionProvider",
+	"codeAction/resolve":                     "codeActionProvider.resolveProvider",
+	"textDocument/codeLens":                  "codeLensProvider",
+	"codeLens/resolve":                       "codeLensProvider.resolveProvider",
+	"textDocument/documentLink":              "documentLinkProvider",
+	"documentLink/resolve":                   "documentLinkProvider.resolveProvider",
+	"textDocument/documentColor":             "colorProvider",
+	"textDocument/colorPresentation":         "colorProvider",
+	"textDocument/formatting":                "documentFormattingProvider",
+	"textDocument/rangeFormatting":           "documentRangeFormattingProvider",
+	"textDocument/onTypeFormatting":          "documentOnTypeFormattingProvider",
+	"textDocument/rename":                    "renameProvider",
+	"textDocument/prepareRename":             "renameProvider.prepareProvider",
+	"textDocument/foldingRange":              "foldingRangeProvider",
+	"textDocument/selectionRange":            "selectionRangeProvider",
+	"textDocument/linkedEditingRange":        "linkedEditingRangeProvider",
+	"textDocument/prepareCallHierarchy":      "callHierarchyProvider",
+	"callHierarchy/incomingCalls":            "callHierarchyProvider",
+	"callHierarchy/outgoingCalls":            "callHierarchyProvider",
+	"textDocument/prepareTypeHierarchy":      "typeHierarchyProvider",
+	"typeHierarchy/supertypes":               "typeHierarchyProvider",
+	"typeHierarchy/subtypes":                 "typeHierarchyProvider",
+	"textDocument/semanticTokens/full":       "semanticTokensProvider.full",
+	"textDocument/semanticTokens/full/delta": "semanticTokensProvider.full.delta",
+	"textDocument/semanticTokens/range":      "semanticTokensProvider.range",
+	"textDocument/moniker":                   "monikerProvider",
+	"textDocument/inlayHint":                 "inlayHintProvider",
+	"inlayHint/resolve":                      "inlayHintProvider.resolveProvider",
+	"textDocument/inlineValue":               "inlineValueProvider",
+	"textDocument/diagnostic":                "diagnosticProvider",
+	"workspace/diagnostic":                   "diagnosticProvider.workspaceDiagnostics",
+	"textDocument/willSaveWaitUntil":         "textDocumentSync.willSaveWaitUntil",
+	"workspace/symbol":                       "workspaceSymbolProvider",
+	"workspace/executeCommand":               "executeCommandProvider",
+	"workspace/willCreateFiles":              "workspace.fileOperations.willCreate",
+	"workspace/willRenameFiles":              "workspace.fileOperations.willRename",
+	"workspace/willDeleteFiles":              "workspace.fileOperations.willDelete",
+}
+
+// registrationMethods maps requests to the method a client/registerCapability
+// registration uses for them, where the two differ.
+var registrationMethods = map[string]string{
+	"completionItem/resolve":                 "textDocument/completion",
+	"codeAction/resolve":                     "textDocument/codeAction",
+	"codeLens/resolve":                       "textDocument/codeLens",
+	"documentLink/resolve":                   "textDocument/documentLink",
+	"inlayHint/resolve":                      "textDocument/inlayHint",
+	"textDocument/colorPresentation":         "textDocument/documentColor",
+	"textDocument/prepareRename":             "textDocument/rename",
+	"callHierarchy/incomingCalls":            "textDocument/prepareCallHierarchy",
+	"callHierarchy/outgoingCalls":            "textDocument/prepareCallHierarchy",
+	"typeHierarchy/supertypes":               "textDocument/prepareTypeHierarchy",
+	"typeHierarchy/subtypes":                 "textDocument/prepareTypeHierarchy",
+	"textDocument/semanticTokens/full":       "textDocument/semanticTokens",
+	"textDocument/semanticTokens/full/delta": "textDocument/semanticTokens",
+	"textDocument/semanticTokens/range":      "textDocument/semanticTokens",
+	"workspace/diagnostic":                   "textDocument/diagnostic",
+}
+
+// unadvertised reports whether method is a capability-gated request that the
+// server neither advertised nor registered, and returns the missing
+// capability.
+func (c *conformance) unadvertised(method string) (string, bool) {
+	path, ok := methodCapabilities[method]
+	if !ok || c.capabilities == nil {
+		return "", false
+	}
+	if c.registered[method] || c.registered[registrationMethods[method]] {
+		return "", false
+	}
+
+	var v any = c.capabilities
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return path, true
+		}
+		v = m[key]
+	}
+	if v == nil || v == false {
+		return path, true
+	}
+	return "", false
+}
+
+// checkRanges finds every range and position in v and checks it against the
+// open document it refers to. Ranges without a known document are skipped.
+func (c *conformance) checkRanges(method string, v any, uri lsp.DocumentURI) {
+	switch x := v.(type) {
+	case []any:
+		for _, e := range x {
+			c.checkRanges(method, e, uri)
+		}
+	case map[string]any:
+		if s, ok := x["uri"].(string); ok {
+			uri = lsp.DocumentURI(s)
+		}
+		if td, ok := x["textDocument"].(map[string]any); ok {
+			if s, ok := td["uri"].(string); ok {
+				uri = lsp.DocumentURI(s)
+			}
+		}
+		if r, ok := asRange(x); ok {
+			c.checkRange(method, uri, r)
+			return
+		}
+
+		for _, key := range slices.Sorted(maps.Keys(x)) {
+			e := x[key]
+			switch key {
+			case "changes":
+				if m, ok := e.(map[string]any); ok {
+					for _, u := range slices.Sorted(maps.Keys(m)) {
+						c.checkRanges(method, m[u], lsp.DocumentURI(u))
+					}
+					continue
+				}
+			case "targetRange", "targetSelectionRange":
+				if s, ok := x["targetUri"].(string); ok {
+					c.checkRanges(method, e, lsp.DocumentURI(s))
+					continue
+				}
+			case "position":
+				if p, ok := asPosition(e); ok {
+					if problem := c.positionProblem(uri, p); problem != "" {
+						c.violation(method, "position %d:%d in %s: %s", p.Line, p.Character, uri, problem)
+					}
+					continue
+				}
+			}
+			c.checkRanges(method, e, uri)
+		}
+	}
+}
+
+func asPosition(v any) (lsp.Position, bool) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 2 {
+		return lsp.Position{}, false
+	}
+	line, ok1 := m["line"].(float64)
+	char, ok2 := m["character"].(float64)
+	if !ok1 || !ok2 {
+		return lsp.Position{}, false
+	}
+	return lsp.Position{Line: int(line), Character: int(char)}, true
+}
+
+func asRange(m map[string]any) (lsp.Range, bool) {
+	if len(m) != 2 {
+		return lsp.Range{}, false
+	}
+	start, ok1 := asPosition(m["start"])
+	end, ok2 := asPosition(m["end"])
+	return lsp.Range{Start: start, End: end}, ok1 && ok2
+}
+
+func (c *conformance) checkRange(method string, uri lsp.DocumentURI, r lsp.Range) {
+	if uri == "" {
+		return
+	}
+	problem := c.positionProblem(uri, r.Start)
+	if problem == "" {
+		problem = c.positionProblem(uri, r.End)
+	}
+	if problem == "" && (r.Start.Line > r.End.Line || r.Start.Line == r.End.Line && r.Start.Character > r.End.Character) {
+		problem = "start is after end"
+	}
+	if problem != "" {
+		c.violation(method, "range %s in %s: %s", formatRange(r), uri, problem)
+	}
+}
+
+// positionProblem describes why p is not a valid position, in the negotiated
+// encoding, in the harness's copy of uri, or returns "" if it is valid or uri
+// is not open.
+func (c *conformance) positionProblem(uri lsp.DocumentURI, p lsp.Position) string {
+	doc, ok := c.docs.Get(uri)
+	if !ok {
+		return ""
+	}
+	lines := doc.Lines()
+	switch {
+	case p.Line < 0 || p.Character < 0:
+		return "negative position"
+	case p.Line >= len(lines):
+		return fmt.Sprintf("line %d is past the end of the document (%d lines)", p.Line, len(lines))
+	}
+
+	line := strings.TrimSuffix(lines[p.Line], "\r")
+	units := 0
+	for _, r := range line {
+		n := runeUnits(c.encoding, r)
+		if p.Character > units && p.Character < units+n {
+			if c.encoding == lsp.PositionEncodingUTF8 {
+				return fmt.Sprintf("character %d splits a UTF-8 sequence", p.Character)
+			}
+			return fmt.Sprintf("character %d splits a UTF-16 surrogate pair", p.Character)
+		}
+		units += n
+	}
+	if p.Character <= units {
+		return ""
+	}
+	problem := fmt.Sprintf("character %d is past the end of line %d (%d %s)", p.Character, p.Line, units, unitName(c.encoding))
+	if c.encoding != lsp.PositionEncodingUTF8 && p.Character <= len(line) && utf8.RuneCountInString(line) != len(line) {
+		problem += fmt.Sprintf("; the line is %d bytes long, so this looks like a byte offset", len(line))
+	}
+	return problem
+}
+
+// shape checks the JSON form of a result, returning a description of the
+// problem or "".
+type shape func(v any) string
+
+func anyShape(any) string { return "" }
+
+func nullable(s shape) shape {
+	return func(v any) string {
+		if v == nil {
+			return ""
+		}
+		return s(v)
+	}
+}
+
+func object(keys ...string) shape {
+	return func(v any) string {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Sprintf("got %s, want an object", jsonKind(v))
+		}
+		for _, k := range keys {
+			if _, ok := m[k]; !ok {
+				return fmt.Sprintf("object is missing %q", k)
+			}
+		}
+		return ""
+	}
+}
+
+func arrayOf(s shape) shape {
+	return func(v any) string {
+		a, ok := v.([]any)
+		if !ok {
+			return fmt.Sprintf("got %s, want an array", jsonKind(v))
+		}
+		for i, e := range a {
+			if problem := s(e); problem != "" {
+				return fmt.Sprintf("element %d: %s", i, problem)
+			}
+		}
+		return ""
+	}
+}
+
+// oneOf accepts v if any of shapes does, and otherwise reports the problem
+// found by the first.
+func oneOf(shapes ...shape) shape {
+	return func(v any) string {
+		first := ""
+		for i, s := range shapes {
+			problem := s(v)
+			if problem == "" {
+				return ""
+			}
+			if i == 0 {
+				first = problem
+			}
+		}
+		return first
+	}
+}
+
+func null(v any) string {
+	if v != nil {
+		return fmt.Sprintf("got %s, want null", jsonKind(v))
+	}
+	return ""
+}
+
+func jsonKind(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	case string:
+		return "a string"
+	case float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+var (
+	rangeShape     = object("start", "end")
+	locationShape  = object("uri", "range")
+	linkShape      = object("targetUri", "targetRange", "targetSelectionRange")
+	textEditsShape = nullable(arrayOf(object("range", "newText")))
+	locationsShape = nullable(oneOf(locationShape, arrayOf(locationShape), arrayOf(linkShape)))
+	hierarchyShape = nullable(arrayOf(object("name", "kind", "uri", "range", "selectionRange")))
+)
+
+// resultShapes describes the result each request must return.
+var resultShapes = map[string]shape{
+	"initialize":                             object("capabilities"),
+	"shutdown":                               null,
+	"textDocument/hover":                     nullable(object("contents")),
+	"textDocument/completion":                nullable(oneOf(object("isIncomplete", "items"), arrayOf(object("label")))),
+	"completionItem/resolve":                 object("label"),
+	"textDocument/signatureHelp":             nullable(object("signatures")),
+	"textDocument/declaration":               locationsShape,
+	"textDocument/definition":                locationsShape,
+	"textDocument/typeDefinition":            locationsShape,
+	"textDocument/implementation":            locationsShape,
+	"textDocument/references":                nullable(arrayOf(locationShape)),
+	"textDocument/documentHighlight":         nullable(arrayOf(object("range"))),
+	"textDocument/documentSymbol":            nullable(oneOf(arrayOf(object("name", "kind", "range", "selectionRange")), arrayOf(object("name", "kind", "location")))),
+	"textDocument/codeAction":                nullable(arrayOf(object("title"))),
+	"codeAction/resolve":                     object("title"),
+	"textDocument/codeLens":                  nullable(arrayOf(object("range"))),
+	"codeLens/resolve":                       object("range"),
+	"textDocument/documentLink":              nullable(arrayOf(object("range"))),
+	"documentLink/resolve":                   object("range"),
+	"textDocument/documentColor":             arrayOf(object("range", "color")),
+	"textDocument/colorPresentation":         arrayOf(object("label")),
+	"textDocument/formatting":                textEditsShape,
+	"textDocument/rangeFormatting":           textEditsShape,
+	"textDocument/onTypeFormatting":          textEditsShape,
+	"textDocument/willSaveWaitUntil":         textEditsShape,
+	"textDocument/rename":                    nullable(object()),
+	"textDocument/prepareRename":             nullable(oneOf(rangeShape, object("range", "placeholder"), object("defaultBehavior"))),
+	"textDocument/foldingRange":              nullable(arrayOf(object("startLine", "endLine"))),
+	"textDocument/selectionRange":            nullable(arrayOf(object("range"))),
+	"textDocument/linkedEditingRange":        nullable(object("ranges")),
+	"textDocument/prepareCallHierarchy":      hierarchyShape,
+	"callHierarchy/incomingCalls":            nullable(arrayOf(object("from", "fromRanges"))),
+	"callHierarchy/outgoingCalls":            nullable(arrayOf(object("to", "fromRanges"))),
+	"textDocument/prepareTypeHierarchy":      hierarchyShape,
+	"typeHierarchy/supertypes":               hierarchyShape,
+	"typeHierarchy/subtypes":                 hierarchyShape,
+	"textDocument/semanticTokens/full":       nullable(object("data")),
+	"textDocument/semanticTokens/full/delta": nullable(oneOf(object("data"), object("edits"))),
+	"textDocument/semanticTokens/range":      nullable(object("data")),
+	"textDocument/moniker":                   nullable(arrayOf(object("scheme", "identifier", "unique"))),
+	"textDocument/inlayHint":                 nullable(arrayOf(object("position", "label"))),
+	"inlayHint/resolve":                      object("position", "label"),
+	"textDocument/inlineValue":               nullable(arrayOf(object("range"))),
+	"textDocument/diagnostic":                object("kind"),
+	"workspace/diagnostic":                   object("items"),
+	"workspace/symbol":                       nullable(arrayOf(object("name", "kind", "location"))),
+	"workspace/executeCommand":               anyShape,
+	"workspace/willCreateFiles":              nullable(object()),
+	"workspace/willRenameFiles":              nullable(object()),
+	"workspace/willDeleteFiles":              nullable(object()),
+}
@@ -0,0 +1,245 @@
+package servertest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/owenrumney/go-lsp/document"
+	"github.com/owenrumney/go-lsp/lsp"
+	"github.com/owenrumney/go-lsp/server"
+	"github.com/owenrumney/go-lsp/servertest"
+)
+
+// sloppyHandler breaks a protocol rule in each of its methods.
+type sloppyHandler struct {
+	client *server.Client
+}
+
+func (h *sloppyHandler) SetClient(c *server.Client) { h.client = c }
+
+func (h *sloppyHandler) Initialize(ctx context.Context, _ *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	_ = h.client.Notify(ctx, "custom/early", nil)
+	// Advertises completion without resolve, although resolve is implemented.
+	return &lsp.InitializeResult{Capabilities: lsp.ServerCapabilities{
+		CompletionProvider: &lsp.CompletionOptions{},
+	}}, nil
+}
+
+func (h *sloppyHandler) Shutdown(_ context.Context) error { return nil }
+
+func (h *sloppyHandler) DidOpen(ctx context.Context, params *lsp.DidOpenTextDocumentParams) error {
+	wrongVersion := params.TextDocument.Version + 5
+	_ = h.client.PublishDiagnostics(ctx, &lsp.PublishDiagnosticsParams{
+		URI:         "file:///never-opened.go",
+		Diagnostics: []lsp.Diagnostic{{Message: "unused"}},
+	})
+	return h.client.PublishDiagnostics(ctx, &lsp.PublishDiagnosticsParams{
+		URI:         params.TextDocument.URI,
+		Version:     &wrongVersion,
+		Diagnostics: []lsp.Diagnostic{},
+	})
+}
+
+func (h *sloppyHandler) DidChange(_ context.Context, _ *lsp.DidChangeTextDocumentParams) error {
+	return nil
+}
+
+func (h *sloppyHandler) DidClose(_ context.Context, _ *lsp.DidCloseTextDocumentParams) error {
+	return nil
+}
+
+// Hover measures its range in bytes rather than UTF-16 code units.
+func (h *sloppyHandler) Hover(_ context.Context, _ *lsp.HoverParams) (*lsp.Hover, error) {
+	r := lsp.Range{Start: lsp.Position{Line: 0, Character: 4}, End: lsp.Position{Line: 0, Character: 12}}
+	return &lsp.Hover{Contents: lsp.MarkupContent{Kind: lsp.PlainText, Value: "x"}, Range: &r}, nil
+}
+
+func (h *sloppyHandler) Completion(_ context.Context, _ *lsp.CompletionParams) (*lsp.CompletionList, error) {
+	return &lsp.CompletionList{Items: []lsp.CompletionItem{{Label: "x"}}}, nil
+}
+
+func (h *sloppyHandler) ResolveCompletionItem(_ context.Context, item *lsp.CompletionItem) (*lsp.CompletionItem, error) {
+	return item, nil
+}
+
+// DocumentDiagnostic omits the report kind.
+func (h *sloppyHandler) DocumentDiagnostic(_ context.Context, _ *lsp.DocumentDiagnosticParams) (any, error) {
+	return map[string]any{"items": []any{}}, nil
+}
+
+func TestConformanceViolations(t *testing.T) {
+	rec := &recordingTB{T: t}
+	h := servertest.New(rec, &sloppyHandler{}, servertest.WithConformanceChecks())
+	uri := lsp.DocumentURI("file:///a.go")
+	if err := h.DidOpen(uri, "go", "x := \"🌍🌍\""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Hover(uri, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.ResolveCompletionItem(&lsp.CompletionItem{Label: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.DocumentDiagnostic(&lsp.DocumentDiagnosticParams{TextDocument: lsp.TextDocumentIdentifier{URI: uri}}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"custom/early: sent before the client sent initialized",
+		"never-opened.go, which the client never opened",
+		"have version 6, which the client never sent (current version 1)",
+		"textDocument/hover: range 0:4-0:12 in file:///a.go: character 12 is past the end of line 0 (11 UTF-16 code units); the line is 15 bytes long, so this looks like a byte offset",
+		"completionItem/resolve: answered although the server did not advertise completionProvider.resolveProvider",
+		`textDocument/diagnostic: result has the wrong shape: object is missing "kind"`,
+	}
+	got := h.Violations()
+	if len(got) != len(want) {
+		t.Fatalf("violations = %q, want %d", got, len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(got[i].String(), w) {
+			t.Errorf("violation %d = %q, want it to contain %q", i, got[i], w)
+		}
+	}
+
+	h.AssertConformance()
+	if len(rec.errors) != len(want) || len(h.Violations()) != 0 {
+		t.Fatalf("AssertConformance reported %d errors, %d violations left", len(rec.errors), len(h.Violations()))
+	}
+}
+
+// byteRangeHandler negotiates UTF-8 positions, creates a progress token while
+// initializing, and answers hover with the range it is given.
+type byteRangeHandler struct {
+	sloppyHandler
+	hoverRange lsp.Range
+}
+
+func (h *byteRangeHandler) Initialize(ctx context.Context, _ *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	if err := h.client.CreateWorkDoneProgress(ctx, &lsp.WorkDoneProgressCreateParams{Token: lsp.ProgressToken(`"init"`)}); err != nil {
+		return nil, err
+	}
+	enc := lsp.PositionEncodingUTF8
+	return &lsp.InitializeResult{Capabilities: lsp.ServerCapabilities{
+		PositionEncoding: &enc,
+		HoverProvider:    boolPtr(true),
+	}}, nil
+}
+
+func (h *byteRangeHandler) DidOpen(_ context.Context, _ *lsp.DidOpenTextDocumentParams) error {
+	return nil
+}
+
+func (h *byteRangeHandler) Hover(_ context.Context, _ *lsp.HoverParams) (*lsp.Hover, error) {
+	r := h.hoverRange
+	return &lsp.Hover{Contents: lsp.MarkupContent{Kind: lsp.PlainText, Value: "x"}, Range: &r}, nil
+}
+
+func TestConformanceUTF8Server(t *testing.T) {
+	handler := &byteRangeHandler{}
+	h := servertest.New(&recordingTB{T: t}, handler, servertest.WithConformanceChecks())
+	uri := lsp.DocumentURI("file:///a.go")
+	if err := h.DidOpen(uri, "go", "x := \"🌍🌍\""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The line is 15 bytes long, so a byte range to its end is valid.
+	handler.hoverRange = lsp.Range{Start: lsp.Position{Line: 0, Character: 6}, End: lsp.Position{Line: 0, Character: 15}}
+	if _, err := h.Hover(uri, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if v := h.Violations(); len(v) != 0 {
+		t.Fatalf("violations = %q", v)
+	}
+
+	handler.hoverRange = lsp.Range{Start: lsp.Position{Line: 0, Character: 6}, End: lsp.Position{Line: 0, Character: 8}}
+	if _, err := h.Hover(uri, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	handler.hoverRange = lsp.Range{Start: lsp.Position{Line: 0, Character: 6}, End: lsp.Position{Line: 0, Character: 16}}
+	if _, err := h.Hover(uri, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"textDocument/hover: range 0:6-0:8 in file:///a.go: character 8 splits a UTF-8 sequence",
+		"textDocument/hover: range 0:6-0:16 in file:///a.go: character 16 is past the end of line 0 (15 UTF-8 code units)",
+	}
+	got := h.Violations()
+	if len(got) != len(want) {
+		t.Fatalf("violations = %q, want %d", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].String() != w {
+			t.Errorf("violation %d = %q, want %q", i, got[i], w)
+		}
+	}
+}
+
+// staleHandler publishes diagnostics for the version before each change.
+type staleHandler struct {
+	sloppyHandler
+}
+
+func (h *staleHandler) Initialize(_ context.Context, _ *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	return &lsp.InitializeResult{}, nil
+}
+
+func (h *staleHandler) DidOpen(_ context.Context, _ *lsp.DidOpenTextDocumentParams) error {
+	return nil
+}
+
+func (h *staleHandler) DidChange(ctx context.Context, params *lsp.DidChangeTextDocumentParams) error {
+	previous := params.TextDocument.Version - 1
+	return h.client.PublishDiagnostics(ctx, &lsp.PublishDiagnosticsParams{
+		URI:         params.TextDocument.URI,
+		Version:     &previous,
+		Diagnostics: []lsp.Diagnostic{},
+	})
+}
+
+func TestConformanceStaleDiagnostics(t *testing.T) {
+	for _, allowStale := range []bool{false, true} {
+		opts := []servertest.Option{servertest.WithConformanceChecks()}
+		if allowStale {
+			opts = append(opts, servertest.WithStaleDiagnosticsAllowed())
+		}
+		h := servertest.New(&recordingTB{T: t}, &staleHandler{}, opts...)
+		uri := lsp.DocumentURI("file:///a.go")
+		if err := h.DidOpen(uri, "go", "x"); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.DidChange(uri, 2, "y"); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := h.WaitForDiagnostics(ctx, uri)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := h.Violations()
+		if allowStale && len(got) != 0 {
+			t.Errorf("allowing stale diagnostics: violations = %q", got)
+		}
+		if !allowStale && (len(got) != 1 || !strings.Contains(got[0].String(), "have version 1, but the current version is 2")) {
+			t.Errorf("violations = %q, want one for version 1", got)
+		}
+	}
+}
+
+func TestConformingServer(t *testing.T) {
+	h := servertest.New(t, &wordHandler{docs: document.NewStore()}, servertest.WithConformanceChecks())
+	f := h.OpenFixture("file:///main.go", "go", "[[count]] := \"🌍\"\nprint([[co|unt]])")
+	if _, err := h.HoverAt(f, servertest.CursorMarker); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.ReferencesAt(f, servertest.CursorMarker, true); err != nil {
+		t.Fatal(err)
+	}
+	if v := h.Violations(); len(v) != 0 {
+		t.Fatalf("violations = %q", v)
+	}
+}
@@ -0,0 +1,113 @@
+package servertest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/owenrumney/go-lsp/document"
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// Edit sends a textDocument/didChange notification with the given ranged
+// changes, as an editor using incremental sync would. The version is
+// incremented automatically and the changes are applied to the harness's copy
+// of the document, so later edits can be expressed against the current text.
+//
+// The document must have been opened with DidOpen. Changes are applied in
+// order, each against the result of the previous one. Ranges are measured in
+// the negotiated PositionEncoding.
+func (h *Harness) Edit(uri lsp.DocumentURI, changes ...lsp.TextDocumentContentChangeEvent) error {
+	doc, ok := h.docs.Get(uri)
+	if !ok {
+		return fmt.Errorf("%w: %s", document.ErrDocumentNotFound, uri)
+	}
+
+	params := &lsp.DidChangeTextDocumentParams{
+		TextDocument: lsp.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri},
+			Version:                doc.Version() + 1,
+		},
+		ContentChanges: changes,
+	}
+	mirror := params
+	if h.encoding != lsp.PositionEncodingUTF16 {
+		changes, err := utf16Changes(doc.Text(), h.encoding, changes)
+		if err != nil {
+			return err
+		}
+		mirror = &lsp.DidChangeTextDocumentParams{TextDocument: params.TextDocument, ContentChanges: changes}
+	}
+	if _, err := h.docs.Change(mirror); err != nil {
+		return err
+	}
+
+	return h.conn.notify(h.ctx, "textDocument/didChange", params)
+}
+
+// Insert inserts text at pos.
+func (h *Harness) Insert(uri lsp.DocumentURI, pos lsp.Position, text string) error {
+	return h.Replace(uri, lsp.Range{Start: pos, End: pos}, text)
+}
+
+// Delete removes the text in r.
+func (h *Harness) Delete(uri lsp.DocumentURI, r lsp.Range) error {
+	return h.Replace(uri, r, "")
+}
+
+// Replace replaces the text in r with text.
+func (h *Harness) Replace(uri lsp.DocumentURI, r lsp.Range, text string) error {
+	return h.Edit(uri, lsp.TextDocumentContentChangeEvent{Range: &r, Text: text})
+}
+
+// Type simulates typing text at pos, sending one didChange per character
+// just as an editor does for keystrokes.
+func (h *Harness) Type(uri lsp.DocumentURI, pos lsp.Position, text string) error {
+	for _, r := range text {
+		if err := h.Insert(uri, pos, string(r)); err != nil {
+			return err
+		}
+		if r == '\n' {
+			pos = lsp.Position{Line: pos.Line + 1}
+		} else {
+			pos.Character += runeUnits(h.encoding, r)
+		}
+	}
+	return nil
+}
+
+// Text returns the harness's copy of an open document, reflecting every
+// change sent so far.
+func (h *Harness) Text(uri lsp.DocumentURI) (string, bool) {
+	return h.docs.Text(uri)
+}
+
+// AssertText fails the test if serverText, the document text reconstructed by
+// the server under test, differs from the harness's copy of the document.
+func (h *Harness) AssertText(uri lsp.DocumentURI, serverText string) {
+	h.t.Helper()
+
+	want, ok := h.docs.Text(uri)
+	if !ok {
+		h.t.Errorf("document %s is not open", uri)
+		return
+	}
+	if serverText == want {
+		return
+	}
+
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(serverText, "\n")
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g || i >= len(wantLines) || i >= len(gotLines) {
+			h.t.Errorf("server text for %s differs from client at line %d:\n  client: %q\n  server: %q", uri, i, w, g)
+			return
+		}
+	}
+}
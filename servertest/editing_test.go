@@ -0,0 +1,239 @@
+package servertest_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/owenrumney/go-lsp/document"
+	"github.com/owenrumney/go-lsp/lsp"
+	"github.com/owenrumney/go-lsp/servertest"
+)
+
+// incrementalHandler reconstructs documents from incremental changes and
+// returns the full text from hover so tests can compare it with the mirror.
+type incrementalHandler struct {
+	docs *document.Store
+}
+
+func (h *incrementalHandler) Initialize(_ context.Context, _ *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	return &lsp.InitializeResult{
+		Capabilities: lsp.ServerCapabilities{
+			TextDocumentSync: &lsp.TextDocumentSyncOptions{OpenClose: boolPtr(true), Change: lsp.SyncIncremental},
+		},
+	}, nil
+}
+
+func (h *incrementalHandler) Shutdown(_ context.Context) error { return nil }
+
+func (h *incrementalHandler) DidOpen(_ context.Context, params *lsp.DidOpenTextDocumentParams) error {
+	_, err := h.docs.Open(params)
+	return err
+}
+
+func (h *incrementalHandler) DidChange(_ context.Context, params *lsp.DidChangeTextDocumentParams) error {
+	_, err := h.docs.Change(params)
+	return err
+}
+
+func (h *incrementalHandler) DidClose(_ context.Context, params *lsp.DidCloseTextDocumentParams) error {
+	h.docs.Close(params)
+	return nil
+}
+
+func (h *incrementalHandler) Hover(_ context.Context, params *lsp.HoverParams) (*lsp.Hover, error) {
+	doc, ok := h.docs.Get(params.TextDocument.URI)
+	if !ok {
+		return nil, nil
+	}
+	return &lsp.Hover{Contents: lsp.MarkupContent{
+		Kind:  lsp.PlainText,
+		Value: fmt.Sprintf("%d:%s", doc.Version(), doc.Text()),
+	}}, nil
+}
+
+// serverText returns the server's version and text for uri. Hover is answered
+// after every earlier notification has been handled.
+func serverText(t *testing.T, h *servertest.Harness, uri lsp.DocumentURI) (int, string) {
+	t.Helper()
+	hover, err := h.Hover(uri, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix, text, _ := strings.Cut(hover.Contents.Value, ":")
+	version, err := strconv.Atoi(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version, text
+}
+
+func TestIncrementalEditing(t *testing.T) {
+	uri := lsp.DocumentURI("file:///edit.go")
+	h := servertest.New(t, &incrementalHandler{docs: document.NewStore()})
+
+	if err := h.DidOpen(uri, "go", "package main\n\nfunc main() {\n}\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Type(uri, lsp.Position{Line: 2, Character: 13}, "\n\tprintln(\"héllo 🌍\")"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Replace(uri, lsp.Range{
+		Start: lsp.Position{Line: 0, Character: 8},
+		End:   lsp.Position{Line: 0, Character: 12},
+	}, "demo"); err != nil {
+		t.Fatal(err)
+	}
+	// Insert after the surrogate pair to check UTF-16 positions.
+	if err := h.Insert(uri, lsp.Position{Line: 3, Character: 18}, "!"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Delete(uri, lsp.Range{
+		Start: lsp.Position{Line: 1, Character: 0},
+		End:   lsp.Position{Line: 2, Character: 0},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "package demo\nfunc main() {\n\tprintln(\"héllo 🌍!\")\n}\n"
+	if got, _ := h.Text(uri); got != want {
+		t.Fatalf("mirror text = %q, want %q", got, want)
+	}
+
+	version, text := serverText(t, h, uri)
+	h.AssertText(uri, text)
+	// didOpen is version 1, then 20 keystrokes and 3 edits.
+	if version != 24 {
+		t.Fatalf("server version = %d, want 24", version)
+	}
+}
+
+func TestEditUnopenedDocument(t *testing.T) {
+	h := servertest.New(t, &incrementalHandler{docs: document.NewStore()})
+	if err := h.Insert("file:///missing.go", lsp.Position{}, "x"); err == nil {
+		t.Fatal("expected error editing an unopened document")
+	}
+}
+
+// utf8Handler is a server that negotiates UTF-8 positions and applies
+// changes by byte offset, so it disagrees with a UTF-16 client on any line
+// with non-ASCII text.
+type utf8Handler struct {
+	mu      sync.Mutex
+	texts   map[lsp.DocumentURI]string
+	version int
+}
+
+func (h *utf8Handler) Initialize(_ context.Context, _ *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	enc := lsp.PositionEncodingUTF8
+	return &lsp.InitializeResult{
+		Capabilities: lsp.ServerCapabilities{
+			PositionEncoding: &enc,
+			TextDocumentSync: &lsp.TextDocumentSyncOptions{OpenClose: boolPtr(true), Change: lsp.SyncIncremental},
+		},
+	}, nil
+}
+
+func (h *utf8Handler) Shutdown(_ context.Context) error { return nil }
+
+func (h *utf8Handler) DidOpen(_ context.Context, params *lsp.DidOpenTextDocumentParams) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.texts[params.TextDocument.URI] = params.TextDocument.Text
+	h.version = params.TextDocument.Version
+	return nil
+}
+
+func (h *utf8Handler) DidChange(_ context.Context, params *lsp.DidChangeTextDocumentParams) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	text := h.texts[params.TextDocument.URI]
+	offset := func(p lsp.Position) int {
+		start := 0
+		for range p.Line {
+			start += strings.IndexByte(text[start:], '\n') + 1
+		}
+		return start + p.Character
+	}
+	for _, c := range params.ContentChanges {
+		start, end := offset(c.Range.Start), offset(c.Range.End)
+		text = text[:start] + c.Text + text[end:]
+	}
+	h.texts[params.TextDocument.URI] = text
+	h.version = params.TextDocument.Version
+	return nil
+}
+
+func (h *utf8Handler) DidClose(_ context.Context, params *lsp.DidCloseTextDocumentParams) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.texts, params.TextDocument.URI)
+	return nil
+}
+
+func (h *utf8Handler) Hover(_ context.Context, params *lsp.HoverParams) (*lsp.Hover, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return &lsp.Hover{Contents: lsp.MarkupContent{
+		Kind:  lsp.PlainText,
+		Value: fmt.Sprintf("%d:%s", h.version, h.texts[params.TextDocument.URI]),
+	}}, nil
+}
+
+func TestIncrementalEditingUTF8(t *testing.T) {
+	uri := lsp.DocumentURI("file:///edit.go")
+	h := servertest.New(t, &utf8Handler{texts: make(map[lsp.DocumentURI]string)})
+	if got := h.PositionEncoding(); got != lsp.PositionEncodingUTF8 {
+		t.Fatalf("PositionEncoding() = %q, want utf-8", got)
+	}
+
+	f := h.OpenFixture(uri, "go", "s := \"[[word:héllo]] 🌍|\"\n")
+	// "s := \"héllo 🌍" is 17 bytes.
+	if p := h.At(f, servertest.CursorMarker); p != (lsp.Position{Line: 0, Character: 17}) {
+		t.Fatalf("cursor = %+v, want 0:17", p)
+	}
+	if err := h.Type(uri, h.At(f, servertest.CursorMarker), "ü😀!"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Replace(uri, h.RangeOf(f, "word"), "wörld"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "s := \"wörld 🌍ü😀!\"\n"
+	if got, _ := h.Text(uri); got != want {
+		t.Fatalf("mirror text = %q, want %q", got, want)
+	}
+	_, text := serverText(t, h, uri)
+	h.AssertText(uri, text)
+}
+
+// recordingTB captures Errorf calls so assertion failures can be tested.
+type recordingTB struct {
+	*testing.T
+	errors []string
+}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertTextMismatch(t *testing.T) {
+	rec := &recordingTB{T: t}
+	uri := lsp.DocumentURI("file:///a.txt")
+	h := servertest.New(rec, &incrementalHandler{docs: document.NewStore()})
+	if err := h.DidOpen(uri, "plaintext", "one\ntwo\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	h.AssertText(uri, "one\ntwo\n")
+	if len(rec.errors) != 0 {
+		t.Fatalf("unexpected failure: %v", rec.errors)
+	}
+	h.AssertText(uri, "one\nTwo\n")
+	if len(rec.errors) != 1 {
+		t.Fatalf("errors = %v, want one mismatch", rec.errors)
+	}
+}
@@ -0,0 +1,135 @@
+package servertest
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/owenrumney/go-lsp/document"
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// PositionEncoding returns the position encoding the server chose in its
+// initialize result, or UTF-16 if it did not choose one. Positions passed to
+// and returned by the harness are measured in this encoding.
+func (h *Harness) PositionEncoding() lsp.PositionEncodingKind {
+	return h.encoding
+}
+
+// negotiatedEncoding returns the encoding advertised in caps, defaulting to
+// UTF-16 as the protocol does. Unknown encodings are treated as UTF-16.
+func negotiatedEncoding(caps lsp.ServerCapabilities) lsp.PositionEncodingKind {
+	if caps.PositionEncoding == nil {
+		return lsp.PositionEncodingUTF16
+	}
+	switch enc := *caps.PositionEncoding; enc {
+	case lsp.PositionEncodingUTF8, lsp.PositionEncodingUTF32:
+		return enc
+	default:
+		return lsp.PositionEncodingUTF16
+	}
+}
+
+// runeUnits returns the number of code units r takes in enc.
+func runeUnits(enc lsp.PositionEncodingKind, r rune) int {
+	switch enc {
+	case lsp.PositionEncodingUTF8:
+		return utf8.RuneLen(r)
+	case lsp.PositionEncodingUTF32:
+		return 1
+	default:
+		return utf16.RuneLen(r)
+	}
+}
+
+// unitName names the code units of enc in messages.
+func unitName(enc lsp.PositionEncodingKind) string {
+	switch enc {
+	case lsp.PositionEncodingUTF8:
+		return "UTF-8 code units"
+	case lsp.PositionEncodingUTF32:
+		return "code points"
+	default:
+		return "UTF-16 code units"
+	}
+}
+
+// offsetAt converts pos, measured in enc, to a byte offset in text.
+func offsetAt(text string, enc lsp.PositionEncodingKind, pos lsp.Position) (int, error) {
+	if pos.Line < 0 {
+		return 0, fmt.Errorf("%w: line %d out of bounds", document.ErrInvalidPosition, pos.Line)
+	}
+	start := 0
+	for range pos.Line {
+		i := strings.IndexByte(text[start:], '\n')
+		if i < 0 {
+			return 0, fmt.Errorf("%w: line %d out of bounds", document.ErrInvalidPosition, pos.Line)
+		}
+		start += i + 1
+	}
+	line := text[start:]
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	units := 0
+	for offset, r := range line {
+		if units == pos.Character {
+			return start + offset, nil
+		}
+		units += runeUnits(enc, r)
+		if units > pos.Character {
+			break
+		}
+	}
+	if units == pos.Character {
+		return start + len(line), nil
+	}
+	return 0, fmt.Errorf("%w: character %d out of bounds", document.ErrInvalidPosition, pos.Character)
+}
+
+// positionAt converts a byte offset in text, which must be at the start of a
+// character, to a position measured in enc.
+func positionAt(text string, enc lsp.PositionEncodingKind, offset int) lsp.Position {
+	before := text[:offset]
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	char := 0
+	for _, r := range before[lineStart:] {
+		char += runeUnits(enc, r)
+	}
+	return lsp.Position{Line: strings.Count(before, "\n"), Character: char}
+}
+
+// utf16Changes re-expresses the ranges of changes, measured in enc, in the
+// UTF-16 positions the document store uses. Each change is measured against
+// the result of the ones before it, starting from text.
+func utf16Changes(text string, enc lsp.PositionEncodingKind, changes []lsp.TextDocumentContentChangeEvent) ([]lsp.TextDocumentContentChangeEvent, error) {
+	out := make([]lsp.TextDocumentContentChangeEvent, len(changes))
+	for i, c := range changes {
+		if c.Range == nil {
+			text = c.Text
+			out[i] = c
+			continue
+		}
+		start, err := offsetAt(text, enc, c.Range.Start)
+		if err != nil {
+			return nil, fmt.Errorf("%w: start: %v", document.ErrInvalidRange, err)
+		}
+		end, err := offsetAt(text, enc, c.Range.End)
+		if err != nil {
+			return nil, fmt.Errorf("%w: end: %v", document.ErrInvalidRange, err)
+		}
+		if start > end {
+			return nil, fmt.Errorf("%w: start after end", document.ErrInvalidRange)
+		}
+		r := lsp.Range{
+			Start: positionAt(text, lsp.PositionEncodingUTF16, start),
+			End:   positionAt(text, lsp.PositionEncodingUTF16, end),
+		}
+		text = text[:start] + c.Text + text[end:]
+		c.Range = &r
+		out[i] = c
+	}
+	return out, nil
+}
@@ -0,0 +1,335 @@
+package servertest
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// CursorMarker is the name of the position marked with "|" in a fixture.
+const CursorMarker = "cursor"
+
+// ErrInvalidFixture is returned by ParseFixture for malformed markers.
+var ErrInvalidFixture = errors.New("invalid fixture")
+
+// Fixture is a document whose source was annotated with position and range
+// markers. The markers are removed from Text, and their locations are
+// available by name.
+//
+// Marker syntax:
+//
+//	foo|bar         the position named "cursor"; write "||" for a literal "||"
+//	<<name>>        a named position
+//	[[text]]        a range around text
+//	[[name:text]]   a named range around text
+//
+// A backslash before a marker writes it as text: \| is "|", \<< is "<<",
+// \[[ is "[[", and \]] is "]]". Other backslashes are left alone. Position
+// names must not be empty or start or end with whitespace, which catches an
+// unescaped operator such as "a << b >> c".
+//
+// Ranges may contain positions and other ranges. "]]" outside a range is
+// left as text. Positions from ParseFixture use UTF-16 character offsets,
+// the protocol default; OpenFixture uses the negotiated PositionEncoding.
+type Fixture struct {
+	// URI identifies the document.
+	URI lsp.DocumentURI
+	// Text is the document source with all markers removed.
+	Text string
+
+	positions map[string]lsp.Position
+	ranges    map[string]lsp.Range
+	all       []lsp.Range
+}
+
+var rangeNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*:`)
+
+// ParseFixture strips the markers from source and records where they were.
+func ParseFixture(uri lsp.DocumentURI, source string) (*Fixture, error) {
+	return parseFixture(uri, source, lsp.PositionEncodingUTF16)
+}
+
+func parseFixture(uri lsp.DocumentURI, source string, enc lsp.PositionEncodingKind) (*Fixture, error) {
+	type openRange struct {
+		name  string
+		start int
+	}
+	type span struct {
+		name       string
+		start, end int
+	}
+
+	var (
+		b      strings.Builder
+		points = make(map[string]int)
+		spans  []span
+		open   []openRange
+	)
+	addPoint := func(name string) error {
+		if _, dup := points[name]; dup {
+			return fmt.Errorf("%w: duplicate position %q", ErrInvalidFixture, name)
+		}
+		points[name] = b.Len()
+		return nil
+	}
+
+	for i := 0; i < len(source); {
+		rest := source[i:]
+		switch {
+		case rest[0] == '\\' && escapedMarker(rest[1:]) != "":
+			marker := escapedMarker(rest[1:])
+			b.WriteString(marker)
+			i += 1 + len(marker)
+		case strings.HasPrefix(rest, "||"):
+			b.WriteString("||")
+			i += 2
+		case rest[0] == '|':
+			if err := addPoint(CursorMarker); err != nil {
+				return nil, err
+			}
+			i++
+		case strings.HasPrefix(rest, "<<"):
+			end := strings.Index(rest, ">>")
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unclosed <<", ErrInvalidFixture)
+			}
+			name := rest[2:end]
+			if name == "" || strings.TrimSpace(name) != name || strings.Contains(name, "\n") {
+				return nil, fmt.Errorf("%w: position name %q; write \\<< for a literal <<", ErrInvalidFixture, name)
+			}
+			if err := addPoint(name); err != nil {
+				return nil, err
+			}
+			i += end + 2
+		case strings.HasPrefix(rest, "[["):
+			i += 2
+			name := rangeNameRe.FindString(source[i:])
+			i += len(name)
+			open = append(open, openRange{name: strings.TrimSuffix(name, ":"), start: b.Len()})
+		case strings.HasPrefix(rest, "]]") && len(open) > 0:
+			r := open[len(open)-1]
+			open = open[:len(open)-1]
+			spans = append(spans, span{name: r.name, start: r.start, end: b.Len()})
+			i += 2
+		default:
+			b.WriteByte(rest[0])
+			i++
+		}
+	}
+	if len(open) > 0 {
+		return nil, fmt.Errorf("%w: unclosed [[", ErrInvalidFixture)
+	}
+
+	f := &Fixture{
+		URI:       uri,
+		Text:      b.String(),
+		positions: make(map[string]lsp.Position),
+		ranges:    make(map[string]lsp.Range),
+	}
+	for name, offset := range points {
+		f.positions[name] = positionAt(f.Text, enc, offset)
+	}
+	// Report ranges in source order of their opening markers.
+	slices.SortFunc(spans, func(a, b span) int {
+		if a.start != b.start {
+			return a.start - b.start
+		}
+		return b.end - a.end
+	})
+	for _, s := range spans {
+		r := lsp.Range{Start: positionAt(f.Text, enc, s.start), End: positionAt(f.Text, enc, s.end)}
+		f.all = append(f.all, r)
+		if s.name == "" {
+			continue
+		}
+		if _, dup := f.ranges[s.name]; dup {
+			return nil, fmt.Errorf("%w: duplicate range %q", ErrInvalidFixture, s.name)
+		}
+		f.ranges[s.name] = r
+	}
+	return f, nil
+}
+
+// escapedMarker returns the marker at the start of s, or "" if there is none.
+func escapedMarker(s string) string {
+	for _, m := range []string{"|", "<<", "[[", "]]"} {
+		if strings.HasPrefix(s, m) {
+			return m
+		}
+	}
+	return ""
+}
+
+// Position returns the named position.
+func (f *Fixture) Position(name string) (lsp.Position, bool) {
+	p, ok := f.positions[name]
+	return p, ok
+}
+
+// Range returns the named range.
+func (f *Fixture) Range(name string) (lsp.Range, bool) {
+	r, ok := f.ranges[name]
+	return r, ok
+}
+
+// Ranges returns every marked range, named or not, in source order.
+func (f *Fixture) Ranges() []lsp.Range {
+	return slices.Clone(f.all)
+}
+
+// OpenFixture parses source like ParseFixture and opens the resulting document
+// with DidOpen. Positions are measured in the negotiated PositionEncoding. The
+// test fails if the fixture is malformed.
+func (h *Harness) OpenFixture(uri lsp.DocumentURI, languageID, source string) *Fixture {
+	h.t.Helper()
+	f, err := parseFixture(uri, source, h.encoding)
+	if err != nil {
+		h.t.Fatalf("fixture %s: %v", uri, err)
+	}
+	if err := h.DidOpen(uri, languageID, f.Text); err != nil {
+		h.t.Fatalf("open fixture %s: %v", uri, err)
+	}
+	return f
+}
+
+// At returns the named position in f, failing the test if it is not marked.
+func (h *Harness) At(f *Fixture, name string) lsp.Position {
+	h.t.Helper()
+	p, ok := f.Position(name)
+	if !ok {
+		h.t.Fatalf("fixture %s has no position %q", f.URI, name)
+	}
+	return p
+}
+
+// RangeOf returns the named range in f, failing the test if it is not marked.
+func (h *Harness) RangeOf(f *Fixture, name string) lsp.Range {
+	h.t.Helper()
+	r, ok := f.Range(name)
+	if !ok {
+		h.t.Fatalf("fixture %s has no range %q", f.URI, name)
+	}
+	return r
+}
+
+// HoverAt sends a textDocument/hover request at the named position.
+func (h *Harness) HoverAt(f *Fixture, name string) (*lsp.Hover, error) {
+	h.t.Helper()
+	p := h.At(f, name)
+	return h.Hover(f.URI, p.Line, p.Character)
+}
+
+// CompletionAt sends a textDocument/completion request at the named position.
+func (h *Harness) CompletionAt(f *Fixture, name string) (*lsp.CompletionList, error) {
+	h.t.Helper()
+	p := h.At(f, name)
+	return h.Completion(f.URI, p.Line, p.Character)
+}
+
+// SignatureHelpAt sends a textDocument/signatureHelp request at the named position.
+func (h *Harness) SignatureHelpAt(f *Fixture, name string) (*lsp.SignatureHelp, error) {
+	h.t.Helper()
+	p := h.At(f, name)
+	return h.SignatureHelp(f.URI, p.Line, p.Character)
+}
+
+// DefinitionAt sends a textDocument/definition request at the named position.
+func (h *Harness) DefinitionAt(f *Fixture, name string) ([]lsp.Location, error) {
+	h.t.Helper()
+	p := h.At(f, name)
+	return h.Definition(f.URI, p.Line, p.Character)
+}
+
+// TypeDefinitionAt sends a textDocument/typeDefinition request at the named position.
+func (h *Harness) TypeDefinitionAt(f *Fixture, name string) ([]lsp.Location, error) {
+	h.t.Helper()
+	p := h.At(f, name)
+	return h.TypeDefinition(f.URI, p.Line, p.Character)
+}
+
+// ImplementationAt sends a textDocument/implementation request at the named position.
+func (h *Harness) ImplementationAt(f *Fixture, name string) ([]lsp.Location, error) {
+	h.t.Helper()
+	p := h.At(f, name)
+	return h.Implementation(f.URI, p.Line, p.Character)
+}
+
+// ReferencesAt sends a textDocument/references request at the named position.
+func (h *Harness) ReferencesAt(f *Fixture, name string, includeDecl bool) ([]lsp.Location, error) {
+	h.t.Helper()
+	p := h.At(f, name)
+	return h.References(f.URI, p.Line, p.Character, includeDecl)
+}
+
+// DocumentHighlightAt sends a textDocument/documentHighlight request at the named position.
+func (h *Harness) DocumentHighlightAt(f *Fixture, name string) ([]lsp.DocumentHighlight, error) {
+	h.t.Helper()
+	p := h.At(f, name)
+	return h.DocumentHighlight(f.URI, p.Line, p.Character)
+}
+
+// RenameAt sends a textDocument/rename request at the named position.
+func (h *Harness) RenameAt(f *Fixture, name, newName string) (*lsp.WorkspaceEdit, error) {
+	h.t.Helper()
+	p := h.At(f, name)
+	return h.Rename(f.URI, p.Line, p.Character, newName)
+}
+
+// AssertLocations fails the test unless got contains exactly the named ranges
+// of f, in any order. With no names, every range marked in f is expected.
+func (h *Harness) AssertLocations(f *Fixture, got []lsp.Location, names ...string) {
+	h.t.Helper()
+	ranges := make([]lsp.Range, 0, len(got))
+	for _, loc := range got {
+		if loc.URI != f.URI {
+			h.t.Errorf("unexpected location in %s at %s", loc.URI, formatRange(loc.Range))
+			continue
+		}
+		ranges = append(ranges, loc.Range)
+	}
+	h.assertRanges(f, "location", ranges, names)
+}
+
+// AssertDiagnostics fails the test unless the diagnostics cover exactly the
+// named ranges of f, in any order. With no names, every range marked in f is
+// expected.
+func (h *Harness) AssertDiagnostics(f *Fixture, got []lsp.Diagnostic, names ...string) {
+	h.t.Helper()
+	ranges := make([]lsp.Range, len(got))
+	for i, d := range got {
+		ranges[i] = d.Range
+	}
+	h.assertRanges(f, "diagnostic", ranges, names)
+}
+
+func (h *Harness) assertRanges(f *Fixture, kind string, got []lsp.Range, names []string) {
+	h.t.Helper()
+	want := f.Ranges()
+	if len(names) > 0 {
+		want = make([]lsp.Range, len(names))
+		for i, name := range names {
+			want[i] = h.RangeOf(f, name)
+		}
+	}
+
+	remaining := slices.Clone(got)
+	for _, w := range want {
+		if i := slices.Index(remaining, w); i >= 0 {
+			remaining = slices.Delete(remaining, i, i+1)
+			continue
+		}
+		h.t.Errorf("missing %s at %s in %s", kind, formatRange(w), f.URI)
+	}
+	for _, r := range remaining {
+		h.t.Errorf("unexpected %s at %s in %s", kind, formatRange(r), f.URI)
+	}
+}
+
+// formatRange renders r as "line:char-line:char" using zero-based positions.
+func formatRange(r lsp.Range) string {
+	return fmt.Sprintf("%d:%d-%d:%d", r.Start.Line, r.Start.Character, r.End.Line, r.End.Character)
+}
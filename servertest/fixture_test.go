@@ -0,0 +1,179 @@
+package servertest_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/owenrumney/go-lsp/document"
+	"github.com/owenrumney/go-lsp/lsp"
+	"github.com/owenrumney/go-lsp/servertest"
+)
+
+func TestParseFixture(t *testing.T) {
+	f, err := servertest.ParseFixture("file:///f.go", "a || b\nx := [[decl:fo|o]]\n<<end>>[[🌍 [[inner]]]]")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "a || b\nx := foo\n🌍 inner"; f.Text != want {
+		t.Fatalf("Text = %q, want %q", f.Text, want)
+	}
+	if p, _ := f.Position(servertest.CursorMarker); p != (lsp.Position{Line: 1, Character: 7}) {
+		t.Fatalf("cursor = %+v", p)
+	}
+	if p, _ := f.Position("end"); p != (lsp.Position{Line: 2, Character: 0}) {
+		t.Fatalf("end = %+v", p)
+	}
+	decl := lsp.Range{Start: lsp.Position{Line: 1, Character: 5}, End: lsp.Position{Line: 1, Character: 8}}
+	if r, ok := f.Range("decl"); !ok || r != decl {
+		t.Fatalf("decl = %+v", r)
+	}
+
+	// The emoji is two UTF-16 code units.
+	want := []lsp.Range{
+		decl,
+		{Start: lsp.Position{Line: 2, Character: 0}, End: lsp.Position{Line: 2, Character: 8}},
+		{Start: lsp.Position{Line: 2, Character: 3}, End: lsp.Position{Line: 2, Character: 8}},
+	}
+	got := f.Ranges()
+	if len(got) != len(want) {
+		t.Fatalf("Ranges() = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Ranges()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseFixtureErrors(t *testing.T) {
+	for _, source := range []string{"a|b|c", "[[open", "<<open", "<<a>> <<a>>", "[[r:a]] [[r:b]]", "<<>>", "a << b >> c", "<< a>>"} {
+		if _, err := servertest.ParseFixture("file:///f.go", source); !errors.Is(err, servertest.ErrInvalidFixture) {
+			t.Errorf("ParseFixture(%q) error = %v, want ErrInvalidFixture", source, err)
+		}
+	}
+	f, err := servertest.ParseFixture("file:///f.go", "m[k[i]]")
+	if err != nil || f.Text != "m[k[i]]" {
+		t.Fatalf("stray ]] = %q, %v", f.Text, err)
+	}
+}
+
+func TestParseFixtureEscapes(t *testing.T) {
+	f, err := servertest.ParseFixture("file:///f.go", `a \<< b >> c; x \| y; \[[k\]] [[r:\]]]]; "\n"|`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `a << b >> c; x | y; [[k]] ]]; "\n"`; f.Text != want {
+		t.Fatalf("Text = %q, want %q", f.Text, want)
+	}
+	if r, ok := f.Range("r"); !ok || r.End.Character-r.Start.Character != 2 {
+		t.Fatalf("r = %+v", r)
+	}
+	if p, _ := f.Position(servertest.CursorMarker); p.Character != len(f.Text) {
+		t.Fatalf("cursor = %+v", p)
+	}
+}
+
+// wordHandler answers hover with the word under the cursor and references
+// with every occurrence of that word.
+type wordHandler struct {
+	docs *document.Store
+}
+
+func (h *wordHandler) Initialize(_ context.Context, _ *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	return &lsp.InitializeResult{}, nil
+}
+
+func (h *wordHandler) Shutdown(_ context.Context) error { return nil }
+
+func (h *wordHandler) DidOpen(_ context.Context, params *lsp.DidOpenTextDocumentParams) error {
+	_, err := h.docs.Open(params)
+	return err
+}
+
+func (h *wordHandler) DidChange(_ context.Context, params *lsp.DidChangeTextDocumentParams) error {
+	_, err := h.docs.Change(params)
+	return err
+}
+
+func (h *wordHandler) DidClose(_ context.Context, params *lsp.DidCloseTextDocumentParams) error {
+	h.docs.Close(params)
+	return nil
+}
+
+func (h *wordHandler) word(uri lsp.DocumentURI, pos lsp.Position) string {
+	doc, ok := h.docs.Get(uri)
+	if !ok {
+		return ""
+	}
+	line, _ := doc.Line(pos.Line)
+	isWord := func(c byte) bool { return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+	start, end := pos.Character, pos.Character
+	for start > 0 && isWord(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isWord(line[end]) {
+		end++
+	}
+	return line[start:end]
+}
+
+func (h *wordHandler) Hover(_ context.Context, params *lsp.HoverParams) (*lsp.Hover, error) {
+	word := h.word(params.TextDocument.URI, params.Position)
+	return &lsp.Hover{Contents: lsp.MarkupContent{Kind: lsp.PlainText, Value: word}}, nil
+}
+
+func (h *wordHandler) References(_ context.Context, params *lsp.ReferenceParams) ([]lsp.Location, error) {
+	uri := params.TextDocument.URI
+	word := h.word(uri, params.Position)
+	doc, _ := h.docs.Get(uri)
+	var locs []lsp.Location
+	for i, line := range doc.Lines() {
+		for col := 0; ; {
+			j := strings.Index(line[col:], word)
+			if j < 0 {
+				break
+			}
+			col += j
+			locs = append(locs, lsp.Location{URI: uri, Range: lsp.Range{
+				Start: lsp.Position{Line: i, Character: col},
+				End:   lsp.Position{Line: i, Character: col + len(word)},
+			}})
+			col += len(word)
+		}
+	}
+	return locs, nil
+}
+
+func TestFixtureHelpers(t *testing.T) {
+	rec := &recordingTB{T: t}
+	h := servertest.New(rec, &wordHandler{docs: document.NewStore()})
+	f := h.OpenFixture("file:///main.go", "go", "[[def:count]] := 0\n[[count]]++\nprint([[co|unt]])\nprint(<<other>>total)")
+
+	hover, err := h.HoverAt(f, servertest.CursorMarker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hover.Contents.Value != "count" {
+		t.Fatalf("hover = %q", hover.Contents.Value)
+	}
+	if hover, _ := h.HoverAt(f, "other"); hover.Contents.Value != "total" {
+		t.Fatalf("hover at other = %q", hover.Contents.Value)
+	}
+
+	refs, err := h.ReferencesAt(f, servertest.CursorMarker, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.AssertLocations(f, refs)
+	if len(rec.errors) != 0 {
+		t.Fatalf("unexpected failures: %q", rec.errors)
+	}
+
+	h.AssertLocations(f, refs, "def")
+	if len(rec.errors) != 2 {
+		t.Fatalf("errors = %q, want two unexpected locations", rec.errors)
+	}
+}
@@ -0,0 +1,583 @@
+package servertest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
+	"github.com/owenrumney/go-lsp/lsp"
+	"github.com/owenrumney/go-lsp/server"
+)
+
+// FuzzOptions configures Fuzz.
+type FuzzOptions struct {
+	// Seeds are the documents the fuzzer starts from. Each is added to the
+	// seed corpus with a script that sends every supported request once.
+	Seeds []string
+
+	// URI and LanguageID identify the fuzzed document. They default to
+	// "file:///fuzz.txt" and "plaintext".
+	URI        lsp.DocumentURI
+	LanguageID string
+
+	// Timeout is how long each request may take before it is reported as a
+	// hang. It defaults to 5 seconds.
+	Timeout time.Duration
+
+	// MaxSteps bounds the number of edits and requests in one input. It
+	// defaults to 64.
+	MaxSteps int
+
+	// Options are applied to every harness.
+	Options []Option
+}
+
+// Fuzz runs a fuzz test against the server returned by newHandler. Each fuzz
+// input is a document and a script of edits and requests: hover, completion,
+// definition and references at random positions, document symbols, and
+// formatting. Requests are only sent for capabilities the server advertises,
+// and edits are sent incrementally.
+//
+// An input fails when a request or notification panics in the handler, takes
+// longer than Timeout, or returns a result with an invalid range or the wrong
+// shape (see WithConformanceChecks). The failing sequence is then shrunk by
+// removing steps that are not needed to reproduce it, and the remaining steps
+// are reported.
+//
+// A new handler, and a new harness, is used for every input. Panics in
+// notification handlers are found with a server.Tracer, which replaces any
+// tracer set in Options.
+//
+//	func FuzzServer(f *testing.F) {
+//		servertest.Fuzz(f, func() server.LifecycleHandler { return newHandler() }, servertest.FuzzOptions{
+//			Seeds:      []string{"let x = 1\nprint(x)\n"},
+//			LanguageID: "toy",
+//		})
+//	}
+func Fuzz(f *testing.F, newHandler func() server.LifecycleHandler, opts FuzzOptions) {
+	f.Helper()
+	opts = opts.withDefaults()
+
+	for _, seed := range opts.Seeds {
+		f.Add(seed, seedScript())
+	}
+
+	f.Fuzz(func(t *testing.T, text string, script []byte) {
+		text = strings.ToValidUTF8(text, "�")
+		fz := &fuzzer{t: t, newHandler: newHandler, opts: opts}
+		steps := decodeSteps(script, opts.MaxSteps)
+
+		failure, _ := fz.run(text, steps)
+		if failure == nil {
+			return
+		}
+		steps, failure = fz.shrink(text, steps, failure)
+		_, trace := fz.run(text, steps)
+		t.Fatal(formatFuzzFailure(text, trace, failure))
+	})
+}
+
+func (o FuzzOptions) withDefaults() FuzzOptions {
+	if o.URI == "" {
+		o.URI = "file:///fuzz.txt"
+	}
+	if o.LanguageID == "" {
+		o.LanguageID = "plaintext"
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 5 * time.Second
+	}
+	if o.MaxSteps <= 0 {
+		o.MaxSteps = 64
+	}
+	return o
+}
+
+const (
+	stepEdit = iota
+	stepHover
+	stepCompletion
+	stepDefinition
+	stepReferences
+	stepDocumentSymbol
+	stepFormatting
+	stepKinds
+)
+
+// fuzzStep is one decoded step of a fuzz script. Offsets are resolved
+// against the document when the step runs, so a step stays meaningful when
+// the steps before it are removed while shrinking.
+type fuzzStep struct {
+	kind   byte
+	offset uint16
+	length byte
+	insert byte
+}
+
+// fuzzInserts are the strings edits insert, chosen to exercise line endings
+// and multi-byte and surrogate-pair characters.
+var fuzzInserts = []string{"", "x", " ", "\n", "\r\n", "\t", "é", "😀", "()", "{\n}", "\"", "name"}
+
+func decodeSteps(script []byte, maxSteps int) []fuzzStep {
+	var steps []fuzzStep
+	next := func() byte {
+		if len(script) == 0 {
+			return 0
+		}
+		b := script[0]
+		script = script[1:]
+		return b
+	}
+	for len(script) > 0 && len(steps) < maxSteps {
+		s := fuzzStep{kind: next() % stepKinds}
+		if s.kind != stepDocumentSymbol && s.kind != stepFormatting {
+			s.offset = binary.BigEndian.Uint16([]byte{next(), next()})
+		}
+		if s.kind == stepEdit {
+			s.length = next()
+			s.insert = next()
+		}
+		steps = append(steps, s)
+	}
+	return steps
+}
+
+// seedScript sends every request at the start of the document, inserts a
+// character, and sends every request again.
+func seedScript() []byte {
+	var script []byte
+	requests := func() {
+		for kind := byte(stepHover); kind < stepKinds; kind++ {
+			script = append(script, kind)
+			if kind != stepDocumentSymbol && kind != stepFormatting {
+				script = append(script, 0, 1)
+			}
+		}
+	}
+	requests()
+	script = append(script, stepEdit, 0, 1, 0, 1)
+	requests()
+	return script
+}
+
+type fuzzFailure struct {
+	// step is the index of the failing step, or -1 if the harness could
+	// not be set up.
+	step    int
+	kind    string
+	method  string
+	message string
+}
+
+// same reports whether g is the same kind of failure as f, for shrinking.
+func (f *fuzzFailure) same(g *fuzzFailure) bool {
+	return g != nil && f.kind == g.kind && f.method == g.method
+}
+
+type fuzzer struct {
+	t          *testing.T
+	newHandler func() server.LifecycleHandler
+	opts       FuzzOptions
+}
+
+// run plays steps against a fresh server and returns the first failure, if
+// any, with a description of each step that ran.
+func (fz *fuzzer) run(text string, steps []fuzzStep) (*fuzzFailure, []string) {
+	tb := newQuietTB(fz.t)
+	panics := &notificationPanics{}
+	var (
+		failure *fuzzFailure
+		trace   []string
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		opts := append(append([]Option{}, fz.opts.Options...),
+			WithConformanceChecks(), WithServerOptions(server.WithTracer(panics)))
+		h := New(tb, fz.newHandler(), opts...)
+		if err := h.DidOpen(fz.opts.URI, fz.opts.LanguageID, text); err != nil {
+			failure = &fuzzFailure{step: -1, kind: "error", message: err.Error()}
+			return
+		}
+		if f := fz.notified(h, panics, "textDocument/didOpen"); f != nil {
+			f.step = -1
+			failure = f
+			return
+		}
+		for i, s := range steps {
+			desc, f := fz.step(h, panics, s)
+			trace = append(trace, desc)
+			if f != nil {
+				f.step = i
+				failure = f
+				return
+			}
+		}
+	}()
+	<-done
+	if failure == nil && tb.Failed() {
+		failure = &fuzzFailure{step: -1, kind: "error", message: tb.message()}
+	}
+	tb.runCleanups(fz.opts.Timeout)
+	return failure, trace
+}
+
+// step runs s and describes it.
+func (fz *fuzzer) step(h *Harness, panics *notificationPanics, s fuzzStep) (string, *fuzzFailure) {
+	uri := fz.opts.URI
+	doc, ok := h.docs.Get(uri)
+	if !ok {
+		return "", &fuzzFailure{kind: "error", message: fmt.Sprintf("document %s is not open", uri)}
+	}
+	text := doc.Text()
+	pos := func(offset int) lsp.Position {
+		offset %= len(text) + 1
+		for offset < len(text) && !utf8.RuneStart(text[offset]) {
+			offset--
+		}
+		return positionAt(text, h.encoding, offset)
+	}
+	at := func(p lsp.Position) lsp.TextDocumentPositionParams {
+		return textDocumentPosition(uri, p.Line, p.Character)
+	}
+	caps := h.InitResult.Capabilities
+
+	switch s.kind {
+	case stepEdit:
+		start := pos(int(s.offset))
+		end := pos(int(s.offset) + int(s.length%16))
+		if end.Line < start.Line || end.Line == start.Line && end.Character < start.Character {
+			end = start
+		}
+		insert := fuzzInserts[int(s.insert)%len(fuzzInserts)]
+		r := lsp.Range{Start: start, End: end}
+		desc := fmt.Sprintf("replace %s with %q", formatRange(r), insert)
+		if err := h.Replace(uri, r, insert); err != nil {
+			return desc, &fuzzFailure{kind: "error", method: "textDocument/didChange", message: err.Error()}
+		}
+		return desc, fz.notified(h, panics, "textDocument/didChange")
+	case stepHover:
+		p := pos(int(s.offset))
+		return fz.request(h, caps.HoverProvider != nil, "textDocument/hover", p, &lsp.HoverParams{TextDocumentPositionParams: at(p)})
+	case stepCompletion:
+		p := pos(int(s.offset))
+		return fz.request(h, caps.CompletionProvider != nil, "textDocument/completion", p, &lsp.CompletionParams{TextDocumentPositionParams: at(p)})
+	case stepDefinition:
+		p := pos(int(s.offset))
+		return fz.request(h, caps.DefinitionProvider != nil, "textDocument/definition", p, &lsp.DefinitionParams{TextDocumentPositionParams: at(p)})
+	case stepReferences:
+		p := pos(int(s.offset))
+		return fz.request(h, caps.ReferencesProvider != nil, "textDocument/references", p, &lsp.ReferenceParams{
+			TextDocumentPositionParams: at(p),
+			Context:                    lsp.ReferenceContext{IncludeDeclaration: true},
+		})
+	case stepDocumentSymbol:
+		return fz.request(h, caps.DocumentSymbolProvider != nil, "textDocument/documentSymbol", nil, &lsp.DocumentSymbolParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		})
+	default:
+		return fz.request(h, caps.DocumentFormattingProvider != nil, "textDocument/formatting", nil, &lsp.DocumentFormattingParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+			Options:      defaultFormattingOptions(),
+		})
+	}
+}
+
+// request sends method if the server supports it and checks the response.
+func (fz *fuzzer) request(h *Harness, supported bool, method string, pos any, params any) (string, *fuzzFailure) {
+	desc := method
+	if p, ok := pos.(lsp.Position); ok {
+		desc = fmt.Sprintf("%s at %d:%d", method, p.Line, p.Character)
+	}
+	if !supported {
+		return desc + " (skipped, not advertised)", nil
+	}
+
+	call, err := h.conn.startCall(method, params)
+	if err != nil {
+		return desc, &fuzzFailure{kind: "error", method: method, message: err.Error()}
+	}
+	ctx, cancel := context.WithTimeout(h.ctx, fz.opts.Timeout)
+	defer cancel()
+	_, err = call.Wait(ctx)
+
+	var rpcErr *rpcError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return desc, &fuzzFailure{kind: "hang", method: method, message: fmt.Sprintf("no response within %v", fz.opts.Timeout)}
+	case errors.As(err, &rpcErr) && rpcErr.Code == jsonrpc.CodeInternalError && strings.HasPrefix(rpcErr.Message, "panic in handler"):
+		return desc, &fuzzFailure{kind: "panic", method: method, message: rpcErr.Message}
+	case err != nil && rpcErr == nil:
+		return desc, &fuzzFailure{kind: "error", method: method, message: err.Error()}
+	}
+
+	// Diagnostics and other notifications can race with edits, so only
+	// violations in this response count.
+	var problems []string
+	for _, v := range h.conformance.take() {
+		if v.Method == method {
+			problems = append(problems, v.Message)
+		}
+	}
+	if len(problems) > 0 {
+		// A symbol's range and selection range often share a problem.
+		problems = slices.Compact(problems)
+		return desc, &fuzzFailure{kind: "invalid result", method: method, message: strings.Join(problems, "\n")}
+	}
+	return desc, nil
+}
+
+// syncMethod is a request no server handles. The server reads messages in
+// order and handles each notification before reading the next message, so
+// its response means every notification sent before it has been handled.
+const syncMethod = "$/servertest/sync"
+
+// notified waits until the server has handled the notification just sent
+// for method, and returns a failure if its handler panicked or hung.
+func (fz *fuzzer) notified(h *Harness, panics *notificationPanics, method string) *fuzzFailure {
+	call, err := h.conn.startCall(syncMethod, nil)
+	if err != nil {
+		return &fuzzFailure{kind: "error", method: method, message: err.Error()}
+	}
+	ctx, cancel := context.WithTimeout(h.ctx, fz.opts.Timeout)
+	defer cancel()
+	if _, err := call.Wait(ctx); errors.Is(err, context.DeadlineExceeded) {
+		return &fuzzFailure{kind: "hang", method: method, message: fmt.Sprintf("not handled within %v", fz.opts.Timeout)}
+	}
+	if msg := panics.take(); msg != "" {
+		return &fuzzFailure{kind: "panic", method: method, message: msg}
+	}
+	return nil
+}
+
+// notificationPanics is a server.Tracer that records panics in notification
+// handlers. The server recovers from them and only logs them, so they would
+// otherwise go unnoticed.
+type notificationPanics struct {
+	mu     sync.Mutex
+	panics []string
+}
+
+func (p *notificationPanics) Start(ctx context.Context, _ string, _ ...server.Attribute) (context.Context, server.Span) {
+	return ctx, panicSpan{p}
+}
+
+func (p *notificationPanics) take() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	msg := strings.Join(p.panics, "\n")
+	p.panics = nil
+	return msg
+}
+
+type panicSpan struct {
+	p *notificationPanics
+}
+
+func (panicSpan) SetAttributes(...server.Attribute) {}
+func (panicSpan) End()                              {}
+
+func (s panicSpan) SetError(err error) {
+	if msg := err.Error(); strings.HasPrefix(msg, "panic in notification handler") {
+		s.p.mu.Lock()
+		s.p.panics = append(s.p.panics, msg)
+		s.p.mu.Unlock()
+	}
+}
+
+// shrink removes steps from a failing sequence while it still fails the
+// same way, first in large chunks and then one at a time.
+func (fz *fuzzer) shrink(text string, steps []fuzzStep, failure *fuzzFailure) ([]fuzzStep, *fuzzFailure) {
+	// Steps after the failing one never ran.
+	steps = steps[:failure.step+1]
+	for chunk := len(steps) / 2; chunk >= 1; chunk /= 2 {
+		for i := 0; i+chunk <= len(steps); {
+			candidate := append(append([]fuzzStep{}, steps[:i]...), steps[i+chunk:]...)
+			if f, _ := fz.run(text, candidate); failure.same(f) {
+				steps, failure = candidate[:f.step+1], f
+				continue
+			}
+			i += chunk
+		}
+	}
+	return steps, failure
+}
+
+func formatFuzzFailure(text string, trace []string, failure *fuzzFailure) string {
+	var b strings.Builder
+	if failure.method != "" {
+		fmt.Fprintf(&b, "%s %s: %s\n", failure.method, failure.kind, failure.message)
+	} else {
+		fmt.Fprintf(&b, "%s: %s\n", failure.kind, failure.message)
+	}
+	fmt.Fprintf(&b, "document: %q\n", text)
+	if len(trace) > 0 {
+		fmt.Fprintf(&b, "steps:\n")
+		for i, desc := range trace {
+			fmt.Fprintf(&b, "  %d. %s\n", i+1, desc)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// quietTB lets the fuzzer run a harness without reporting to the test, so a
+// sequence can be replayed many times while shrinking. Its failures are
+// collected, and FailNow ends the calling goroutine as testing.T does.
+//
+// Every method that would act on the test itself is implemented here, so a
+// harness cannot skip the fuzz test or leave state behind in it. TempDir,
+// Context and Cleanup are scoped to the one run; Skip, Setenv, Chdir and
+// ArtifactDir fail the run instead, as the fuzzer cannot undo them.
+type quietTB struct {
+	testing.TB
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	failed   bool
+	messages []string
+	cleanups []func()
+}
+
+func newQuietTB(tb testing.TB) *quietTB {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &quietTB{TB: tb, ctx: ctx, cancel: cancel}
+}
+
+func (q *quietTB) Helper() {}
+
+func (q *quietTB) Log(args ...any)                 {}
+func (q *quietTB) Logf(format string, args ...any) {}
+
+func (q *quietTB) Error(args ...any) {
+	q.record(fmt.Sprint(args...))
+}
+
+func (q *quietTB) Errorf(format string, args ...any) {
+	q.record(fmt.Sprintf(format, args...))
+}
+
+func (q *quietTB) Fatal(args ...any) {
+	q.record(fmt.Sprint(args...))
+	runtime.Goexit()
+}
+
+func (q *quietTB) Fatalf(format string, args ...any) {
+	q.record(fmt.Sprintf(format, args...))
+	runtime.Goexit()
+}
+
+func (q *quietTB) Fail() {
+	q.record("")
+}
+
+func (q *quietTB) FailNow() {
+	q.record("")
+	runtime.Goexit()
+}
+
+func (q *quietTB) Failed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.failed
+}
+
+func (q *quietTB) Skip(args ...any) {
+	q.Fatal(append([]any{"servertest: harness skipped the fuzz run: "}, args...)...)
+}
+
+func (q *quietTB) Skipf(format string, args ...any) {
+	q.Fatalf("servertest: harness skipped the fuzz run: "+format, args...)
+}
+
+func (q *quietTB) SkipNow() {
+	q.Fatal("servertest: harness skipped the fuzz run")
+}
+
+func (q *quietTB) Skipped() bool { return false }
+
+func (q *quietTB) Setenv(key, _ string) {
+	q.Fatalf("servertest: Setenv(%q) is not supported while fuzzing", key)
+}
+
+func (q *quietTB) Chdir(dir string) {
+	q.Fatalf("servertest: Chdir(%q) is not supported while fuzzing", dir)
+}
+
+func (q *quietTB) ArtifactDir() string {
+	q.Fatal("servertest: ArtifactDir is not supported while fuzzing")
+	return ""
+}
+
+func (q *quietTB) Attr(_, _ string) {}
+
+func (q *quietTB) Output() io.Writer { return io.Discard }
+
+// Context is cancelled when the run ends, before the cleanups run.
+func (q *quietTB) Context() context.Context { return q.ctx }
+
+// TempDir returns a new directory that is removed when the run ends.
+func (q *quietTB) TempDir() string {
+	dir, err := os.MkdirTemp("", "servertest-fuzz")
+	if err != nil {
+		q.Fatalf("servertest: TempDir: %v", err)
+	}
+	q.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func (q *quietTB) Cleanup(f func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.cleanups = append(q.cleanups, f)
+}
+
+func (q *quietTB) record(msg string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.failed = true
+	if msg != "" {
+		q.messages = append(q.messages, msg)
+	}
+}
+
+func (q *quietTB) message() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return strings.Join(q.messages, "\n")
+}
+
+// runCleanups runs the registered cleanups in reverse order. A server that
+// hung may never answer shutdown, so it gives up after timeout and leaves
+// the cleanups running.
+func (q *quietTB) runCleanups(timeout time.Duration) {
+	q.cancel()
+	q.mu.Lock()
+	cleanups := q.cleanups
+	q.cleanups = nil
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
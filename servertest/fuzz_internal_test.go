@@ -0,0 +1,218 @@
+package servertest
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/owenrumney/go-lsp/document"
+	"github.com/owenrumney/go-lsp/lsp"
+	"github.com/owenrumney/go-lsp/server"
+)
+
+// buggyHandler panics hovering over lines with an emoji, and handling a
+// change that leaves two quotes together. It hangs completing in documents
+// with a brace, and measures symbol ranges in bytes.
+type buggyHandler struct {
+	docs *document.Store
+}
+
+func newBuggyHandler() server.LifecycleHandler {
+	return &buggyHandler{docs: document.NewStore()}
+}
+
+func (h *buggyHandler) Initialize(_ context.Context, _ *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	return &lsp.InitializeResult{}, nil
+}
+
+func (h *buggyHandler) Shutdown(_ context.Context) error { return nil }
+
+func (h *buggyHandler) DidOpen(_ context.Context, params *lsp.DidOpenTextDocumentParams) error {
+	_, err := h.docs.Open(params)
+	return err
+}
+
+func (h *buggyHandler) DidChange(_ context.Context, params *lsp.DidChangeTextDocumentParams) error {
+	doc, err := h.docs.Change(params)
+	if err == nil && strings.Contains(doc.Text(), `""`) {
+		panic("empty string")
+	}
+	return err
+}
+
+func (h *buggyHandler) DidClose(_ context.Context, params *lsp.DidCloseTextDocumentParams) error {
+	h.docs.Close(params)
+	return nil
+}
+
+func (h *buggyHandler) Hover(_ context.Context, params *lsp.HoverParams) (*lsp.Hover, error) {
+	doc, _ := h.docs.Get(params.TextDocument.URI)
+	line, _ := doc.Line(params.Position.Line)
+	if strings.Contains(line, "😀") {
+		panic("emoji")
+	}
+	return &lsp.Hover{Contents: lsp.MarkupContent{Kind: lsp.PlainText, Value: line}}, nil
+}
+
+func (h *buggyHandler) Completion(ctx context.Context, params *lsp.CompletionParams) (*lsp.CompletionList, error) {
+	doc, _ := h.docs.Get(params.TextDocument.URI)
+	if strings.Contains(doc.Text(), "{") {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &lsp.CompletionList{}, nil
+}
+
+func (h *buggyHandler) DocumentSymbol(_ context.Context, params *lsp.DocumentSymbolParams) ([]lsp.DocumentSymbol, error) {
+	doc, _ := h.docs.Get(params.TextDocument.URI)
+	var symbols []lsp.DocumentSymbol
+	for i, line := range doc.Lines() {
+		if line == "" {
+			continue
+		}
+		r := lsp.Range{Start: lsp.Position{Line: i}, End: lsp.Position{Line: i, Character: len(line)}}
+		symbols = append(symbols, lsp.DocumentSymbol{Name: line, Kind: lsp.SymbolKindVariable, Range: r, SelectionRange: r})
+	}
+	return symbols, nil
+}
+
+func TestFuzzerShrinksFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		steps     []fuzzStep
+		kind      string
+		method    string
+		wantSteps []string
+	}{
+		{
+			name: "panic",
+			text: "ab\ncd",
+			steps: []fuzzStep{
+				{kind: stepHover},
+				{kind: stepEdit, insert: 1},
+				{kind: stepEdit, insert: 7},
+				{kind: stepCompletion},
+				{kind: stepFormatting},
+				{kind: stepHover, offset: 1},
+			},
+			kind:      "panic",
+			method:    "textDocument/hover",
+			wantSteps: []string{`replace 0:0-0:0 with "😀"`, "textDocument/hover at 0:0"},
+		},
+		{
+			name: "notification panic",
+			text: "ab",
+			steps: []fuzzStep{
+				{kind: stepEdit, insert: 10},
+				{kind: stepHover},
+				{kind: stepEdit, offset: 1, insert: 1},
+				{kind: stepEdit, insert: 10},
+				{kind: stepHover},
+			},
+			kind:      "panic",
+			method:    "textDocument/didChange",
+			wantSteps: []string{`replace 0:0-0:0 with "\""`, `replace 0:0-0:0 with "\""`},
+		},
+		{
+			name: "hang",
+			text: "ab",
+			steps: []fuzzStep{
+				{kind: stepEdit, offset: 2, insert: 9},
+				{kind: stepHover},
+				{kind: stepCompletion, offset: 1},
+				{kind: stepHover},
+			},
+			kind:      "hang",
+			method:    "textDocument/completion",
+			wantSteps: []string{`replace 0:2-0:2 with "{\n}"`, "textDocument/completion at 0:1"},
+		},
+		{
+			name: "invalid range",
+			text: "a\n",
+			steps: []fuzzStep{
+				{kind: stepDocumentSymbol},
+				{kind: stepEdit, insert: 6},
+				{kind: stepHover},
+				{kind: stepDocumentSymbol},
+			},
+			kind:      "invalid result",
+			method:    "textDocument/documentSymbol",
+			wantSteps: []string{`replace 0:0-0:0 with "é"`, "textDocument/documentSymbol"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fz := &fuzzer{t: t, newHandler: newBuggyHandler, opts: FuzzOptions{Timeout: 100 * time.Millisecond}.withDefaults()}
+
+			failure, _ := fz.run(tt.text, tt.steps)
+			if failure == nil || failure.kind != tt.kind || failure.method != tt.method {
+				t.Fatalf("failure = %+v, want %s in %s", failure, tt.kind, tt.method)
+			}
+
+			steps, failure := fz.shrink(tt.text, tt.steps, failure)
+			_, trace := fz.run(tt.text, steps)
+			if strings.Join(trace, "\n") != strings.Join(tt.wantSteps, "\n") {
+				t.Fatalf("shrunk to %q, want %q", trace, tt.wantSteps)
+			}
+
+			report := formatFuzzFailure(tt.text, trace, failure)
+			if !strings.HasPrefix(report, tt.method+" "+tt.kind+": ") || !strings.Contains(report, "2. "+tt.wantSteps[1]) {
+				t.Fatalf("report:\n%s", report)
+			}
+		})
+	}
+}
+
+func TestFuzzerSkipsUnadvertisedRequests(t *testing.T) {
+	fz := &fuzzer{t: t, newHandler: newBuggyHandler, opts: FuzzOptions{}.withDefaults()}
+	failure, trace := fz.run("x", decodeSteps(seedScript(), 64))
+	if failure != nil {
+		t.Fatalf("failure = %+v", failure)
+	}
+	want := []string{
+		"textDocument/hover at 0:1",
+		"textDocument/completion at 0:1",
+		"textDocument/definition at 0:1 (skipped, not advertised)",
+		"textDocument/references at 0:1 (skipped, not advertised)",
+		"textDocument/documentSymbol",
+		"textDocument/formatting (skipped, not advertised)",
+		`replace 0:1-0:1 with "x"`,
+	}
+	if got := strings.Join(trace[:len(want)], "\n"); got != strings.Join(want, "\n") {
+		t.Fatalf("trace = %q", trace)
+	}
+	if len(trace) != 2*len(want)-1 {
+		t.Fatalf("ran %d steps, want %d", len(trace), 2*len(want)-1)
+	}
+}
+
+func TestQuietTBKeepsRunsToThemselves(t *testing.T) {
+	tb := newQuietTB(t)
+	var dir string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dir = tb.TempDir()
+		tb.Skip("no server")
+	}()
+	<-done
+
+	if !tb.Failed() || !strings.Contains(tb.message(), "skipped the fuzz run: no server") {
+		t.Fatalf("Skip was not reported as a failure: %q", tb.message())
+	}
+	if t.Skipped() {
+		t.Fatal("Skip skipped the outer test")
+	}
+	ctx := tb.Context()
+	tb.runCleanups(time.Second)
+	if ctx.Err() == nil {
+		t.Error("context not cancelled when the run ended")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("temp dir %s not removed: %v", dir, err)
+	}
+}
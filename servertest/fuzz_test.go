@@ -0,0 +1,58 @@
+package servertest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/owenrumney/go-lsp/document"
+	"github.com/owenrumney/go-lsp/lsp"
+	"github.com/owenrumney/go-lsp/server"
+	"github.com/owenrumney/go-lsp/servertest"
+)
+
+// lineHandler hovers with the current line and reports each non-empty line
+// as a symbol.
+type lineHandler struct {
+	incrementalHandler
+}
+
+func (h *lineHandler) Hover(_ context.Context, params *lsp.HoverParams) (*lsp.Hover, error) {
+	doc, _ := h.docs.Get(params.TextDocument.URI)
+	line, _ := doc.Line(params.Position.Line)
+	return &lsp.Hover{Contents: lsp.MarkupContent{Kind: lsp.PlainText, Value: line}}, nil
+}
+
+func (h *lineHandler) DocumentSymbol(_ context.Context, params *lsp.DocumentSymbolParams) ([]lsp.DocumentSymbol, error) {
+	doc, _ := h.docs.Get(params.TextDocument.URI)
+	var symbols []lsp.DocumentSymbol
+	for i, line := range doc.Lines() {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		r := lsp.Range{
+			Start: lsp.Position{Line: i},
+			End:   lsp.Position{Line: i, Character: len(utf16.Encode([]rune(line)))},
+		}
+		symbols = append(symbols, lsp.DocumentSymbol{Name: line, Kind: lsp.SymbolKindString, Range: r, SelectionRange: r})
+	}
+	return symbols, nil
+}
+
+func FuzzLineHandler(f *testing.F) {
+	servertest.Fuzz(f, func() server.LifecycleHandler {
+		return &lineHandler{incrementalHandler{docs: document.NewStore()}}
+	}, servertest.FuzzOptions{
+		Seeds: []string{"", "hello\nworld\n", "a😀b\r\néx"},
+	})
+}
+
+func FuzzUTF8Handler(f *testing.F) {
+	servertest.Fuzz(f, func() server.LifecycleHandler {
+		return &utf8Handler{texts: make(map[lsp.DocumentURI]string)}
+	}, servertest.FuzzOptions{
+		Seeds: []string{"", "a😀b\r\néx"},
+	})
+}
@@ -0,0 +1,412 @@
+package servertest
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// UpdateEnv is the environment variable that makes AssertGolden rewrite
+// golden files, e.g. SERVERTEST_UPDATE=1 go test ./... It is read from the
+// environment rather than a flag, so servertest does not add flags to the
+// test binaries of packages that import it.
+const UpdateEnv = "SERVERTEST_UPDATE"
+
+// updateGolden reports whether UpdateEnv is set to a true value.
+func updateGolden() bool {
+	update, _ := strconv.ParseBool(os.Getenv(UpdateEnv))
+	return update
+}
+
+// AssertGolden compares got with the contents of the golden file at path,
+// failing the test if they differ. Set UpdateEnv to write got to the file
+// instead. Paths are relative to the package directory, e.g.
+// "testdata/hover.golden".
+func (h *Harness) AssertGolden(path, got string) {
+	h.t.Helper()
+
+	if updateGolden() {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			h.t.Fatalf("golden %s: %v", path, err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			h.t.Fatalf("golden %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		h.t.Fatalf("golden %s: %v (set %s=1 to create it)", path, err, UpdateEnv)
+	}
+	if string(want) != got {
+		h.t.Errorf("golden %s mismatch (set %s=1 to accept):\n%s", path, UpdateEnv,
+			lineDiff(splitLines(string(want)), splitLines(got)))
+	}
+}
+
+// AssertCompletionsGolden compares list, rendered by FormatCompletions, with
+// a golden file.
+func (h *Harness) AssertCompletionsGolden(path string, list *lsp.CompletionList) {
+	h.t.Helper()
+	h.AssertGolden(path, FormatCompletions(list))
+}
+
+// AssertSemanticTokensGolden compares tokens for the open document uri,
+// decoded against the legend the server advertised, with a golden file.
+func (h *Harness) AssertSemanticTokensGolden(path string, uri lsp.DocumentURI, tokens *lsp.SemanticTokens) {
+	h.t.Helper()
+	provider := h.InitResult.Capabilities.SemanticTokensProvider
+	if provider == nil {
+		h.t.Fatalf("server does not advertise semanticTokensProvider")
+	}
+	h.AssertGolden(path, formatSemanticTokens(h.openText(uri), h.encoding, provider.Legend, tokens))
+}
+
+// AssertTextEditsGolden applies edits to the open document uri and compares
+// the resulting diff with a golden file.
+func (h *Harness) AssertTextEditsGolden(path string, uri lsp.DocumentURI, edits []lsp.TextEdit) {
+	h.t.Helper()
+	got, err := formatTextEdits(uri, h.openText(uri), h.encoding, edits)
+	if err != nil {
+		h.t.Fatalf("golden %s: %v", path, err)
+	}
+	h.AssertGolden(path, got)
+}
+
+// AssertWorkspaceEditGolden applies edit to the open documents it touches and
+// compares the resulting diffs with a golden file.
+func (h *Harness) AssertWorkspaceEditGolden(path string, edit *lsp.WorkspaceEdit) {
+	h.t.Helper()
+	got, err := h.formatWorkspaceEdit(edit)
+	if err != nil {
+		h.t.Fatalf("golden %s: %v", path, err)
+	}
+	h.AssertGolden(path, got)
+}
+
+// AssertCodeActionsGolden renders each action's title, kind, diagnostics,
+// command, and edit as a diff against the open documents, and compares the
+// result with a golden file.
+func (h *Harness) AssertCodeActionsGolden(path string, actions []lsp.CodeAction) {
+	h.t.Helper()
+	var b strings.Builder
+	for i, action := range actions {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "## %s\n", action.Title)
+		if action.Kind != nil {
+			fmt.Fprintf(&b, "kind: %s\n", *action.Kind)
+		}
+		if action.IsPreferred != nil && *action.IsPreferred {
+			b.WriteString("preferred: true\n")
+		}
+		if action.Disabled != nil {
+			fmt.Fprintf(&b, "disabled: %s\n", action.Disabled.Reason)
+		}
+		for _, d := range action.Diagnostics {
+			fmt.Fprintf(&b, "diagnostic: %s %s\n", formatRange(d.Range), d.Message)
+		}
+		if action.Command != nil {
+			fmt.Fprintf(&b, "command: %s\n", action.Command.Command)
+		}
+		if action.Edit != nil {
+			edit, err := h.formatWorkspaceEdit(action.Edit)
+			if err != nil {
+				h.t.Fatalf("golden %s: %s: %v", path, action.Title, err)
+			}
+			b.WriteString(edit)
+		}
+	}
+	h.AssertGolden(path, b.String())
+}
+
+func (h *Harness) openText(uri lsp.DocumentURI) string {
+	h.t.Helper()
+	text, ok := h.docs.Text(uri)
+	if !ok {
+		h.t.Fatalf("document %s is not open", uri)
+	}
+	return text
+}
+
+func (h *Harness) formatWorkspaceEdit(edit *lsp.WorkspaceEdit) (string, error) {
+	h.t.Helper()
+	edits := make(map[lsp.DocumentURI][]lsp.TextEdit)
+	for uri, e := range edit.Changes {
+		edits[uri] = append(edits[uri], e...)
+	}
+	for _, change := range edit.DocumentChanges {
+		uri := change.TextDocument.URI
+		edits[uri] = append(edits[uri], change.Edits...)
+	}
+
+	var b strings.Builder
+	for _, uri := range slices.Sorted(maps.Keys(edits)) {
+		diff, err := formatTextEdits(uri, h.openText(uri), h.encoding, edits[uri])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(diff)
+	}
+	return b.String(), nil
+}
+
+var completionKindNames = [...]string{
+	"", "Text", "Method", "Function", "Constructor", "Field", "Variable",
+	"Class", "Interface", "Module", "Property", "Unit", "Value", "Enum",
+	"Keyword", "Snippet", "Color", "File", "Reference", "Folder",
+	"EnumMember", "Constant", "Struct", "Event", "Operator", "TypeParameter",
+}
+
+// FormatCompletions renders a completion list as a table with one item per
+// row, in the order the server returned them.
+func FormatCompletions(list *lsp.CompletionList) string {
+	if list == nil {
+		return "(no completions)\n"
+	}
+
+	var b strings.Builder
+	if list.IsIncomplete {
+		b.WriteString("incomplete\n")
+	}
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LABEL\tKIND\tDETAIL\tINSERT")
+	for _, item := range list.Items {
+		kind := ""
+		if item.Kind != nil {
+			kind = fmt.Sprint(int(*item.Kind))
+			if k := int(*item.Kind); k > 0 && k < len(completionKindNames) {
+				kind = completionKindNames[k]
+			}
+		}
+		insert := item.InsertText
+		if item.TextEdit != nil {
+			insert = fmt.Sprintf("%s @%s", item.TextEdit.NewText, formatRange(item.TextEdit.Range))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%q\n", item.Label, kind, item.Detail, insert)
+	}
+	_ = w.Flush()
+	return b.String()
+}
+
+// FormatSemanticTokens decodes tokens against legend and renders one token
+// per line with its position, type, modifiers, and the source text it covers.
+// Token positions are read as UTF-16.
+func FormatSemanticTokens(text string, legend lsp.SemanticTokensLegend, tokens *lsp.SemanticTokens) string {
+	return formatSemanticTokens(text, lsp.PositionEncodingUTF16, legend, tokens)
+}
+
+func formatSemanticTokens(text string, enc lsp.PositionEncodingKind, legend lsp.SemanticTokensLegend, tokens *lsp.SemanticTokens) string {
+	if tokens == nil {
+		return "(no tokens)\n"
+	}
+
+	var b strings.Builder
+	line, char := 0, 0
+	for i := 0; i+5 <= len(tokens.Data); i += 5 {
+		deltaLine, deltaChar, length, typ, mods := tokens.Data[i], tokens.Data[i+1], tokens.Data[i+2], tokens.Data[i+3], tokens.Data[i+4]
+		if deltaLine > 0 {
+			line += deltaLine
+			char = deltaChar
+		} else {
+			char += deltaChar
+		}
+
+		typeName := fmt.Sprintf("type(%d)", typ)
+		if typ >= 0 && typ < len(legend.TokenTypes) {
+			typeName = legend.TokenTypes[typ]
+		}
+		var modNames []string
+		for bit := 0; mods>>bit != 0; bit++ {
+			if mods&(1<<bit) == 0 {
+				continue
+			}
+			if bit < len(legend.TokenModifiers) {
+				modNames = append(modNames, legend.TokenModifiers[bit])
+			} else {
+				modNames = append(modNames, fmt.Sprintf("modifier(%d)", bit))
+			}
+		}
+
+		start := lsp.Position{Line: line, Character: char}
+		end := lsp.Position{Line: line, Character: char + length}
+		source := "?"
+		if s, err := offsetAt(text, enc, start); err == nil {
+			if e, err := offsetAt(text, enc, end); err == nil {
+				source = text[s:e]
+			}
+		}
+
+		fmt.Fprintf(&b, "%d:%d %s", line, char, typeName)
+		if len(modNames) > 0 {
+			fmt.Fprintf(&b, " [%s]", strings.Join(modNames, " "))
+		}
+		fmt.Fprintf(&b, " %q\n", source)
+	}
+	return b.String()
+}
+
+// FormatTextEdits applies edits to text and renders the change as a unified
+// diff with two lines of context. Edit ranges are read as UTF-16.
+func FormatTextEdits(uri lsp.DocumentURI, text string, edits []lsp.TextEdit) (string, error) {
+	return formatTextEdits(uri, text, lsp.PositionEncodingUTF16, edits)
+}
+
+func formatTextEdits(uri lsp.DocumentURI, text string, enc lsp.PositionEncodingKind, edits []lsp.TextEdit) (string, error) {
+	after, err := applyTextEdits(text, enc, edits)
+	if err != nil {
+		return "", err
+	}
+	if after == text {
+		return fmt.Sprintf("%s: no changes\n", uri), nil
+	}
+	return fmt.Sprintf("--- %s\n+++ %s\n", uri, uri) +
+		lineDiff(splitLines(text), splitLines(after)), nil
+}
+
+// applyTextEdits applies non-overlapping edits, all relative to text and
+// measured in enc.
+func applyTextEdits(text string, enc lsp.PositionEncodingKind, edits []lsp.TextEdit) (string, error) {
+	type span struct {
+		start, end int
+		newText    string
+	}
+	spans := make([]span, len(edits))
+	for i, e := range edits {
+		start, err := offsetAt(text, enc, e.Range.Start)
+		if err != nil {
+			return "", err
+		}
+		end, err := offsetAt(text, enc, e.Range.End)
+		if err != nil {
+			return "", err
+		}
+		spans[i] = span{start: start, end: end, newText: e.NewText}
+	}
+	slices.SortStableFunc(spans, func(a, b span) int {
+		return cmp.Or(cmp.Compare(a.start, b.start), cmp.Compare(a.end, b.end))
+	})
+
+	var b strings.Builder
+	pos := 0
+	for _, s := range spans {
+		if s.start < pos {
+			return "", fmt.Errorf("overlapping text edits at offset %d", s.start)
+		}
+		b.WriteString(text[pos:s.start])
+		b.WriteString(s.newText)
+		pos = s.end
+	}
+	b.WriteString(text[pos:])
+	return b.String(), nil
+}
+
+// splitLines splits text after each newline, without the empty element that
+// follows a trailing newline.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineDiff renders a unified diff of two line slices with two lines of
+// context around each change.
+func lineDiff(a, b []string) string {
+	const context = 2
+
+	// Longest common subsequence table.
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type op struct {
+		kind byte // ' ', '-', '+'
+		line string
+		ai   int
+		bi   int
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	var out strings.Builder
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		start := max(k-context, 0)
+		end := k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end = min(end+context, len(ops))
+				break
+			}
+			end = run
+		}
+
+		aCount, bCount := 0, 0
+		for _, o := range ops[start:end] {
+			if o.kind != '+' {
+				aCount++
+			}
+			if o.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", ops[start].ai+1, aCount, ops[start].bi+1, bCount)
+		for _, o := range ops[start:end] {
+			line := o.line
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			out.WriteByte(o.kind)
+			out.WriteString(line)
+		}
+		k = end
+	}
+	return out.String()
+}
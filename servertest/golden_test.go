@@ -0,0 +1,217 @@
+package servertest_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/owenrumney/go-lsp/document"
+	"github.com/owenrumney/go-lsp/lsp"
+	"github.com/owenrumney/go-lsp/server"
+	"github.com/owenrumney/go-lsp/servertest"
+)
+
+// goldenHandler completes keywords, highlights words as semantic tokens, and
+// offers a code action that renames every "x" to "count".
+type goldenHandler struct {
+	docs *document.Store
+}
+
+func (h *goldenHandler) Initialize(_ context.Context, _ *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	return &lsp.InitializeResult{}, nil
+}
+
+func (h *goldenHandler) Shutdown(_ context.Context) error { return nil }
+
+func (h *goldenHandler) DidOpen(_ context.Context, params *lsp.DidOpenTextDocumentParams) error {
+	_, err := h.docs.Open(params)
+	return err
+}
+
+func (h *goldenHandler) DidChange(_ context.Context, params *lsp.DidChangeTextDocumentParams) error {
+	_, err := h.docs.Change(params)
+	return err
+}
+
+func (h *goldenHandler) DidClose(_ context.Context, params *lsp.DidCloseTextDocumentParams) error {
+	h.docs.Close(params)
+	return nil
+}
+
+func (h *goldenHandler) Completion(_ context.Context, params *lsp.CompletionParams) (*lsp.CompletionList, error) {
+	keyword, function := lsp.CompletionItemKind(14), lsp.CompletionItemKind(3)
+	pos := params.Position
+	return &lsp.CompletionList{Items: []lsp.CompletionItem{
+		{Label: "return", Kind: &keyword, InsertText: "return "},
+		{Label: "println", Kind: &function, Detail: "func(a ...any)", TextEdit: &lsp.TextEdit{
+			Range:   lsp.Range{Start: pos, End: pos},
+			NewText: "println()",
+		}},
+	}}, nil
+}
+
+// words returns the start offset and text of each space-separated word in line.
+func words(line string) (starts []int, fields []string) {
+	for i := 0; i < len(line); {
+		if line[i] == ' ' {
+			i++
+			continue
+		}
+		end := i
+		for end < len(line) && line[end] != ' ' {
+			end++
+		}
+		starts = append(starts, i)
+		fields = append(fields, line[i:end])
+		i = end
+	}
+	return starts, fields
+}
+
+// SemanticTokensFull reports "func" as a keyword and every other word as a
+// variable, marking the first word on each line as a declaration.
+func (h *goldenHandler) SemanticTokensFull(_ context.Context, params *lsp.SemanticTokensParams) (*lsp.SemanticTokens, error) {
+	doc, _ := h.docs.Get(params.TextDocument.URI)
+	var data []int
+	prevLine, prevChar := 0, 0
+	for i, line := range doc.Lines() {
+		starts, fields := words(line)
+		for j, word := range fields {
+			typ, mods := 1, 0
+			if word == "func" {
+				typ = 0
+			} else if j == 0 {
+				mods = 1
+			}
+			if i != prevLine {
+				prevChar = 0
+			}
+			data = append(data, i-prevLine, starts[j]-prevChar, len(word), typ, mods)
+			prevLine, prevChar = i, starts[j]
+		}
+	}
+	return &lsp.SemanticTokens{Data: data}, nil
+}
+
+func (h *goldenHandler) renameX(uri lsp.DocumentURI) []lsp.TextEdit {
+	doc, _ := h.docs.Get(uri)
+	var edits []lsp.TextEdit
+	for i, line := range doc.Lines() {
+		starts, fields := words(line)
+		for j, word := range fields {
+			if word != "x" {
+				continue
+			}
+			edits = append(edits, lsp.TextEdit{
+				Range: lsp.Range{
+					Start: lsp.Position{Line: i, Character: starts[j]},
+					End:   lsp.Position{Line: i, Character: starts[j] + 1},
+				},
+				NewText: "count",
+			})
+		}
+	}
+	return edits
+}
+
+func (h *goldenHandler) CodeAction(_ context.Context, params *lsp.CodeActionParams) ([]lsp.CodeAction, error) {
+	uri := params.TextDocument.URI
+	kind := lsp.CodeActionKind("refactor.rewrite")
+	return []lsp.CodeAction{{
+		Title: "Rename x to count",
+		Kind:  &kind,
+		Edit: &lsp.WorkspaceEdit{Changes: map[lsp.DocumentURI][]lsp.TextEdit{
+			uri: h.renameX(uri),
+		}},
+	}}, nil
+}
+
+const goldenSource = `func main
+x := 1
+y := 2
+z := 3
+w := 4
+v := 5
+u := 6
+print x
+`
+
+func newGoldenHarness(t testing.TB) *servertest.Harness {
+	return servertest.New(t, &goldenHandler{docs: document.NewStore()}, servertest.WithServerOptions(
+		server.WithSemanticTokensOptions(lsp.SemanticTokensOptions{Legend: lsp.SemanticTokensLegend{
+			TokenTypes:     []string{"keyword", "variable"},
+			TokenModifiers: []string{"declaration"},
+		}}),
+	))
+}
+
+func TestGoldenSnapshots(t *testing.T) {
+	h := newGoldenHarness(t)
+	uri := lsp.DocumentURI("file:///main.go")
+	if err := h.DidOpen(uri, "go", goldenSource); err != nil {
+		t.Fatal(err)
+	}
+
+	completions, err := h.Completion(uri, 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.AssertCompletionsGolden("testdata/completions.golden", completions)
+
+	tokens, err := h.SemanticTokensFull(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.AssertSemanticTokensGolden("testdata/semantic_tokens.golden", uri, tokens)
+
+	actions, err := h.CodeAction(&lsp.CodeActionParams{TextDocument: lsp.TextDocumentIdentifier{URI: uri}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.AssertCodeActionsGolden("testdata/code_actions.golden", actions)
+	h.AssertTextEditsGolden("testdata/text_edits.golden", uri, actions[0].Edit.Changes[uri])
+}
+
+func TestGoldenMismatch(t *testing.T) {
+	t.Setenv(servertest.UpdateEnv, "")
+	rec := &recordingTB{T: t}
+	h := newGoldenHarness(rec)
+	h.AssertGolden("testdata/completions.golden", "LABEL  KIND\n")
+	if len(rec.errors) != 1 || !strings.Contains(rec.errors[0], "-return") {
+		t.Fatalf("errors = %q", rec.errors)
+	}
+}
+
+func TestFormatTextEdits(t *testing.T) {
+	got, err := servertest.FormatTextEdits("file:///a.txt", "one\ntwo", []lsp.TextEdit{{
+		Range:   lsp.Range{Start: lsp.Position{Line: 1, Character: 0}, End: lsp.Position{Line: 1, Character: 3}},
+		NewText: "2",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- file:///a.txt\n+++ file:///a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n\\ No newline at end of file\n+2\n\\ No newline at end of file\n"
+	if got != want {
+		t.Fatalf("FormatTextEdits =\n%s\nwant\n%s", got, want)
+	}
+
+	overlapping := []lsp.TextEdit{
+		{Range: lsp.Range{End: lsp.Position{Character: 2}}},
+		{Range: lsp.Range{Start: lsp.Position{Character: 1}, End: lsp.Position{Character: 3}}},
+	}
+	if _, err := servertest.FormatTextEdits("file:///a.txt", "one", overlapping); err == nil {
+		t.Fatal("expected an error for overlapping edits")
+	}
+}
+
+func TestGoldenUpdate(t *testing.T) {
+	t.Setenv(servertest.UpdateEnv, "1")
+	path := filepath.Join(t.TempDir(), "testdata", "new.golden")
+	h := newGoldenHarness(t)
+	h.AssertGolden(path, "LABEL  KIND\n")
+	if data, err := os.ReadFile(path); err != nil || string(data) != "LABEL  KIND\n" {
+		t.Fatalf("golden file = %q, %v", data, err)
+	}
+}
@@ -3,10 +3,12 @@ package servertest
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net"
-	"sync"
 	"testing"
 
+	"github.com/owenrumney/go-lsp/document"
 	"github.com/owenrumney/go-lsp/lsp"
 	"github.com/owenrumney/go-lsp/server"
 )
@@ -23,9 +25,16 @@ type Harness struct {
 	// InitResult holds the result from the initialize request.
 	InitResult *lsp.InitializeResult
 
-	// versions tracks document versions for auto-incrementing DidChange.
-	versions   map[lsp.DocumentURI]int
-	versionsMu sync.Mutex
+	// docs mirrors the open documents as the server should see them, for
+	// generating incremental edits and auto-incrementing versions.
+	docs *document.Store
+	// encoding is the position encoding negotiated at initialize. The
+	// harness API uses it, while docs always uses UTF-16.
+	encoding lsp.PositionEncodingKind
+
+	// conformance checks the server's messages when enabled with
+	// WithConformanceChecks.
+	conformance *conformance
 }
 
 // New creates a new test harness, starts the server, performs initialization,
@@ -33,10 +42,7 @@ type Harness struct {
 func New(t testing.TB, handler server.LifecycleHandler, opts ...Option) *Harness {
 	t.Helper()
 
-	cfg := &config{}
-	for _, opt := range opts {
-		opt(cfg)
-	}
+	cfg := newConfig(opts)
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -50,33 +56,60 @@ func New(t testing.TB, handler server.LifecycleHandler, opts ...Option) *Harness
 		serverDone <- srv.Run(ctx, serverConn)
 	}()
 
-	rpc := newRPCConn(clientConn)
+	h, err := start(ctx, t, cancel, cfg, clientConn)
+	if err != nil {
+		cancel()
+		_ = clientConn.Close()
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		// Send shutdown request (ignore errors on already-closed connections).
+		_, _ = h.conn.call(context.Background(), "shutdown", nil)
+
+		// Send exit notification.
+		_ = h.conn.notify(context.Background(), "exit", nil)
+
+		// Cancel the context to stop the server.
+		cancel()
+
+		// Close the client side of the pipe.
+		_ = clientConn.Close()
+
+		// Wait for server to finish.
+		<-serverDone
+	})
+
+	return h
+}
+
+// start connects a harness to the server on the other end of rw and
+// performs initialization. The caller registers the cleanup that shuts the
+// server down.
+func start(ctx context.Context, t testing.TB, cancel context.CancelFunc, cfg *config, rw io.ReadWriter) (*Harness, error) {
+	rpc := newRPCConn(rw)
 
 	notifs := newNotifStore()
 	clientRequests := newClientRequestStore()
-	rpc.notifHandler = func(method string, params json.RawMessage) {
-		switch method {
-		case "textDocument/publishDiagnostics":
-			var p lsp.PublishDiagnosticsParams
-			if err := json.Unmarshal(params, &p); err == nil {
-				notifs.addDiagnostics(p)
-			}
-		case "window/showMessage":
-			var p lsp.ShowMessageParams
-			if err := json.Unmarshal(params, &p); err == nil {
-				notifs.addMessage(p)
-			}
-		case "window/logMessage":
-			var p lsp.LogMessageParams
-			if err := json.Unmarshal(params, &p); err == nil {
-				notifs.addLogMessage(p)
-			}
-		}
-	}
+	rpc.notifHandler = notifs.add
 
 	// Handle server-to-client requests with default success responses.
 	rpc.requestHandler = clientRequests.handle
 
+	docs := document.NewStore()
+	var checker *conformance
+	if cfg.conformance {
+		checker = newConformance(docs, cfg.staleDiagnostics)
+		rpc.tap = checker.observe
+		// Registered before the shutdown cleanup so it runs after it, and
+		// also reports violations sent during shutdown.
+		t.Cleanup(func() {
+			for _, v := range checker.take() {
+				t.Errorf("protocol violation: %s", v)
+			}
+		})
+	}
+
 	// Start the read loop.
 	go rpc.readLoop()
 
@@ -87,7 +120,8 @@ func New(t testing.TB, handler server.LifecycleHandler, opts ...Option) *Harness
 		clientRequests: clientRequests,
 		cancel:         cancel,
 		ctx:            ctx,
-		versions:       make(map[lsp.DocumentURI]int),
+		docs:           docs,
+		conformance:    checker,
 	}
 
 	// Send initialize request.
@@ -103,45 +137,29 @@ func New(t testing.TB, handler server.LifecycleHandler, opts ...Option) *Harness
 			Capabilities: lsp.ClientCapabilities{},
 		}
 	}
+	if cfg.profile != nil {
+		params := *initParams
+		params.ClientInfo = &cfg.profile.ClientInfo
+		params.Capabilities = cfg.profile.Capabilities
+		initParams = &params
+	}
 
 	result, err := rpc.call(ctx, "initialize", initParams)
 	if err != nil {
-		cancel()
-		_ = clientConn.Close()
-		t.Fatalf("initialize failed: %v", err)
+		return nil, fmt.Errorf("initialize failed: %w", err)
 	}
 
 	var initResult lsp.InitializeResult
 	if err := json.Unmarshal(result, &initResult); err != nil {
-		cancel()
-		_ = clientConn.Close()
-		t.Fatalf("unmarshal InitializeResult: %v", err)
+		return nil, fmt.Errorf("unmarshal InitializeResult: %w", err)
 	}
 	h.InitResult = &initResult
+	h.encoding = negotiatedEncoding(initResult.Capabilities)
 
 	// Send initialized notification.
 	if err := rpc.notify(ctx, "initialized", &lsp.InitializedParams{}); err != nil {
-		cancel()
-		_ = clientConn.Close()
-		t.Fatalf("initialized notification failed: %v", err)
+		return nil, fmt.Errorf("initialized notification failed: %w", err)
 	}
 
-	t.Cleanup(func() {
-		// Send shutdown request (ignore errors on already-closed connections).
-		_, _ = rpc.call(context.Background(), "shutdown", nil)
-
-		// Send exit notification.
-		_ = rpc.notify(context.Background(), "exit", nil)
-
-		// Cancel the context to stop the server.
-		cancel()
-
-		// Close the client side of the pipe.
-		_ = clientConn.Close()
-
-		// Wait for server to finish.
-		<-serverDone
-	})
-
-	return h
+	return h, nil
 }
@@ -8,27 +8,22 @@ import (
 
 // DidOpen sends a textDocument/didOpen notification.
 func (h *Harness) DidOpen(uri lsp.DocumentURI, languageID, text string) error {
-	h.versionsMu.Lock()
-	h.versions[uri] = 1
-	h.versionsMu.Unlock()
-
-	return h.conn.notify(h.ctx, "textDocument/didOpen", &lsp.DidOpenTextDocumentParams{
+	params := &lsp.DidOpenTextDocumentParams{
 		TextDocument: lsp.TextDocumentItem{
 			URI:        uri,
 			LanguageID: languageID,
 			Version:    1,
 			Text:       text,
 		},
-	})
+	}
+	_, _ = h.docs.Open(params)
+
+	return h.conn.notify(h.ctx, "textDocument/didOpen", params)
 }
 
 // DidChange sends a textDocument/didChange notification with full document sync.
 func (h *Harness) DidChange(uri lsp.DocumentURI, version int, text string) error {
-	h.versionsMu.Lock()
-	h.versions[uri] = version
-	h.versionsMu.Unlock()
-
-	return h.conn.notify(h.ctx, "textDocument/didChange", &lsp.DidChangeTextDocumentParams{
+	params := &lsp.DidChangeTextDocumentParams{
 		TextDocument: lsp.VersionedTextDocumentIdentifier{
 			TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri},
 			Version:                version,
@@ -36,7 +31,20 @@ func (h *Harness) DidChange(uri lsp.DocumentURI, version int, text string) error
 		ContentChanges: []lsp.TextDocumentContentChangeEvent{
 			{Text: text},
 		},
-	})
+	}
+	if _, err := h.docs.Change(params); err != nil {
+		// Tests may deliberately send unknown documents or stale versions;
+		// the mirror follows whatever the client claims.
+		languageID := ""
+		if doc, ok := h.docs.Get(uri); ok {
+			languageID = doc.LanguageID()
+		}
+		_, _ = h.docs.Open(&lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{
+			URI: uri, LanguageID: languageID, Version: version, Text: text,
+		}})
+	}
+
+	return h.conn.notify(h.ctx, "textDocument/didChange", params)
 }
 
 // DidSave sends a textDocument/didSave notification.
@@ -48,13 +56,12 @@ func (h *Harness) DidSave(uri lsp.DocumentURI) error {
 
 // DidClose sends a textDocument/didClose notification.
 func (h *Harness) DidClose(uri lsp.DocumentURI) error {
-	h.versionsMu.Lock()
-	delete(h.versions, uri)
-	h.versionsMu.Unlock()
-
-	return h.conn.notify(h.ctx, "textDocument/didClose", &lsp.DidCloseTextDocumentParams{
+	params := &lsp.DidCloseTextDocumentParams{
 		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
-	})
+	}
+	h.docs.Close(params)
+
+	return h.conn.notify(h.ctx, "textDocument/didClose", params)
 }
 
 // WillSave sends a textDocument/willSave notification.
@@ -2,14 +2,23 @@ package servertest
 
 import (
 	"context"
+	"encoding/json"
+	"slices"
 	"sync"
 
 	"github.com/owenrumney/go-lsp/lsp"
 )
 
+// Notification is a server-to-client notification recorded by the harness.
+type Notification struct {
+	Method string
+	Params json.RawMessage
+}
+
 type notifStore struct {
 	mu          sync.Mutex
 	cond        *sync.Cond
+	all         []Notification
 	diagnostics []lsp.PublishDiagnosticsParams
 	messages    []lsp.ShowMessageParams
 	logMessages []lsp.LogMessageParams
@@ -21,24 +30,30 @@ func newNotifStore() *notifStore {
 	return s
 }
 
-func (s *notifStore) addDiagnostics(params lsp.PublishDiagnosticsParams) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.diagnostics = append(s.diagnostics, params)
-	s.cond.Broadcast()
-}
-
-func (s *notifStore) addMessage(params lsp.ShowMessageParams) {
+// add records every notification, and additionally decodes the ones with
+// dedicated accessors.
+func (s *notifStore) add(method string, params json.RawMessage) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.messages = append(s.messages, params)
-	s.cond.Broadcast()
-}
+	s.all = append(s.all, Notification{Method: method, Params: slices.Clone(params)})
 
-func (s *notifStore) addLogMessage(params lsp.LogMessageParams) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.logMessages = append(s.logMessages, params)
+	switch method {
+	case "textDocument/publishDiagnostics":
+		var p lsp.PublishDiagnosticsParams
+		if err := json.Unmarshal(params, &p); err == nil {
+			s.diagnostics = append(s.diagnostics, p)
+		}
+	case "window/showMessage":
+		var p lsp.ShowMessageParams
+		if err := json.Unmarshal(params, &p); err == nil {
+			s.messages = append(s.messages, p)
+		}
+	case "window/logMessage":
+		var p lsp.LogMessageParams
+		if err := json.Unmarshal(params, &p); err == nil {
+			s.logMessages = append(s.logMessages, p)
+		}
+	}
 	s.cond.Broadcast()
 }
 
@@ -131,6 +146,74 @@ func (h *Harness) WaitForDiagnostics(ctx context.Context, uri lsp.DocumentURI) (
 	}
 }
 
+// Notifications returns every notification the server has sent, in the order
+// received. With methods, only notifications for those methods are returned.
+func (h *Harness) Notifications(methods ...string) []Notification {
+	h.notifs.mu.Lock()
+	defer h.notifs.mu.Unlock()
+	var result []Notification
+	for _, n := range h.notifs.all {
+		if len(methods) == 0 || slices.Contains(methods, n.Method) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// WaitForNotification waits until a notification for method is received for
+// which match returns true, and returns it. A nil match accepts any
+// notification for method. Notifications received before the call are
+// considered too.
+func (h *Harness) WaitForNotification(ctx context.Context, method string, match func(Notification) bool) (Notification, error) {
+	h.notifs.mu.Lock()
+	defer h.notifs.mu.Unlock()
+
+	for seen := 0; ; {
+		for ; seen < len(h.notifs.all); seen++ {
+			n := h.notifs.all[seen]
+			if n.Method == method && (match == nil || match(n)) {
+				return n, nil
+			}
+		}
+		if err := waitCond(ctx, h.notifs.cond); err != nil {
+			return Notification{}, err
+		}
+	}
+}
+
+// TelemetryEvents returns the params of all collected telemetry/event
+// notifications.
+func (h *Harness) TelemetryEvents() []json.RawMessage {
+	var result []json.RawMessage
+	for _, n := range h.Notifications("telemetry/event") {
+		result = append(result, n.Params)
+	}
+	return result
+}
+
+// LogTraces returns all collected $/logTrace notifications.
+func (h *Harness) LogTraces() []lsp.LogTraceParams {
+	var result []lsp.LogTraceParams
+	for _, n := range h.Notifications("$/logTrace") {
+		var p lsp.LogTraceParams
+		if err := json.Unmarshal(n.Params, &p); err == nil {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// ClearNotifications removes every collected notification, including
+// diagnostics, messages, and progress.
+func (h *Harness) ClearNotifications() {
+	h.notifs.mu.Lock()
+	defer h.notifs.mu.Unlock()
+	h.notifs.all = nil
+	h.notifs.diagnostics = nil
+	h.notifs.messages = nil
+	h.notifs.logMessages = nil
+}
+
 // ClearDiagnostics removes all collected diagnostics.
 func (h *Harness) ClearDiagnostics() {
 	h.notifs.mu.Lock()
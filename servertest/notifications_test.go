@@ -0,0 +1,120 @@
+package servertest_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/owenrumney/go-lsp/lsp"
+	"github.com/owenrumney/go-lsp/server"
+	"github.com/owenrumney/go-lsp/servertest"
+)
+
+// progressHandler reports progress for the "index" command, and sends
+// telemetry and a custom notification when it finishes.
+type progressHandler struct {
+	client *server.Client
+}
+
+func (h *progressHandler) SetClient(c *server.Client) { h.client = c }
+
+func (h *progressHandler) Initialize(_ context.Context, _ *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	return &lsp.InitializeResult{}, nil
+}
+
+func (h *progressHandler) Shutdown(_ context.Context) error { return nil }
+
+func (h *progressHandler) progress(ctx context.Context, token string, value any) {
+	raw, _ := json.Marshal(value)
+	tok, _ := json.Marshal(token)
+	_ = h.client.Progress(ctx, &lsp.ProgressParams{Token: tok, Value: raw})
+}
+
+func (h *progressHandler) ExecuteCommand(ctx context.Context, params *lsp.ExecuteCommandParams) (any, error) {
+	pct := func(n int) *int { return &n }
+	switch params.Command {
+	case "index":
+		h.progress(ctx, "index", lsp.WorkDoneProgressBegin{Kind: "begin", Title: "Indexing", Percentage: pct(0)})
+		h.progress(ctx, "index", lsp.WorkDoneProgressReport{Kind: "report", Message: "1/2", Percentage: pct(50)})
+		h.progress(ctx, "index", lsp.WorkDoneProgressEnd{Kind: "end", Message: "done"})
+		_ = h.client.Notify(ctx, "telemetry/event", map[string]int{"files": 2})
+		_ = h.client.Notify(ctx, "custom/indexed", map[string]string{"root": "/src"})
+	case "broken":
+		h.progress(ctx, "broken", lsp.WorkDoneProgressReport{Kind: "report", Percentage: pct(60)})
+		h.progress(ctx, "broken", lsp.WorkDoneProgressBegin{Kind: "begin", Title: "Broken", Percentage: pct(40)})
+		h.progress(ctx, "broken", lsp.WorkDoneProgressReport{Kind: "report", Percentage: pct(20)})
+	}
+	return nil, nil
+}
+
+func TestNotifications(t *testing.T) {
+	h := servertest.New(t, &progressHandler{})
+	if _, err := h.ExecuteCommand("index", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	n, err := h.WaitForNotification(ctx, "custom/indexed", func(n servertest.Notification) bool {
+		return strings.Contains(string(n.Params), "/src")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(n.Params) != `{"root":"/src"}` {
+		t.Fatalf("params = %s", n.Params)
+	}
+
+	if got := len(h.Notifications()); got != 5 {
+		t.Fatalf("len(Notifications()) = %d, want 5", got)
+	}
+	if got := len(h.Notifications("$/progress")); got != 3 {
+		t.Fatalf("progress notifications = %d, want 3", got)
+	}
+	if events := h.TelemetryEvents(); len(events) != 1 || string(events[0]) != `{"files":2}` {
+		t.Fatalf("TelemetryEvents() = %s", events)
+	}
+
+	p, err := h.WaitForProgressEnd(ctx, "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Begin.Title != "Indexing" || len(p.Reports) != 1 || p.Reports[0].Message != "1/2" || p.End.Message != "done" {
+		t.Fatalf("progress = %+v", p)
+	}
+
+	h.ClearNotifications()
+	if len(h.Notifications()) != 0 || len(h.Progress()) != 0 {
+		t.Fatal("notifications not cleared")
+	}
+}
+
+func TestProgressValidate(t *testing.T) {
+	h := servertest.New(t, &progressHandler{})
+	if _, err := h.ExecuteCommand("broken", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	p, ok := h.ProgressFor("broken")
+	if !ok {
+		t.Fatal("no progress for token")
+	}
+	if p.Done() {
+		t.Fatal("Done() = true without an end notification")
+	}
+	err := p.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"report before begin", "decreased from 60 to 20", "no end notification"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, missing %q", err, want)
+		}
+	}
+}
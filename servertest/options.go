@@ -1,6 +1,8 @@
 package servertest
 
 import (
+	"time"
+
 	"github.com/owenrumney/go-lsp/lsp"
 	"github.com/owenrumney/go-lsp/server"
 )
@@ -8,6 +10,19 @@ import (
 type config struct {
 	initParams *lsp.InitializeParams
 	serverOpts []server.Option
+	profile    *ClientProfile
+
+	conformance      bool
+	staleDiagnostics bool
+	exitTimeout      time.Duration
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{exitTimeout: 5 * time.Second}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
 }
 
 // Option configures a Harness.
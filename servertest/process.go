@@ -0,0 +1,184 @@
+package servertest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// WithExitTimeout sets how long a server started with NewProcess has to
+// answer shutdown and then exit after the exit notification. The default is
+// 5 seconds.
+func WithExitTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.exitTimeout = d
+	}
+}
+
+// NewProcess starts cmd, a language server executable, and returns a harness
+// that speaks LSP over its stdin and stdout. Use it to test the compiled
+// binary, including its flags and startup, with the same API as New.
+//
+//	cmd := exec.Command("./bin/my-lsp", "--stdio")
+//	h := servertest.NewProcess(t, cmd)
+//
+// cmd must not have Stdin or Stdout set. If Stderr is nil, each line the
+// server writes to stderr is logged to the test. The test fails if the
+// process exits before answering initialize. When the test ends the harness
+// sends shutdown and exit and closes stdin, and fails the test unless the
+// process then exits with status 0 within the exit timeout (see
+// WithExitTimeout); a process that does not exit is killed.
+//
+// WithServerOptions has no effect on a process harness.
+func NewProcess(t testing.TB, cmd *exec.Cmd, opts ...Option) *Harness {
+	t.Helper()
+
+	cfg := newConfig(opts)
+	name := filepath.Base(cmd.Path)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("start %s: %v", name, err)
+	}
+	// Read stdout from a pipe of our own: the one from StdoutPipe is closed
+	// by Wait, which could discard the server's last messages.
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("start %s: %v", name, err)
+	}
+	cmd.Stdout = stdoutWriter
+	var stderr *lineLogger
+	if cmd.Stderr == nil {
+		stderr = &lineLogger{t: t, prefix: name + ": "}
+		cmd.Stderr = stderr
+	}
+	// Bounds how long Wait waits for stderr if the server leaves a child
+	// process holding it open.
+	cmd.WaitDelay = cfg.exitTimeout
+
+	if err := cmd.Start(); err != nil {
+		_ = stdout.Close()
+		_ = stdoutWriter.Close()
+		t.Fatalf("start %s: %v", name, err)
+	}
+	_ = stdoutWriter.Close()
+
+	p := &process{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h, err := start(ctx, t, cancel, cfg, struct {
+		io.Reader
+		io.Writer
+	}{stdout, stdin})
+	if err != nil {
+		cancel()
+		_ = stdin.Close()
+		status := p.stop(cfg.exitTimeout)
+		_ = stdout.Close()
+		stderr.flush()
+		t.Fatalf("%v; %s %s", err, name, status)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancelTimeout := context.WithTimeout(context.Background(), cfg.exitTimeout)
+		defer cancelTimeout()
+
+		if _, err := h.conn.call(ctx, "shutdown", nil); err != nil {
+			t.Errorf("%s: shutdown failed: %v", name, err)
+		}
+		if err := h.conn.notify(ctx, "exit", nil); err != nil {
+			t.Errorf("%s: exit notification failed: %v", name, err)
+		}
+		// Close stdin as an editor does once it has sent exit, so a server
+		// that reads until the end of its input also stops.
+		_ = stdin.Close()
+
+		select {
+		case <-p.done:
+			if p.err != nil {
+				t.Errorf("%s did not exit cleanly after exit: %v", name, p.err)
+			}
+		case <-time.After(cfg.exitTimeout):
+			t.Errorf("%s did not exit within %v of the exit notification", name, cfg.exitTimeout)
+			_ = p.cmd.Process.Kill()
+			<-p.done
+		}
+
+		cancel()
+		_ = stdin.Close()
+		_ = stdout.Close()
+		stderr.flush()
+	})
+
+	return h
+}
+
+type process struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+}
+
+// stop waits for the process to exit, killing it after timeout, and
+// describes how it exited.
+func (p *process) stop(timeout time.Duration) string {
+	select {
+	case <-p.done:
+	case <-time.After(timeout):
+		_ = p.cmd.Process.Kill()
+		<-p.done
+		return "did not exit and was killed"
+	}
+	if p.err != nil {
+		return fmt.Sprintf("exited: %v", p.err)
+	}
+	return "exited with status 0"
+}
+
+// lineLogger logs each line written to it to the test.
+type lineLogger struct {
+	t      testing.TB
+	prefix string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (l *lineLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.t.Log(l.prefix + string(bytes.TrimSuffix(l.buf[:i], []byte("\r"))))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush logs a final line that has no newline. It is a no-op on nil.
+func (l *lineLogger) flush() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buf) > 0 {
+		l.t.Log(l.prefix + string(l.buf))
+		l.buf = nil
+	}
+}
@@ -0,0 +1,157 @@
+package servertest_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/owenrumney/go-lsp/document"
+	"github.com/owenrumney/go-lsp/server"
+	"github.com/owenrumney/go-lsp/servertest"
+)
+
+// helperEnv makes the test binary run as a language server on stdio, in the
+// mode given by its value, instead of running tests.
+const helperEnv = "SERVERTEST_HELPER_SERVER"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(helperEnv); mode != "" {
+		os.Exit(runHelperServer(mode))
+	}
+	os.Exit(m.Run())
+}
+
+func runHelperServer(mode string) int {
+	if mode == "crash" {
+		fmt.Fprintln(os.Stderr, "unknown flag --frobnicate")
+		return 2
+	}
+
+	fmt.Fprintln(os.Stderr, "serving on stdio")
+	srv := server.NewServer(&wordHandler{docs: document.NewStore()})
+	if err := srv.Run(context.Background(), server.RunStdio()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	switch mode {
+	case "hang":
+		select {}
+	case "fail":
+		return 3
+	}
+	return 0
+}
+
+func helperCommand(mode string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), helperEnv+"="+mode)
+	return cmd
+}
+
+// processTB records errors and logs. Fatal errors stop only the calling
+// goroutine, so startup failures can be tested.
+type processTB struct {
+	*testing.T
+
+	mu     sync.Mutex
+	errors []string
+	logs   []string
+}
+
+func (p *processTB) Errorf(format string, args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.errors = append(p.errors, fmt.Sprintf(format, args...))
+}
+
+func (p *processTB) Fatalf(format string, args ...any) {
+	p.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+func (p *processTB) Log(args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.logs = append(p.logs, fmt.Sprint(args...))
+}
+
+// runProcess runs fn against a helper server in a subtest, so the harness
+// has been shut down by the time it returns.
+func runProcess(t *testing.T, mode string, fn func(h *servertest.Harness), opts ...servertest.Option) *processTB {
+	t.Helper()
+	var rec *processTB
+	t.Run(mode, func(t *testing.T) {
+		rec = &processTB{T: t}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			fn(servertest.NewProcess(rec, helperCommand(mode), opts...))
+		}()
+		<-done
+	})
+	return rec
+}
+
+func TestNewProcess(t *testing.T) {
+	var hover string
+	rec := runProcess(t, "ok", func(h *servertest.Harness) {
+		if err := h.DidOpen("file:///a.txt", "plaintext", "hello world"); err != nil {
+			t.Error(err)
+			return
+		}
+		result, err := h.Hover("file:///a.txt", 0, 7)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		hover = result.Contents.Value
+	})
+
+	if hover != "world" {
+		t.Fatalf("hover = %q, want world", hover)
+	}
+	if len(rec.errors) != 0 {
+		t.Fatalf("errors = %q", rec.errors)
+	}
+	if len(rec.logs) != 1 || !strings.HasSuffix(rec.logs[0], ": serving on stdio") {
+		t.Fatalf("logs = %q, want the server's stderr", rec.logs)
+	}
+}
+
+func TestNewProcessFailures(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+		opts []servertest.Option
+	}{
+		{mode: "crash", want: "initialize failed: connection closed; servertest.test exited: exit status 2"},
+		{mode: "fail", want: "servertest.test did not exit cleanly after exit: exit status 3"},
+		{
+			mode: "hang",
+			want: "servertest.test did not exit within 200ms of the exit notification",
+			opts: []servertest.Option{servertest.WithExitTimeout(200 * time.Millisecond)},
+		},
+	}
+
+	for _, tt := range tests {
+		var ran bool
+		rec := runProcess(t, tt.mode, func(*servertest.Harness) { ran = true }, tt.opts...)
+		if ran != (tt.mode != "crash") {
+			t.Fatalf("%s: ran = %v", tt.mode, ran)
+		}
+		if len(rec.errors) != 1 || rec.errors[0] != tt.want {
+			t.Fatalf("%s: errors = %q, want %q", tt.mode, rec.errors, tt.want)
+		}
+	}
+
+	crash := runProcess(t, "crash", func(*servertest.Harness) {})
+	if len(crash.logs) != 1 || !strings.HasSuffix(crash.logs[0], ": unknown flag --frobnicate") {
+		t.Fatalf("logs = %q, want the server's stderr", crash.logs)
+	}
+}
@@ -0,0 +1,94 @@
+package servertest
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+//go:embed profiles/*.json
+var profileFiles embed.FS
+
+// ClientProfile is the client information and capabilities a particular
+// editor sends in its initialize request.
+type ClientProfile struct {
+	// Name identifies the profile, e.g. "vscode". It is used as the subtest
+	// name by RunProfiles.
+	Name         string
+	ClientInfo   lsp.ClientInfo
+	Capabilities lsp.ClientCapabilities
+}
+
+func loadProfile(name string) ClientProfile {
+	data, err := profileFiles.ReadFile("profiles/" + name + ".json")
+	if err != nil {
+		panic(fmt.Sprintf("servertest: profile %s: %v", name, err))
+	}
+	var raw struct {
+		ClientInfo   lsp.ClientInfo         `json:"clientInfo"`
+		Capabilities lsp.ClientCapabilities `json:"capabilities"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		panic(fmt.Sprintf("servertest: profile %s: %v", name, err))
+	}
+	return ClientProfile{Name: name, ClientInfo: raw.ClientInfo, Capabilities: raw.Capabilities}
+}
+
+// VSCodeProfile returns the capabilities sent by Visual Studio Code. It
+// supports nearly every feature, including snippets, markdown, resource
+// operations in workspace edits, and pull diagnostics, but only UTF-16
+// positions.
+func VSCodeProfile() ClientProfile { return loadProfile("vscode") }
+
+// NeovimProfile returns the capabilities sent by Neovim's built-in client. It
+// prefers UTF-8 positions, registers few capabilities dynamically, and does
+// not request semantic tokens for ranges.
+func NeovimProfile() ClientProfile { return loadProfile("neovim") }
+
+// HelixProfile returns the capabilities sent by Helix. It has no semantic
+// tokens, no pull diagnostics, and renders only markdown.
+func HelixProfile() ClientProfile { return loadProfile("helix") }
+
+// EmacsProfile returns the capabilities sent by Eglot, the Emacs client. It
+// has no semantic tokens, no pull diagnostics, and no resource operations in
+// workspace edits.
+func EmacsProfile() ClientProfile { return loadProfile("emacs") }
+
+// Profiles returns every predefined client profile.
+func Profiles() []ClientProfile {
+	return []ClientProfile{VSCodeProfile(), NeovimProfile(), HelixProfile(), EmacsProfile()}
+}
+
+// WithClientProfile initializes the server with the client information and
+// capabilities of p. It takes precedence over those fields in params passed
+// to WithInitializeParams, whatever the option order.
+func WithClientProfile(p ClientProfile) Option {
+	return func(c *config) {
+		c.profile = &p
+	}
+}
+
+// RunProfiles runs fn as a subtest once per profile, named after the profile.
+// With no profiles, every predefined profile is used.
+//
+//	servertest.RunProfiles(t, func(t *testing.T, p servertest.ClientProfile) {
+//		h := servertest.New(t, newHandler(), servertest.WithClientProfile(p))
+//		...
+//	})
+func RunProfiles(t *testing.T, fn func(t *testing.T, p ClientProfile), profiles ...ClientProfile) {
+	t.Helper()
+	if len(profiles) == 0 {
+		profiles = Profiles()
+	}
+	for _, p := range profiles {
+		t.Run(p.Name, func(t *testing.T) {
+			fn(t, p)
+		})
+	}
+}
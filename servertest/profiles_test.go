@@ -0,0 +1,79 @@
+package servertest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/owenrumney/go-lsp/lsp"
+	"github.com/owenrumney/go-lsp/servertest"
+)
+
+// profileHandler records the initialize params and offers pull diagnostics
+// only to clients that support them.
+type profileHandler struct {
+	params *lsp.InitializeParams
+}
+
+func (h *profileHandler) Initialize(_ context.Context, params *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	h.params = params
+	return &lsp.InitializeResult{}, nil
+}
+
+func (h *profileHandler) Shutdown(_ context.Context) error { return nil }
+
+func (h *profileHandler) pullDiagnostics() bool {
+	td := h.params.Capabilities.TextDocument
+	return td != nil && td.Diagnostic != nil
+}
+
+func TestRunProfiles(t *testing.T) {
+	want := map[string]struct {
+		client string
+		pull   bool
+	}{
+		"vscode": {"Visual Studio Code", true},
+		"neovim": {"Neovim", true},
+		"helix":  {"helix", false},
+		"emacs":  {"Eglot", false},
+	}
+
+	var ran []string
+	servertest.RunProfiles(t, func(t *testing.T, p servertest.ClientProfile) {
+		ran = append(ran, p.Name)
+		handler := &profileHandler{}
+		pid := 42
+		servertest.New(t, handler,
+			servertest.WithClientProfile(p),
+			servertest.WithInitializeParams(&lsp.InitializeParams{ProcessID: &pid, Locale: "en"}),
+		)
+
+		w := want[p.Name]
+		if handler.params.ClientInfo == nil || handler.params.ClientInfo.Name != w.client {
+			t.Fatalf("clientInfo = %+v, want %s", handler.params.ClientInfo, w.client)
+		}
+		if handler.params.Locale != "en" {
+			t.Fatalf("locale = %q, profile should not replace other params", handler.params.Locale)
+		}
+		if got := handler.pullDiagnostics(); got != w.pull {
+			t.Fatalf("pull diagnostics = %v, want %v", got, w.pull)
+		}
+		if ws := handler.params.Capabilities.Workspace; ws == nil || ws.ApplyEdit == nil || !*ws.ApplyEdit {
+			t.Fatal("expected applyEdit support")
+		}
+	})
+
+	if len(ran) != len(want) {
+		t.Fatalf("ran %v, want every profile", ran)
+	}
+}
+
+func TestRunSelectedProfiles(t *testing.T) {
+	var ran []string
+	servertest.RunProfiles(t, func(t *testing.T, p servertest.ClientProfile) {
+		ran = append(ran, p.Name)
+	}, servertest.HelixProfile(), servertest.EmacsProfile())
+
+	if len(ran) != 2 || ran[0] != "helix" || ran[1] != "emacs" {
+		t.Fatalf("ran %v", ran)
+	}
+}
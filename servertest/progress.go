@@ -0,0 +1,198 @@
+package servertest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/owenrumney/go-lsp/lsp"
+)
+
+// Progress is a work done progress sequence reconstructed from the $/progress
+// notifications sent for one token.
+type Progress struct {
+	// Token is the progress token, as sent by the server.
+	Token lsp.ProgressToken
+	// Begin is the begin notification, or nil if none was received.
+	Begin *lsp.WorkDoneProgressBegin
+	// Reports are the report notifications, in the order received.
+	Reports []lsp.WorkDoneProgressReport
+	// End is the end notification, or nil if the progress is still running.
+	End *lsp.WorkDoneProgressEnd
+
+	problems []string
+	lastPct  int
+}
+
+// Done reports whether the end notification has been received.
+func (p Progress) Done() bool {
+	return p.End != nil
+}
+
+// Validate reports protocol violations in the sequence: notifications before
+// begin or after end, a repeated begin, a missing end, and percentages that
+// are out of range or decrease.
+func (p Progress) Validate() error {
+	var errs []error
+	for _, problem := range p.problems {
+		errs = append(errs, fmt.Errorf("progress %s: %s", p.Token, problem))
+	}
+	if p.End == nil {
+		errs = append(errs, fmt.Errorf("progress %s: no end notification", p.Token))
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Progress) add(kind string, value json.RawMessage) {
+	switch kind {
+	case "begin":
+		var begin lsp.WorkDoneProgressBegin
+		if err := json.Unmarshal(value, &begin); err != nil {
+			p.problems = append(p.problems, fmt.Sprintf("invalid begin: %v", err))
+			return
+		}
+		if p.Begin != nil {
+			p.problems = append(p.problems, "begin sent twice")
+		}
+		p.checkOrder(kind)
+		p.checkPercentage(begin.Percentage)
+		p.Begin = &begin
+	case "report":
+		var report lsp.WorkDoneProgressReport
+		if err := json.Unmarshal(value, &report); err != nil {
+			p.problems = append(p.problems, fmt.Sprintf("invalid report: %v", err))
+			return
+		}
+		p.checkOrder(kind)
+		p.checkPercentage(report.Percentage)
+		p.Reports = append(p.Reports, report)
+	case "end":
+		var end lsp.WorkDoneProgressEnd
+		if err := json.Unmarshal(value, &end); err != nil {
+			p.problems = append(p.problems, fmt.Sprintf("invalid end: %v", err))
+			return
+		}
+		p.checkOrder(kind)
+		p.End = &end
+	}
+}
+
+func (p *Progress) checkOrder(kind string) {
+	if p.End != nil {
+		p.problems = append(p.problems, kind+" after end")
+	} else if kind != "begin" && p.Begin == nil {
+		p.problems = append(p.problems, kind+" before begin")
+	}
+}
+
+func (p *Progress) checkPercentage(pct *int) {
+	if pct == nil {
+		return
+	}
+	switch {
+	case *pct < 0 || *pct > 100:
+		p.problems = append(p.problems, fmt.Sprintf("percentage %d out of range", *pct))
+	case *pct < p.lastPct:
+		p.problems = append(p.problems, fmt.Sprintf("percentage decreased from %d to %d", p.lastPct, *pct))
+	default:
+		p.lastPct = *pct
+	}
+}
+
+// Progress returns the work done progress sequences received so far, one per
+// token, in the order their first notification arrived. $/progress
+// notifications that are not work done progress, such as partial results,
+// are ignored.
+func (h *Harness) Progress() []Progress {
+	var (
+		result []Progress
+		index  = make(map[string]int)
+	)
+	for _, n := range h.Notifications("$/progress") {
+		var params lsp.ProgressParams
+		if err := json.Unmarshal(n.Params, &params); err != nil {
+			continue
+		}
+		var value struct {
+			Kind string `json:"kind"`
+		}
+		if err := json.Unmarshal(params.Value, &value); err != nil {
+			continue
+		}
+		if value.Kind != "begin" && value.Kind != "report" && value.Kind != "end" {
+			continue
+		}
+
+		key := progressKey(params.Token)
+		i, ok := index[key]
+		if !ok {
+			i = len(result)
+			index[key] = i
+			result = append(result, Progress{Token: params.Token})
+		}
+		result[i].add(value.Kind, params.Value)
+	}
+	return result
+}
+
+// ProgressFor returns the work done progress sequence for token, which may be
+// a string, an integer, or an lsp.ProgressToken.
+func (h *Harness) ProgressFor(token any) (Progress, bool) {
+	key, err := tokenKey(token)
+	if err != nil {
+		return Progress{}, false
+	}
+	for _, p := range h.Progress() {
+		if progressKey(p.Token) == key {
+			return p, true
+		}
+	}
+	return Progress{}, false
+}
+
+// WaitForProgressEnd waits until the end notification for token is received,
+// and returns the complete sequence. token may be a string, an integer, or an
+// lsp.ProgressToken.
+func (h *Harness) WaitForProgressEnd(ctx context.Context, token any) (Progress, error) {
+	key, err := tokenKey(token)
+	if err != nil {
+		return Progress{}, err
+	}
+	_, err = h.WaitForNotification(ctx, "$/progress", func(n Notification) bool {
+		var params struct {
+			Token lsp.ProgressToken `json:"token"`
+			Value struct {
+				Kind string `json:"kind"`
+			} `json:"value"`
+		}
+		if err := json.Unmarshal(n.Params, &params); err != nil {
+			return false
+		}
+		return params.Value.Kind == "end" && progressKey(params.Token) == key
+	})
+	if err != nil {
+		return Progress{}, err
+	}
+	p, _ := h.ProgressFor(token)
+	return p, nil
+}
+
+// tokenKey returns the canonical JSON form of a progress token given as a Go
+// value.
+func tokenKey(token any) (string, error) {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", fmt.Errorf("progress token: %w", err)
+	}
+	return progressKey(data), nil
+}
+
+func progressKey(token lsp.ProgressToken) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, token); err != nil {
+		return string(token)
+	}
+	return b.String()
+}
@@ -0,0 +1,427 @@
+package servertest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/owenrumney/go-lsp/internal/debugui"
+	"github.com/owenrumney/go-lsp/server"
+)
+
+// ReplayOptions controls how a recorded debug trace is replayed and compared.
+type ReplayOptions struct {
+	// IgnoreFields lists JSON object keys that are removed at any depth before
+	// messages are compared, e.g. "timestamp" or "resultId".
+	IgnoreFields []string
+
+	// IgnoreMethods lists server→client notification and request methods that
+	// are left out of the comparison, e.g. "window/logMessage".
+	IgnoreMethods []string
+
+	// IgnoreNotificationOrder compares server→client notifications and
+	// requests without regard to the order they were sent in.
+	IgnoreNotificationOrder bool
+
+	// Timeout bounds the wait for each response and for trailing
+	// notifications. Defaults to five seconds.
+	Timeout time.Duration
+
+	// ServerOptions are passed to the server under test.
+	ServerOptions []server.Option
+}
+
+// ReplayTraceFile replays the trace at path against handler. See ReplayTrace.
+func ReplayTraceFile(t testing.TB, handler server.LifecycleHandler, path string, opts ReplayOptions) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	ReplayTrace(t, handler, data, opts)
+}
+
+// ReplayTrace turns a trace exported with Server.ExportDebugTrace or
+// SaveDebugTrace into a regression test.
+//
+// Every client→server message in the trace is sent to a fresh server running
+// handler, in the recorded order and without the harness's own initialize
+// handshake. Request IDs are reassigned, and $/cancelRequest notifications
+// are remapped to match. Each request waits for its response before the next
+// message is sent, unless the trace cancels it. Server→client requests are
+// answered with the responses the client recorded, in order per method.
+//
+// The test fails for every response, notification, or server→client request
+// that differs from the recording after applying opts.
+func ReplayTrace(t testing.TB, handler server.LifecycleHandler, data []byte, opts ReplayOptions) {
+	t.Helper()
+
+	var trace debugui.Trace
+	if err := json.Unmarshal(data, &trace); err != nil {
+		t.Fatalf("replay: decode trace: %v", err)
+	}
+	if trace.Version != debugui.TraceVersion {
+		t.Fatalf("replay: unsupported trace version %d", trace.Version)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	r, err := newReplayer(trace.Messages, opts)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	r.run(handler)
+	for _, diff := range r.diffs() {
+		t.Errorf("replay: %s", diff)
+	}
+}
+
+// traceMessage is a JSON-RPC message body from a trace.
+type traceMessage struct {
+	ID     *json.RawMessage `json:"id,omitempty"`
+	Method string           `json:"method,omitempty"`
+	Params json.RawMessage  `json:"params,omitempty"`
+	Result json.RawMessage  `json:"result,omitempty"`
+	Error  *rpcError        `json:"error,omitempty"`
+}
+
+// serverMessage is a server→client notification or request.
+type serverMessage struct {
+	method string
+	params json.RawMessage
+}
+
+type replayResponse struct {
+	result json.RawMessage
+	err    error
+}
+
+type replayer struct {
+	opts ReplayOptions
+
+	// Recorded traffic.
+	outgoing  []traceMessage            // client→server requests and notifications
+	responses map[string]traceMessage   // recorded client request ID → server response
+	replies   map[string][]traceMessage // method → recorded client responses to server requests
+	expected  []serverMessage           // server→client notifications and requests
+	cancelled map[string]bool           // recorded request IDs cancelled by the client
+	methods   map[string]string         // recorded client request ID → method
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	actual   []serverMessage
+	received map[string]replayResponse
+}
+
+func newReplayer(entries []debugui.Entry, opts ReplayOptions) (*replayer, error) {
+	entries = slices.Clone(entries)
+	slices.SortFunc(entries, func(a, b debugui.Entry) int { return a.ID - b.ID })
+
+	r := &replayer{
+		opts:      opts,
+		responses: make(map[string]traceMessage),
+		replies:   make(map[string][]traceMessage),
+		cancelled: make(map[string]bool),
+		methods:   make(map[string]string),
+		received:  make(map[string]replayResponse),
+	}
+	r.cond = sync.NewCond(&r.mu)
+
+	msgs := make([]traceMessage, len(entries))
+	serverRequests := make(map[string]string) // server request ID → method
+	for i, e := range entries {
+		if err := json.Unmarshal(e.Body, &msgs[i]); err != nil {
+			return nil, fmt.Errorf("message %d: %w", e.ID, err)
+		}
+		// The capture records outgoing messages after writing them, so a
+		// client's reply can precede the server request it answers.
+		if e.Direction == debugui.DirectionServerToClient && msgs[i].Method != "" && msgs[i].ID != nil {
+			serverRequests[idToString(msgs[i].ID)] = msgs[i].Method
+		}
+	}
+
+	for i, e := range entries {
+		msg := msgs[i]
+		id := idToString(msg.ID)
+
+		switch {
+		case e.Direction == debugui.DirectionClientToServer && msg.Method != "":
+			r.outgoing = append(r.outgoing, msg)
+			if id != "" {
+				r.methods[id] = msg.Method
+			}
+			if msg.Method == "$/cancelRequest" {
+				r.cancelled[cancelID(msg.Params)] = true
+			}
+		case e.Direction == debugui.DirectionClientToServer:
+			if method, ok := serverRequests[id]; ok {
+				r.replies[method] = append(r.replies[method], msg)
+				delete(serverRequests, id)
+			}
+		case msg.Method != "":
+			if !r.ignored(msg.Method) {
+				r.expected = append(r.expected, serverMessage{method: msg.Method, params: msg.Params})
+			}
+		default:
+			r.responses[id] = msg
+		}
+	}
+	return r, nil
+}
+
+func (r *replayer) ignored(method string) bool {
+	return slices.Contains(r.opts.IgnoreMethods, method)
+}
+
+func (r *replayer) run(handler server.LifecycleHandler) {
+	ctx, cancel := context.WithCancel(context.Background())
+	clientConn, serverConn := net.Pipe()
+
+	srv := server.NewServer(handler, r.opts.ServerOptions...)
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- srv.Run(ctx, serverConn)
+	}()
+	defer func() {
+		cancel()
+		_ = clientConn.Close()
+		<-serverDone
+	}()
+
+	rpc := newRPCConn(clientConn)
+	rpc.notifHandler = func(method string, params json.RawMessage) {
+		r.record(method, params)
+	}
+	rpc.requestHandler = r.reply
+	go rpc.readLoop()
+
+	calls := make(map[string]*PendingCall)
+	for _, msg := range r.outgoing {
+		var params any
+		if len(msg.Params) > 0 {
+			params = msg.Params
+		}
+
+		if msg.ID == nil {
+			if msg.Method == "$/cancelRequest" {
+				call, ok := calls[cancelID(msg.Params)]
+				if !ok {
+					continue
+				}
+				params = map[string]int64{"id": call.ID()}
+			}
+			if err := rpc.notify(ctx, msg.Method, params); err != nil {
+				return
+			}
+			if msg.Method == "exit" {
+				break
+			}
+			continue
+		}
+
+		id := idToString(msg.ID)
+		call, err := rpc.startCall(msg.Method, params)
+		if err != nil {
+			return
+		}
+		calls[id] = call
+		if !r.cancelled[id] {
+			r.wait(id, call)
+			delete(calls, id)
+		}
+	}
+	for id, call := range calls {
+		r.wait(id, call)
+	}
+
+	// Give the server time to send trailing notifications.
+	waitCtx, waitCancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer waitCancel()
+	r.mu.Lock()
+	for len(r.actual) < len(r.expected) {
+		if waitCond(waitCtx, r.cond) != nil {
+			break
+		}
+	}
+	r.mu.Unlock()
+}
+
+func (r *replayer) wait(id string, call *PendingCall) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.opts.Timeout)
+	defer cancel()
+	result, err := call.Wait(ctx)
+
+	r.mu.Lock()
+	r.received[id] = replayResponse{result: result, err: err}
+	r.mu.Unlock()
+}
+
+func (r *replayer) record(method string, params json.RawMessage) {
+	if r.ignored(method) {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.actual = append(r.actual, serverMessage{method: method, params: params})
+	r.cond.Broadcast()
+}
+
+// reply answers a server→client request with the next recorded response for
+// its method, or null if none was recorded.
+func (r *replayer) reply(method string, params json.RawMessage) func() (any, error) {
+	r.record(method, params)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	queue := r.replies[method]
+	if len(queue) == 0 {
+		return func() (any, error) { return nil, nil }
+	}
+	msg := queue[0]
+	r.replies[method] = queue[1:]
+	return func() (any, error) {
+		if msg.Error != nil {
+			return nil, errors.New(msg.Error.Message)
+		}
+		return msg.Result, nil
+	}
+}
+
+func (r *replayer) diffs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var diffs []string
+	for _, msg := range r.outgoing {
+		id := idToString(msg.ID)
+		want, ok := r.responses[id]
+		if msg.ID == nil || !ok || r.cancelled[id] {
+			continue
+		}
+		got, ok := r.received[id]
+		label := fmt.Sprintf("response to %s (recorded id %s)", r.methods[id], id)
+		switch {
+		case !ok:
+			diffs = append(diffs, label+": request was never sent")
+		case got.err != nil && !isRPCError(got.err):
+			diffs = append(diffs, fmt.Sprintf("%s: %v", label, got.err))
+		default:
+			if w, g := r.responseBody(want.Result, want.Error), r.responseBody(got.result, rpcErrorOf(got.err)); w != g {
+				diffs = append(diffs, fmt.Sprintf("%s differs:\n  recorded: %s\n  replayed: %s", label, w, g))
+			}
+		}
+	}
+
+	want := make([]string, len(r.expected))
+	for i, m := range r.expected {
+		want[i] = r.messageBody(m)
+	}
+	got := make([]string, len(r.actual))
+	for i, m := range r.actual {
+		got[i] = r.messageBody(m)
+	}
+	if r.opts.IgnoreNotificationOrder {
+		return append(diffs, unorderedDiffs(want, got)...)
+	}
+	for i := 0; i < max(len(want), len(got)); i++ {
+		switch {
+		case i >= len(got):
+			diffs = append(diffs, fmt.Sprintf("server message %d missing:\n  recorded: %s", i, want[i]))
+		case i >= len(want):
+			diffs = append(diffs, fmt.Sprintf("unexpected server message %d:\n  replayed: %s", i, got[i]))
+		case want[i] != got[i]:
+			diffs = append(diffs, fmt.Sprintf("server message %d differs:\n  recorded: %s\n  replayed: %s", i, want[i], got[i]))
+		}
+	}
+	return diffs
+}
+
+func unorderedDiffs(want, got []string) []string {
+	remaining := slices.Clone(got)
+	var diffs []string
+	for _, w := range want {
+		if i := slices.Index(remaining, w); i >= 0 {
+			remaining = slices.Delete(remaining, i, i+1)
+			continue
+		}
+		diffs = append(diffs, "server message missing:\n  recorded: "+w)
+	}
+	for _, g := range remaining {
+		diffs = append(diffs, "unexpected server message:\n  replayed: "+g)
+	}
+	return diffs
+}
+
+func (r *replayer) messageBody(m serverMessage) string {
+	return m.method + " " + r.normalize(m.params)
+}
+
+func (r *replayer) responseBody(result json.RawMessage, err *rpcError) string {
+	if err != nil {
+		return fmt.Sprintf("error %d: %s", err.Code, err.Message)
+	}
+	return r.normalize(result)
+}
+
+// normalize re-encodes raw with sorted keys and without ignored fields.
+func (r *replayer) normalize(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return "null"
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	v = stripFields(v, r.opts.IgnoreFields)
+	data, err := json.Marshal(v)
+	if err != nil {
+		return string(raw)
+	}
+	return string(data)
+}
+
+func stripFields(v any, fields []string) any {
+	switch x := v.(type) {
+	case map[string]any:
+		for k, child := range x {
+			if slices.Contains(fields, k) {
+				delete(x, k)
+				continue
+			}
+			x[k] = stripFields(child, fields)
+		}
+	case []any:
+		for i, child := range x {
+			x[i] = stripFields(child, fields)
+		}
+	}
+	return v
+}
+
+func cancelID(params json.RawMessage) string {
+	var p struct {
+		ID *json.RawMessage `json:"id"`
+	}
+	_ = json.Unmarshal(params, &p)
+	return idToString(p.ID)
+}
+
+func isRPCError(err error) bool {
+	return rpcErrorOf(err) != nil
+}
+
+func rpcErrorOf(err error) *rpcError {
+	var rpcErr *rpcError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package servertest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/owenrumney/go-lsp/internal/jsonrpc"
+	"github.com/owenrumney/go-lsp/lsp"
+	"github.com/owenrumney/go-lsp/server"
+	"github.com/owenrumney/go-lsp/servertest"
+)
+
+// replayHandler answers hover with a configurable greeting, asks the client a
+// question from executeCommand, and publishes a diagnostic on save.
+type replayHandler struct {
+	client   *server.Client
+	greeting string
+}
+
+func (h *replayHandler) SetClient(c *server.Client) { h.client = c }
+
+func (h *replayHandler) Initialize(_ context.Context, _ *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	return &lsp.InitializeResult{ServerInfo: &lsp.ServerInfo{Name: "replay"}}, nil
+}
+
+func (h *replayHandler) Shutdown(_ context.Context) error { return nil }
+
+func (h *replayHandler) Hover(_ context.Context, params *lsp.HoverParams) (*lsp.Hover, error) {
+	return &lsp.Hover{Contents: lsp.MarkupContent{
+		Kind:  lsp.PlainText,
+		Value: h.greeting + " " + string(params.TextDocument.URI),
+	}}, nil
+}
+
+func (h *replayHandler) ExecuteCommand(ctx context.Context, _ *lsp.ExecuteCommandParams) (any, error) {
+	item, err := h.client.ShowMessageRequest(ctx, &lsp.ShowMessageRequestParams{
+		Type:    lsp.MessageTypeInfo,
+		Message: "Continue?",
+		Actions: []lsp.MessageActionItem{{Title: "Yes"}, {Title: "No"}},
+	})
+	if err != nil || item == nil {
+		return nil, err
+	}
+	return item.Title, nil
+}
+
+func (h *replayHandler) DidOpen(_ context.Context, _ *lsp.DidOpenTextDocumentParams) error {
+	return nil
+}
+
+func (h *replayHandler) DidChange(_ context.Context, _ *lsp.DidChangeTextDocumentParams) error {
+	return nil
+}
+
+func (h *replayHandler) DidClose(_ context.Context, _ *lsp.DidCloseTextDocumentParams) error {
+	return nil
+}
+
+func (h *replayHandler) DidSave(ctx context.Context, params *lsp.DidSaveTextDocumentParams) error {
+	return h.client.PublishDiagnostics(ctx, &lsp.PublishDiagnosticsParams{
+		URI:         params.TextDocument.URI,
+		Diagnostics: []lsp.Diagnostic{{Message: h.greeting}},
+	})
+}
+
+// recordTrace drives a session against a capturing server with a real
+// JSON-RPC client and returns the exported trace.
+func recordTrace(t *testing.T) []byte {
+	t.Helper()
+	srv := server.NewServer(&replayHandler{greeting: "hello"}, server.WithDebugCapture())
+	clientConn, serverConn := net.Pipe()
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go func() { _ = srv.Run(ctx, serverConn) }()
+
+	d := jsonrpc.NewDispatcher()
+	d.RegisterMethod("window/showMessageRequest", func(context.Context, json.RawMessage) (any, error) {
+		return lsp.MessageActionItem{Title: "Yes"}, nil
+	})
+	conn := jsonrpc.NewConn(clientConn, d)
+	go func() { _ = conn.Serve(ctx) }()
+
+	uri := lsp.DocumentURI("file:///a.txt")
+	call := func(method string, params any) {
+		t.Helper()
+		resp, err := conn.Call(ctx, method, params)
+		if err != nil || resp.Error != nil {
+			t.Fatalf("%s: %v %v", method, err, resp.Error)
+		}
+	}
+	notify := func(method string, params any) {
+		t.Helper()
+		if err := conn.Notify(ctx, method, params); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	call("initialize", lsp.InitializeParams{})
+	notify("initialized", lsp.InitializedParams{})
+	notify("textDocument/didOpen", lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{URI: uri, Text: "x", Version: 1}})
+	notify("textDocument/didSave", lsp.DidSaveTextDocumentParams{TextDocument: lsp.TextDocumentIdentifier{URI: uri}})
+	call("textDocument/hover", lsp.HoverParams{TextDocumentPositionParams: lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+	}})
+	call("workspace/executeCommand", lsp.ExecuteCommandParams{Command: "ask"})
+	call("shutdown", nil)
+
+	data, err := srv.ExportDebugTrace(server.TraceExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestReplayTraceMatches(t *testing.T) {
+	trace := recordTrace(t)
+	servertest.ReplayTrace(t, &replayHandler{greeting: "hello"}, trace, servertest.ReplayOptions{})
+}
+
+func TestReplayTraceReportsDifferences(t *testing.T) {
+	trace := recordTrace(t)
+
+	rec := &recordingTB{T: t}
+	servertest.ReplayTrace(rec, &replayHandler{greeting: "goodbye"}, trace, servertest.ReplayOptions{})
+	if len(rec.errors) != 2 {
+		t.Fatalf("errors = %q, want hover and diagnostics differences", rec.errors)
+	}
+	if !strings.Contains(rec.errors[0], "textDocument/hover") || !strings.Contains(rec.errors[1], "textDocument/publishDiagnostics") {
+		t.Fatalf("errors = %q", rec.errors)
+	}
+
+	rec = &recordingTB{T: t}
+	servertest.ReplayTrace(rec, &replayHandler{greeting: "goodbye"}, trace, servertest.ReplayOptions{
+		IgnoreFields:  []string{"value"},
+		IgnoreMethods: []string{"textDocument/publishDiagnostics"},
+	})
+	if len(rec.errors) != 0 {
+		t.Fatalf("errors with ignores = %q", rec.errors)
+	}
+}
@@ -23,8 +23,13 @@ type rpcConn struct {
 
 	// notifHandler is called for server-to-client notifications.
 	notifHandler func(method string, params json.RawMessage)
-	// requestHandler is called for server-to-client requests (e.g. window/workDoneProgress/create).
-	requestHandler func(method string, params json.RawMessage) (any, error)
+	// requestHandler is called on the read loop for server-to-client requests
+	// (e.g. window/workDoneProgress/create). The function it returns produces
+	// the response and runs on its own goroutine, so a slow responder does not
+	// hold up other messages.
+	requestHandler func(method string, params json.RawMessage) func() (any, error)
+	// tap, if set, observes every frame before it is written or routed.
+	tap func(outgoing bool, data []byte)
 
 	done chan struct{}
 }
@@ -114,6 +119,9 @@ func (c *rpcConn) readLoop() {
 		if err != nil {
 			return
 		}
+		if c.tap != nil {
+			c.tap(false, data)
+		}
 
 		var raw rawMsg
 		if err := json.Unmarshal(data, &raw); err != nil {
@@ -157,15 +165,22 @@ func (c *rpcConn) handleIncomingRequest(_ []byte, raw rawMsg) {
 		_ = json.Unmarshal(*raw.ID, &id)
 	}
 
+	respond := func() (any, error) { return nil, nil }
+	if c.requestHandler != nil {
+		respond = c.requestHandler(*raw.Method, raw.Params)
+	}
+	go c.reply(id, respond)
+}
+
+// reply sends the response produced by respond for the request with id.
+func (c *rpcConn) reply(id any, respond func() (any, error)) {
 	var result any
 	var rpcErr *rpcError
-	if c.requestHandler != nil {
-		res, err := c.requestHandler(*raw.Method, raw.Params)
-		if err != nil {
-			rpcErr = &rpcError{Code: -32603, Message: err.Error()}
-		} else {
-			result = res
-		}
+	res, err := respond()
+	if err != nil {
+		rpcErr = &rpcError{Code: -32603, Message: err.Error()}
+	} else {
+		result = res
 	}
 
 	// Send response
@@ -230,6 +245,9 @@ func (c *rpcConn) writeJSON(v any) error {
 	}
 	c.writeMu.Lock()
 	defer c.writeMu.Unlock()
+	if c.tap != nil {
+		c.tap(true, data)
+	}
 	header := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(data))
 	if _, err := io.WriteString(c.writer, header); err != nil {
 		return err